@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Admin console. It talks to the server by websocket actions.
+//
+//go:embed admin
+var adminFiles embed.FS
+
+type ConfigResponse struct {
+	CommonResponse
+	Config Config `json:"config"`
+}
+
+type ParticipantsResponse struct {
+	CommonResponse
+	Participants []Participant `json:"participants"`
+	// Number of participants who have not won any prize.
+	Available       int    `json:"available"`
+	ParticipantsCSV string `json:"participants_csv"`
+}
+
+type UpdateResponse struct {
+	CommonResponse
+	Changes []string `json:"changes"`
+}
+
+type HistoryResponse struct {
+	CommonResponse
+	History []HistoryEntry `json:"history"`
+}
+
+type AuditResponse struct {
+	CommonResponse
+	Events []AuditEvent `json:"events"`
+}
+
+// adminHandler serves the embedded admin console.
+func adminHandler() http.Handler {
+	sub, _ := fs.Sub(adminFiles, "admin")
+	return http.StripPrefix("/admin/", http.FileServer(http.FS(sub)))
+}
+
+// checkAdminToken checks the token of admin actions if admin_token is set.
+func checkAdminToken(token string) bool {
+	if settings.AdminToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(settings.AdminToken)) == 1
+}
+
+// checkAdminRequest checks the token of admin HTTP requests in the "Authorization: Bearer <token>" header.
+func checkAdminRequest(r *http.Request) bool {
+	return checkAdminToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+}
+
+// processAdminAction processes the admin actions and sends the response.
+// It returns the error message if it fails.
+func processAdminAction(c *Client, action Action, token string) string {
+	a := action
+	// Do not send payloads back.
+	a.Config = nil
+	a.ParticipantsCSV = ""
+
+	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: a}
+	fail := func(errMsg string) string {
+		commonRes.Success = false
+		commonRes.ErrMsg = errMsg
+		sendResponse(c, commonRes)
+		return errMsg
+	}
+
+	if !checkAdminToken(token) {
+		return fail("invalid admin token")
+	}
+
+	switch a.Name {
+	case "get_config":
+		sendResponse(c, ConfigResponse{commonRes, currentConfig()})
+
+	case "update_config":
+		if action.Config == nil {
+			return fail("empty config")
+		}
+		lottery.NormalizeConfig(action.Config)
+
+		changes, err := updateState(func(_ Config, p []Participant) (Config, []Participant, error) {
+			return *action.Config, p, nil
+		}, persistConfig)
+		if err != nil {
+			return fail(err.Error())
+		}
+		sendResponse(c, UpdateResponse{commonRes, changes})
+
+	case "get_participants":
+		// Participants may be loaded from the store and emails are never sent to clients,
+		// so the CSV is made of participants in memory without emails.
+		p := currentParticipants()
+		buf, err := formatParticipantsCSV(p, false)
+		if err != nil {
+			return fail(err.Error())
+		}
+		sendResponse(c, ParticipantsResponse{commonRes, p, countAvailable(p, allWinners(lot.AllWinners())), string(buf)})
+
+	case "update_participants":
+		r := csv.NewReader(strings.NewReader(action.ParticipantsCSV))
+		r.FieldsPerRecord = -1
+		rows, err := r.ReadAll()
+		if err != nil {
+			return fail(fmt.Sprintf("invalid participants CSV: %v", err))
+		}
+
+		newParticipants, err := lottery.ParseParticipants(rows)
+		if err != nil {
+			return fail(err.Error())
+		}
+		changes, err := updateState(func(c Config, p []Participant) (Config, []Participant, error) {
+			keepEmails(newParticipants, p)
+			return c, newParticipants, nil
+		}, persistParticipants)
+		if err != nil {
+			return fail(err.Error())
+		}
+		sendResponse(c, UpdateResponse{commonRes, changes})
+
+	case "get_history":
+		sendResponse(c, HistoryResponse{commonRes, getHistoryEntries()})
+
+	case "get_audit":
+		sendResponse(c, AuditResponse{commonRes, getAuditEvents()})
+
+	case "get_inventory":
+		sendResponse(c, InventoryResponse{commonRes, getInventoryReport(currentConfig(), lot.AllWinners())})
+
+	case "claim_prize", "ship_prize":
+		if err := fulfill(a.PrizeID, a.ParticipantID, a.Name == "ship_prize"); err != nil {
+			return fail(err.Error())
+		}
+		sendResponse(c, InventoryResponse{commonRes, getInventoryReport(currentConfig(), lot.AllWinners())})
+	}
+
+	return ""
+}
+
+// formatParticipantsCSV returns the participants CSV. Emails are omitted unless withEmail is true.
+func formatParticipantsCSV(participants []Participant, withEmail bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(lottery.FormatParticipants(participants, withEmail)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// keepEmails sets emails of the current participants to the new participants if the new CSV has no emails,
+// e.g. it's edited in the admin console which never gets emails.
+func keepEmails(newParticipants, oldParticipants []Participant) {
+	for _, p := range newParticipants {
+		if p.Email != "" {
+			return
+		}
+	}
+
+	emails := map[string]string{}
+	for _, p := range oldParticipants {
+		emails[p.ID] = p.Email
+	}
+	for i := range newParticipants {
+		newParticipants[i].Email = emails[newParticipants[i].ID]
+	}
+}
+
+func writeConfig(file string, config Config) error {
+	buf, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, append(buf, '\n'))
+}
+
+// writeFileAtomic writes to a temp file and renames it to avoid a partial file.
+func writeFileAtomic(file string, buf []byte) error {
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// persistConfig writes the config applied by applyState to config_file.
+func persistConfig(config Config, _ []Participant) error {
+	if err := writeConfig(settings.ConfigFile, config); err != nil {
+		return fmt.Errorf("writeConfig() error: %v", err)
+	}
+	return nil
+}
+
+// persistParticipants writes the participants(with emails) applied by applyState to participants_file.
+func persistParticipants(_ Config, participants []Participant) error {
+	buf, err := formatParticipantsCSV(participants, true)
+	if err == nil {
+		err = writeFileAtomic(settings.ParticipantsFile, buf)
+	}
+	if err != nil {
+		return fmt.Errorf("write participants error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,677 @@
+(function () {
+  "use strict";
+
+  var conn = null;
+  var prizes = [];
+  var blacklists = [];
+  var theme = {};
+  var inventory = [];
+  var winners = {};
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, text) {
+    var e = document.createElement(tag);
+    if (text !== undefined) {
+      e.textContent = text;
+    }
+    return e;
+  }
+
+  function showMessage(text, isError) {
+    var m = $("message");
+    m.textContent = text;
+    m.className = isError ? "message error" : "message";
+  }
+
+  function token() {
+    return $("token").value;
+  }
+
+  function send(action) {
+    if (!conn || conn.readyState !== WebSocket.OPEN) {
+      showMessage("not connected", true);
+      return;
+    }
+    action.token = token();
+    conn.send(JSON.stringify(action));
+  }
+
+  // Tabs.
+  Array.prototype.forEach.call(document.querySelectorAll("nav button"), function (b) {
+    b.onclick = function () {
+      Array.prototype.forEach.call(document.querySelectorAll("nav button"), function (x) {
+        x.classList.toggle("active", x === b);
+      });
+      Array.prototype.forEach.call(document.querySelectorAll(".tab"), function (t) {
+        t.classList.toggle("active", t.id === b.dataset.tab);
+      });
+      refresh(b.dataset.tab);
+    };
+  });
+
+  function refresh(tab) {
+    switch (tab) {
+      case "draw":
+        send({ name: "get_prizes" });
+        break;
+      case "prizes":
+      case "blacklists":
+        send({ name: "get_config" });
+        break;
+      case "inventory":
+        send({ name: "get_config" });
+        send({ name: "get_inventory" });
+        break;
+      case "schedule":
+        send({ name: "get_prizes" });
+        loadSchedule();
+        break;
+      case "participants":
+        send({ name: "get_participants" });
+        break;
+      case "history":
+        send({ name: "get_history" });
+        break;
+      case "audit":
+        send({ name: "get_audit" });
+        break;
+    }
+  }
+
+  $("token").value = sessionStorage.getItem("lottery-admin-token") || "";
+  $("token").onchange = function () {
+    sessionStorage.setItem("lottery-admin-token", token());
+  };
+
+  // Draw.
+  function selectedPrize() {
+    return parseInt($("draw-prize").value, 10) || 0;
+  }
+
+  function selectedPrizeID() {
+    return (prizes[selectedPrize()] || {}).id;
+  }
+
+  function renderPrizeSelect() {
+    var s = $("draw-prize");
+    var selected = s.value;
+    s.innerHTML = "";
+    prizes.forEach(function (p, i) {
+      var o = el("option", i + ": " + p.name + " (" + p.num + ")");
+      o.value = i;
+      s.appendChild(o);
+    });
+    if (selected !== "" && selected < prizes.length) {
+      s.value = selected;
+    }
+  }
+
+  function renderWinners() {
+    var list = $("winners");
+    list.innerHTML = "";
+    (winners[selectedPrizeID()] || []).forEach(function (w, i) {
+      var li = el("li");
+      var cb = el("input");
+      cb.type = "checkbox";
+      cb.value = i;
+      li.appendChild(cb);
+      li.appendChild(document.createTextNode(" " + w.id + " " + w.name));
+      list.appendChild(li);
+    });
+  }
+
+  $("draw-prize").onchange = function () {
+    $("rolling").textContent = "";
+    send({ name: "get_winners", prize_id: selectedPrizeID() });
+  };
+
+  $("draw-start").onclick = function () {
+    var indexes = [];
+    Array.prototype.forEach.call(document.querySelectorAll("#winners input:checked"), function (cb) {
+      indexes.push(parseInt(cb.value, 10));
+    });
+    send({ name: "start", prize_id: selectedPrizeID(), old_winner_indexes: indexes });
+  };
+
+  $("draw-stop").onclick = function () {
+    send({ name: "stop", prize_id: selectedPrizeID() });
+  };
+
+  $("draw-abort").onclick = function () {
+    if (confirm("Abort the draw? Winners are not changed.")) {
+      send({ name: "abort", prize_id: selectedPrizeID() });
+    }
+  };
+
+  $("draw-display").onclick = function () {
+    send({ name: "display_prize", prize_id: selectedPrizeID() });
+  };
+
+  // Prizes.
+  function input(value, onchange) {
+    var i = el("input");
+    i.type = "text";
+    i.value = value === undefined ? "" : value;
+    i.onchange = function () {
+      onchange(i.value);
+    };
+    return i;
+  }
+
+  function removeButton(onclick) {
+    var b = el("button", "Remove");
+    b.onclick = onclick;
+    return b;
+  }
+
+  function cell(child) {
+    var td = el("td");
+    td.appendChild(child);
+    return td;
+  }
+
+  // upload uploads the media file and calls done with its URL.
+  function upload(file, done) {
+    var data = new FormData();
+    data.append("file", file);
+    fetch("/api/media", {
+      method: "POST",
+      headers: { Authorization: "Bearer " + token() },
+      body: data
+    }).then(function (r) {
+      return r.json();
+    }).then(function (res) {
+      if (!res.success) {
+        showMessage("upload: " + res.err_msg, true);
+        return;
+      }
+      done(res.url);
+      showMessage("uploaded " + res.url + ", click Save to apply");
+    }).catch(function (e) {
+      showMessage("upload: " + e, true);
+    });
+  }
+
+  // field returns a labeled input of obj[key].
+  function field(obj, key, label) {
+    var l = el("label", label + " ");
+    l.className = "field";
+    var i = input(obj[key], function (v) { obj[key] = v; });
+    l.appendChild(i);
+    return { label: l, input: i };
+  }
+
+  // mediaField returns a labeled URL input of obj[key] with an upload button.
+  function mediaField(obj, key, label, accept) {
+    var f = field(obj, key, label);
+    var file = el("input");
+    file.type = "file";
+    file.accept = accept;
+    file.onchange = function () {
+      if (file.files.length > 0) {
+        upload(file.files[0], function (url) {
+          obj[key] = url;
+          f.input.value = url;
+        });
+      }
+    };
+    f.label.appendChild(file);
+    return f.label;
+  }
+
+  var imageTypes = "image/png,image/jpeg,image/gif,image/webp";
+  var videoTypes = "video/mp4,video/webm";
+
+  function themeEditor(t) {
+    var div = el("div");
+    div.appendChild(field(t, "background", "Background").label);
+    div.appendChild(field(t, "foreground", "Foreground").label);
+    div.appendChild(field(t, "accent", "Accent").label);
+    div.appendChild(mediaField(t, "background_image", "Background image", imageTypes));
+    return div;
+  }
+
+  function policyEditor(p) {
+    var div = el("div");
+    var s = el("select");
+    ["exclusive", "repeat", "max_wins", "category"].forEach(function (name) {
+      s.appendChild(el("option", name));
+    });
+    s.value = p.policy || "exclusive";
+    s.onchange = function () {
+      p.policy = s.value === "exclusive" ? "" : s.value;
+    };
+    div.appendChild(s);
+    div.appendChild(field(p, "max_wins", "Max wins").label);
+    div.appendChild(field(p, "category", "Category").label);
+    return div;
+  }
+
+  // quotasEditor edits quotas of the prize as JSON, e.g. [{"attr": "office", "min": 1}].
+  function quotasEditor(p) {
+    var i = input(p.quotas ? JSON.stringify(p.quotas) : "", function (v) {
+      try {
+        p.quotas = v ? JSON.parse(v) : undefined;
+        i.classList.remove("invalid");
+      } catch (e) {
+        i.classList.add("invalid");
+        showMessage("quotas of " + p.name + ": " + e, true);
+      }
+    });
+    i.placeholder = '[{"attr": "office", "min": 1}]';
+    return i;
+  }
+
+  function renderTheme() {
+    var div = $("theme");
+    div.innerHTML = "";
+    div.appendChild(themeEditor(theme));
+  }
+
+  function renderPrizes() {
+    var body = $("prizes-body");
+    body.innerHTML = "";
+    prizes.forEach(function (p, i) {
+      var tr = el("tr");
+      tr.appendChild(el("td", i));
+      tr.appendChild(cell(input(p.id, function (v) { p.id = v; })));
+      tr.appendChild(cell(input(p.tier, function (v) { p.tier = parseInt(v, 10) || 0; })));
+      tr.appendChild(cell(input(p.name, function (v) { p.name = v; })));
+      tr.appendChild(cell(input(p.num, function (v) { p.num = parseInt(v, 10) || 0; })));
+      tr.appendChild(cell(input(p.content, function (v) { p.content = v; })));
+      tr.appendChild(cell(input(p.sku, function (v) { p.sku = v; })));
+      tr.appendChild(cell(policyEditor(p)));
+      tr.appendChild(cell(quotasEditor(p)));
+      var media = el("div");
+      media.appendChild(mediaField(p, "image", "Image", imageTypes));
+      media.appendChild(mediaField(p, "video", "Video", videoTypes));
+      media.appendChild(mediaField(p, "sponsor_logo", "Sponsor logo", imageTypes));
+      tr.appendChild(cell(media));
+      p.theme = p.theme || {};
+      tr.appendChild(cell(themeEditor(p.theme)));
+      tr.appendChild(cell(removeButton(function () {
+        prizes.splice(i, 1);
+        renderPrizes();
+      })));
+      body.appendChild(tr);
+    });
+  }
+
+  $("prizes-add").onclick = function () {
+    prizes.push({ id: "", tier: 0, name: "", num: 1, content: "" });
+    renderPrizes();
+  };
+
+  // compact returns a copy of the object without empty fields, or undefined if it's empty.
+  function compact(o) {
+    var c = {};
+    Object.keys(o || {}).forEach(function (k) {
+      if (o[k] !== "" && o[k] !== undefined) {
+        c[k] = o[k];
+      }
+    });
+    return Object.keys(c).length > 0 ? c : undefined;
+  }
+
+  function saveConfig() {
+    var ps = prizes.map(function (p) {
+      var c = compact(p);
+      c.theme = compact(p.theme);
+      if (c.max_wins !== undefined) {
+        c.max_wins = parseInt(c.max_wins, 10) || 0;
+      }
+      return c;
+    });
+    send({ name: "update_config", config: { prizes: ps, blacklists: blacklists, theme: compact(theme), inventory: inventory } });
+  }
+
+  $("prizes-save").onclick = saveConfig;
+
+  // Blacklists.
+  function renderBlacklists() {
+    var body = $("blacklists-body");
+    body.innerHTML = "";
+    blacklists.forEach(function (b, i) {
+      var tr = el("tr");
+      tr.appendChild(cell(input(b.max_tier, function (v) {
+        b.max_tier = v === "" ? undefined : parseInt(v, 10) || 0;
+      })));
+      tr.appendChild(cell(input((b.prize_ids || []).join(","), function (v) {
+        b.prize_ids = v.split(",").map(function (s) { return s.trim(); }).filter(function (s) { return s !== ""; });
+      })));
+      tr.appendChild(cell(input((b.ids || []).join(","), function (v) {
+        b.ids = v.split(",").map(function (s) { return s.trim(); }).filter(function (s) { return s !== ""; });
+      })));
+      tr.appendChild(cell(removeButton(function () {
+        blacklists.splice(i, 1);
+        renderBlacklists();
+      })));
+      body.appendChild(tr);
+    });
+  }
+
+  $("blacklists-add").onclick = function () {
+    blacklists.push({ max_tier: 0, prize_ids: [], ids: [] });
+    renderBlacklists();
+  };
+
+  $("blacklists-save").onclick = saveConfig;
+
+  // Inventory.
+  var report = { items: [], sponsors: [], winners: [] };
+
+  function renderInventory() {
+    var body = $("inventory-body");
+    body.innerHTML = "";
+    inventory.forEach(function (item, i) {
+      var r = report.items.filter(function (x) { return x.sku === item.sku; })[0] || {};
+      var tr = el("tr");
+      tr.appendChild(cell(input(item.sku, function (v) { item.sku = v; })));
+      tr.appendChild(cell(input(item.name, function (v) { item.name = v; })));
+      tr.appendChild(cell(input(item.sponsor, function (v) { item.sponsor = v; })));
+      tr.appendChild(cell(input(item.unit_value, function (v) { item.unit_value = parseFloat(v) || 0; })));
+      tr.appendChild(cell(input(item.currency, function (v) { item.currency = v; })));
+      tr.appendChild(cell(input(item.quantity, function (v) { item.quantity = parseInt(v, 10) || 0; })));
+      [r.awarded, r.claimed, r.shipped, r.remaining].forEach(function (n) {
+        tr.appendChild(el("td", n === undefined ? "" : n));
+      });
+      tr.appendChild(cell(removeButton(function () {
+        inventory.splice(i, 1);
+        renderInventory();
+      })));
+      body.appendChild(tr);
+    });
+
+    var sb = $("sponsors-body");
+    sb.innerHTML = "";
+    report.sponsors.forEach(function (s) {
+      sb.appendChild(row([s.sponsor, s.currency, s.quantity, s.awarded, s.total_value.toFixed(2), s.awarded_value.toFixed(2)]));
+    });
+
+    var fb = $("fulfillment-body");
+    fb.innerHTML = "";
+    report.winners.forEach(function (w) {
+      var tr = row([
+        w.prize_name,
+        w.sku,
+        w.participant.id + " " + w.participant.name,
+        w.claimed_at ? new Date(w.claimed_at).toLocaleString() : "",
+        w.shipped_at ? new Date(w.shipped_at).toLocaleString() : ""
+      ]);
+      var td = el("td");
+      [["claim_prize", "Claimed", w.claimed_at], ["ship_prize", "Shipped", w.shipped_at]].forEach(function (a) {
+        var b = el("button", a[1]);
+        b.disabled = !!a[2];
+        b.onclick = function () {
+          send({ name: a[0], prize_id: w.prize_id, participant_id: w.participant.id });
+        };
+        td.appendChild(b);
+      });
+      tr.appendChild(td);
+      fb.appendChild(tr);
+    });
+  }
+
+  $("inventory-add").onclick = function () {
+    inventory.push({ sku: "", name: "", sponsor: "", unit_value: 0, currency: "", quantity: 0 });
+    renderInventory();
+  };
+
+  $("inventory-save").onclick = saveConfig;
+
+  // Schedule.
+  var schedule = [];
+
+  // scheduleAPI calls the schedule API and renders the schedule in the response.
+  function scheduleAPI(method, query, body) {
+    var opts = { method: method, headers: { Authorization: "Bearer " + token() } };
+    if (body) {
+      opts.headers["Content-Type"] = "application/json";
+      opts.body = JSON.stringify(body);
+    }
+    return fetch("/api/schedule" + query, opts).then(function (r) {
+      return r.json();
+    }).then(function (res) {
+      if (!res.success) {
+        // Errors have no schedule, keep the current one.
+        showMessage("schedule: " + res.err_msg, true);
+        return res;
+      }
+      schedule = res.schedule || [];
+      renderSchedule();
+      return res;
+    }).catch(function (e) {
+      showMessage("schedule: " + e, true);
+    });
+  }
+
+  function loadSchedule() {
+    scheduleAPI("GET", "");
+  }
+
+  function prizeName(id) {
+    var p = prizes.filter(function (x) { return x.id === id; })[0];
+    return p ? p.name : id;
+  }
+
+  function renderSchedulePrizes() {
+    var s = $("schedule-prize");
+    var selected = s.value;
+    s.innerHTML = "";
+    prizes.forEach(function (p) {
+      var o = el("option", p.id + ": " + p.name);
+      o.value = p.id;
+      s.appendChild(o);
+    });
+    if (selected) {
+      s.value = selected;
+    }
+  }
+
+  function renderSchedule() {
+    var body = $("schedule-body");
+    body.innerHTML = "";
+    schedule.forEach(function (d) {
+      var tr = row([new Date(d.at).toLocaleString(), prizeName(d.prize_id), d.duration, d.countdown, d.status, d.err_msg || ""]);
+      var td = el("td");
+      if (d.status !== "running") {
+        td.appendChild(removeButton(function () {
+          scheduleAPI("DELETE", "?id=" + encodeURIComponent(d.id));
+        }));
+      }
+      tr.appendChild(td);
+      body.appendChild(tr);
+    });
+  }
+
+  $("schedule-add").onclick = function () {
+    var at = new Date($("schedule-at").value);
+    if (isNaN(at)) {
+      showMessage("schedule: invalid time", true);
+      return;
+    }
+    scheduleAPI("POST", "", {
+      prize_id: $("schedule-prize").value,
+      at: at.toISOString(),
+      duration: $("schedule-duration").value,
+      countdown: $("schedule-countdown").value
+    }).then(function (res) {
+      if (res && res.success) {
+        showMessage("scheduled");
+      }
+    });
+  };
+
+  $("schedule-refresh").onclick = loadSchedule;
+
+  // Participants.
+  $("participants-save").onclick = function () {
+    send({ name: "update_participants", participants_csv: $("participants-csv").value });
+  };
+
+  // History and audit.
+  function row(cells) {
+    var tr = el("tr");
+    cells.forEach(function (c) {
+      tr.appendChild(el("td", c));
+    });
+    return tr;
+  }
+
+  function names(ps) {
+    return (ps || []).map(function (p) { return p.name; }).join(", ");
+  }
+
+  $("history-refresh").onclick = function () { refresh("history"); };
+  $("audit-refresh").onclick = function () { refresh("audit"); };
+
+  // Messages from the server.
+  function onMessage(res) {
+    var a = res.action || {};
+
+    if (!res.success && res.err_msg) {
+      showMessage(a.name + ": " + res.err_msg, true);
+    }
+
+    switch (a.name) {
+      case "get_prizes":
+        prizes = res.prizes || [];
+        renderPrizeSelect();
+        renderSchedulePrizes();
+        send({ name: "get_winners", prize_id: selectedPrizeID() });
+        break;
+      case "get_winners":
+        winners[a.prize_id] = res.winners || [];
+        renderWinners();
+        break;
+      case "countdown":
+        showMessage("scheduled draw of " + prizeName(a.prize_id) + " starts in " + res.seconds + "s");
+        break;
+      case "start":
+        if (res.success) {
+          $("rolling").textContent = names(res.winners);
+        }
+        break;
+      case "stop":
+        if (document.querySelector("nav button.active").dataset.tab === "schedule") {
+          loadSchedule();
+        }
+        $("rolling").textContent = names(res.winners);
+        if (res.success) {
+          winners[a.prize_id] = res.winners || [];
+          renderWinners();
+          showMessage("winners of " + prizes[a.prize_index].name + " committed");
+        }
+        break;
+      case "abort":
+        // The draw is aborted, or no draw is running. Committed winners are not changed.
+        $("rolling").textContent = "";
+        renderWinners();
+        showMessage(res.err_msg, true);
+        break;
+      case "get_config":
+        if (res.success) {
+          prizes = res.config.prizes || [];
+          blacklists = res.config.blacklists || [];
+          theme = res.config.theme || {};
+          inventory = res.config.inventory || [];
+          renderTheme();
+          renderInventory();
+          renderPrizes();
+          renderBlacklists();
+        }
+        break;
+      case "update_config":
+      case "update_participants":
+        if (res.success) {
+          showMessage("saved: " + ((res.changes || []).join("; ") || "no changes"));
+          if (a.name === "update_config") {
+            send({ name: "get_inventory" });
+          }
+        }
+        break;
+      case "get_inventory":
+      case "claim_prize":
+      case "ship_prize":
+        if (res.success) {
+          report = res.report;
+          renderInventory();
+        }
+        break;
+      case "get_participants":
+        if (res.success) {
+          $("participants-csv").value = res.participants_csv;
+          $("participants-summary").textContent =
+            (res.participants || []).length + " participants, " + res.available + " available.";
+        }
+        break;
+      case "get_history":
+        var hb = $("history-body");
+        hb.innerHTML = "";
+        (res.history || []).slice().reverse().forEach(function (h) {
+          hb.appendChild(row([
+            new Date(h.time).toLocaleString(),
+            h.prize_id + ": " + h.prize_name,
+            h.action,
+            (h.old_winner_indexes || []).join(","),
+            names(h.winners),
+            h.err_msg
+          ]));
+        });
+        break;
+      case "get_audit":
+        var ab = $("audit-body");
+        ab.innerHTML = "";
+        (res.events || []).slice().reverse().forEach(function (e) {
+          ab.appendChild(row([
+            new Date(e.time).toLocaleString(),
+            e.client_id,
+            e.remote_addr,
+            e.action,
+            e.prize_id,
+            e.success ? "OK" : e.err_msg
+          ]));
+        });
+        break;
+      case "state_changed":
+        showMessage("state changed: " + (res.changes || []).join("; "));
+        prizes = res.prizes || [];
+        renderPrizeSelect();
+        renderSchedulePrizes();
+        break;
+    }
+  }
+
+  function connect() {
+    fetch("/get-ws-url/").then(function (r) {
+      return r.text();
+    }).then(function (url) {
+      conn = new WebSocket(url);
+      conn.onopen = function () {
+        $("status").textContent = "connected";
+        $("status").className = "status connected";
+        refresh(document.querySelector("nav button.active").dataset.tab);
+      };
+      conn.onclose = function () {
+        $("status").textContent = "disconnected";
+        $("status").className = "status";
+        setTimeout(connect, 3000);
+      };
+      conn.onmessage = function (evt) {
+        // Queued messages are joined by newlines.
+        evt.data.split("\n").forEach(function (m) {
+          if (m) {
+            onMessage(JSON.parse(m));
+          }
+        });
+      };
+    }).catch(function () {
+      setTimeout(connect, 3000);
+    });
+  }
+
+  connect();
+})();
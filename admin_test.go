@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateLargeConfig(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	newConfig := testConfig()
+	for i := 4; i <= 16; i++ {
+		newConfig.Prizes = append(newConfig.Prizes, Prize{ID: fmt.Sprintf("p%v", i), Name: fmt.Sprintf("Prize %v", i), Content: "A gift card of the sponsor", Num: 1})
+	}
+	if buf, _ := json.Marshal(Action{Name: "update_config", Config: &newConfig}); len(buf) <= 512 {
+		t.Fatalf("action = %v bytes, want a config larger than 512 bytes", len(buf))
+	}
+
+	res := c.do(Action{Name: "update_config", Config: &newConfig})
+	if !res.Success || len(res.Changes) != 13 {
+		t.Fatalf("update_config = %+v, want 13 prizes added", res)
+	}
+
+	if res = c.do(Action{Name: "get_config"}); res.Config == nil || len(res.Config.Prizes) != 16 {
+		t.Errorf("get_config = %+v, want 16 prizes", res)
+	}
+
+	buf, err := os.ReadFile(settings.ConfigFile)
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	var saved Config
+	if err = json.Unmarshal(buf, &saved); err != nil || len(saved.Prizes) != 16 {
+		t.Errorf("saved config = %+v, %v, want 16 prizes", saved, err)
+	}
+}
+
+func TestDrawAdminToken(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	c := dialTestClient(t, srv)
+
+	for _, name := range []string{"start", "stop", "abort"} {
+		if res := c.do(Action{Name: name, PrizeID: "3rd"}); res.Success || res.ErrMsg != "invalid admin token" {
+			t.Errorf("%v without token = %+v, want invalid admin token", name, res)
+		}
+	}
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd", Token: "secret"})
+	if res := c.waitFor(id, "start"); !res.Success {
+		t.Fatalf("start with token = %+v", res)
+	}
+
+	// The draw is not stopped by anonymous clients.
+	if res := c.do(Action{Name: "stop", PrizeID: "3rd", Token: "wrong"}); res.Success || res.ErrMsg != "invalid admin token" {
+		t.Errorf("stop with a wrong token = %+v, want invalid admin token", res)
+	}
+
+	c.send(Action{Name: "stop", PrizeID: "3rd", Token: "secret"})
+	if res := c.waitFor(id, "stop"); !res.Success || len(res.Winners) != 3 {
+		t.Errorf("stop with token = %+v, want 3 winners", res)
+	}
+}
+
+func TestGetParticipantsWithoutEmails(t *testing.T) {
+	p := testParticipants(3)
+	p[0].Email = "p1@example.com"
+	srv := newTestServer(t, testConfig(), p)
+	c := dialTestClient(t, srv)
+
+	// The participants file does not exist, e.g. participants are loaded from the store.
+	if _, err := os.Stat(settings.ParticipantsFile); !os.IsNotExist(err) {
+		t.Fatalf("Stat(%v) error = %v, want not exist", settings.ParticipantsFile, err)
+	}
+
+	res := c.do(Action{Name: "get_participants"})
+	if !res.Success || res.ParticipantsCSV != "1,P1\n2,P2\n3,P3\n" {
+		t.Fatalf("get_participants = %+v, want the CSV without emails", res)
+	}
+
+	// The same action of the HTTP API.
+	resp, err := http.Get(srv.URL + "/api/participants")
+	if err != nil {
+		t.Fatalf("GET /api/participants error: %v", err)
+	}
+	defer resp.Body.Close()
+	buf, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(buf), "example.com") {
+		t.Errorf("GET /api/participants = %v %s, want participants without emails", resp.StatusCode, buf)
+	}
+}
+
+func TestUpdateParticipantsKeepsEmails(t *testing.T) {
+	p := testParticipants(3)
+	p[0].Email = "p1@example.com"
+	srv := newTestServer(t, testConfig(), p)
+	c := dialTestClient(t, srv)
+
+	// The CSV edited in the admin console has no emails.
+	if res := c.do(Action{Name: "update_participants", ParticipantsCSV: "1,P1\n2,P2\n3,P3\n4,P4\n"}); !res.Success || len(res.Changes) != 1 {
+		t.Fatalf("update_participants = %+v, want 1 participant added", res)
+	}
+	if p := currentParticipants(); p[0].Email != "p1@example.com" {
+		t.Errorf("email of participant 1 = %q, want it kept", p[0].Email)
+	}
+
+	buf, err := os.ReadFile(settings.ParticipantsFile)
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	if want := "id,name,email\n1,P1,p1@example.com\n2,P2,\n3,P3,\n4,P4,\n"; string(buf) != want {
+		t.Errorf("participants file = %q, want %q", buf, want)
+	}
+}
+
+func TestUpdateWriteError(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	// Files can't be written to a directory which does not exist.
+	dir := filepath.Join(t.TempDir(), "missing")
+	settings.ConfigFile = filepath.Join(dir, "config.json")
+	settings.ParticipantsFile = filepath.Join(dir, "participants.csv")
+
+	newConfig := testConfig()
+	newConfig.Prizes[0].Content = "mugs"
+	if res := c.do(Action{Name: "update_config", Config: &newConfig}); res.Success || !strings.Contains(res.ErrMsg, "writeConfig()") {
+		t.Fatalf("update_config = %+v, want the write error", res)
+	}
+	if res := c.do(Action{Name: "update_participants", ParticipantsCSV: "1,P1\n2,P2\n"}); res.Success || !strings.Contains(res.ErrMsg, "write participants") {
+		t.Fatalf("update_participants = %+v, want the write error", res)
+	}
+
+	// Nothing is applied.
+	if got := currentConfig().Prizes[0].Content; got != "" {
+		t.Errorf("content of prize 3rd = %q, want it unchanged", got)
+	}
+	if got := lot.Config().Prizes[0].Content; got != "" {
+		t.Errorf("content of prize 3rd in lot = %q, want it unchanged", got)
+	}
+	if got := len(lot.Participants()); got != 10 {
+		t.Errorf("participants in lot = %v, want 10", got)
+	}
+	if res := c.do(Action{Name: "get_prizes"}); len(res.Prizes) != 3 || res.Prizes[0].Content != "" {
+		t.Errorf("get_prizes = %+v, want the prizes unchanged", res)
+	}
+}
+
+func TestAuditedActions(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	auditMu.Lock()
+	auditEvents = nil
+	auditMu.Unlock()
+	c := dialTestClient(t, srv)
+
+	c.do(Action{Name: "get_prizes"})
+	c.do(Action{Name: "get_winners", PrizeID: "3rd"})
+	c.draw("3rd", nil, 1)
+	c.do(Action{Name: "get_config"})
+	// Audits are recorded after responses, wait for the audit of get_config.
+	c.do(Action{Name: "get_winners", PrizeID: "3rd"})
+
+	want := "start,stop,get_config"
+	names := func(events []AuditEvent) string {
+		l := []string{}
+		for _, e := range events {
+			l = append(l, e.Action)
+		}
+		return strings.Join(l, ",")
+	}
+	if got := names(getAuditEvents()); got != want {
+		t.Errorf("audit events = %v, want %v", got, want)
+	}
+
+	// Audit events are saved to the store in order.
+	auditWG.Wait()
+	events, err := st.AuditEvents(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("AuditEvents() error: %v", err)
+	}
+	if got := names(events); got != want {
+		t.Errorf("audit events in the store = %v, want %v", got, want)
+	}
+}
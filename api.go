@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// openAPISpec is the OpenAPI spec of the HTTP API, served at /api/openapi.yaml.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// Max size of request bodies of the HTTP API, e.g. update_config.
+const maxAPIBodySize = 1 << 20
+
+// apiHandler returns the handler of the HTTP API which mirrors WebSocket actions.
+// Responses have the same JSON as responses of the actions.
+//
+//	GET  /api/prizes                get_prizes
+//	GET  /api/winners?prize_id=<id> get_winners
+//	GET  /api/participants          get_participants(admin)
+//	POST /api/draws/start           start(admin), the draw is broadcast to clients and displays
+//	POST /api/draws/stop            stop(admin), responds with the committed winners
+//	POST /api/draws/abort           abort(admin), cancels the draw without committing the winners
+//	POST /api/actions               any other action, e.g. update_config, display_prize
+//	GET  /api/events                Server-Sent Events of draws, state changes and countdowns
+//	GET  /api/openapi.yaml          OpenAPI spec
+//
+// Admin actions require "Authorization: Bearer <admin_token>".
+func apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/prizes", apiGet("get_prizes"))
+	mux.HandleFunc("/api/winners", apiGet("get_winners"))
+	mux.HandleFunc("/api/participants", apiGet("get_participants"))
+	mux.HandleFunc("/api/draws/start", serveAPIStart)
+	mux.HandleFunc("/api/draws/stop", serveAPIStop)
+	mux.HandleFunc("/api/draws/abort", serveAPIAbort)
+	mux.HandleFunc("/api/actions", serveAPIAction)
+	mux.HandleFunc("/api/events", serveEvents)
+	mux.HandleFunc("/api/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+	})
+	return mux
+}
+
+// newAPIClient returns a client which receives the response of one action of the API(http or grpc) request.
+// It's not registered to the hub, so it does not receive broadcast messages.
+func newAPIClient(api, remoteAddr string) *Client {
+	id := newID()
+	return &Client{
+		send:       make(chan []byte, 1),
+		quit:       make(chan struct{}),
+		id:         id,
+		remoteAddr: remoteAddr,
+		logger:     slog.With("client_id", id, "api", api),
+	}
+}
+
+// newAPIAction returns the action of the request: the JSON body of POST requests,
+// or prize_id(prize_index for old clients) in the query of GET requests.
+// The request ID is read from the X-Request-ID header if it's not set, and the token from the Authorization header.
+func newAPIAction(w http.ResponseWriter, r *http.Request, name string) (Action, error) {
+	a := Action{Name: name}
+
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		a.PrizeID = q.Get("prize_id")
+		if s := q.Get("prize_index"); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return a, fmt.Errorf("invalid prize_index: %v", s)
+			}
+			a.PrizeIndex = i
+		}
+
+	case "POST":
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize)).Decode(&a)
+		// Empty body is OK, e.g. stop.
+		if err != nil && err != io.EOF {
+			return a, fmt.Errorf("decode error: %v", err)
+		}
+		if name != "" {
+			a.Name = name
+		}
+
+	default:
+		return a, fmt.Errorf("method not allowed")
+	}
+
+	if a.RequestID == "" {
+		a.RequestID = r.Header.Get("X-Request-ID")
+	}
+	if a.Token == "" {
+		a.Token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return a, nil
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, res interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// apiStatus returns the HTTP status of the failed action by the error message.
+func apiStatus(errMsg string) int {
+	switch errMsg {
+	case "invalid admin token":
+		return http.StatusUnauthorized
+	case "method not allowed":
+		return http.StatusMethodNotAllowed
+	}
+	return http.StatusBadRequest
+}
+
+// failAPI writes the failed response of the action.
+func failAPI(w http.ResponseWriter, r *http.Request, a Action, errMsg string) {
+	slog.Warn("api error", "remote_addr", r.RemoteAddr, "path", r.URL.Path, "action", a.Name, "err", errMsg)
+
+	a.Token = ""
+	a.Config = nil
+	a.ParticipantsCSV = ""
+	writeAPIResponse(w, apiStatus(errMsg), CommonResponse{Success: false, ErrMsg: errMsg, Action: a})
+}
+
+// processAPIAction processes the action of the API client by processAction as if it's received from a WebSocket client,
+// so that it shares the validation, audit and metrics of WebSocket actions.
+// It returns the JSON and common fields of the response.
+func processAPIAction(c *Client, a Action) ([]byte, CommonResponse, error) {
+	var res CommonResponse
+
+	message, err := json.Marshal(a)
+	if err != nil {
+		return nil, res, err
+	}
+
+	processAction(c, message)
+
+	var buf []byte
+	select {
+	case buf = <-c.send:
+	default:
+		// Actions without responses, e.g. unknown actions.
+		return nil, res, fmt.Errorf("unknown action")
+	}
+
+	if err = json.Unmarshal(buf, &res); err != nil {
+		return nil, res, err
+	}
+	return buf, res, nil
+}
+
+// apiStartDraw starts the draw of the API client. Like scheduled draws, responses of the draw are broadcast to all clients.
+func apiStartDraw(c *Client, a Action) string {
+	errMsg := startDraw(nil, a)
+	recordAudit(c, a, errMsg)
+	return errMsg
+}
+
+// apiStopDraw stops(or aborts if the action is abort) the running draw of the API client
+// and waits until the winners are committed(or discarded) or ctx is done.
+// It returns the response of the draw, or the error message if no draw is running.
+func apiStopDraw(ctx context.Context, c *Client, a Action) (WinnersResponse, string) {
+	end := stopDrawLocked
+	if a.Name == "abort" {
+		end = abortDrawLocked
+	}
+
+	controlMu.Lock()
+	requestID, done := runningRequestID, runningDone
+	errMsg := end(nil, a)
+	controlMu.Unlock()
+
+	recordAudit(c, a, errMsg)
+	if errMsg != "" {
+		return WinnersResponse{}, errMsg
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return WinnersResponse{}, ctx.Err().Error()
+	}
+
+	e, _ := findHistoryEntry(requestID)
+	a.PrizeID, a.PrizeIndex = e.PrizeID, e.PrizeIndex
+	return genWinnersResponse(a, e.Winners, e.ErrMsg), ""
+}
+
+// runAPIAction processes the action of the HTTP request and writes its response.
+func runAPIAction(w http.ResponseWriter, r *http.Request, a Action) {
+	buf, res, err := processAPIAction(newAPIClient("http", r.RemoteAddr), a)
+	if err != nil {
+		failAPI(w, r, a, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if !res.Success {
+		status = apiStatus(res.ErrMsg)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(buf, '\n'))
+}
+
+// apiGet returns the handler of the GET request of the action.
+func apiGet(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			failAPI(w, r, Action{Name: name}, "method not allowed")
+			return
+		}
+
+		a, err := newAPIAction(w, r, name)
+		if err != nil {
+			failAPI(w, r, a, err.Error())
+			return
+		}
+		runAPIAction(w, r, a)
+	}
+}
+
+// serveAPIAction processes the action in the JSON body. Draws are controlled by /api/draws/ only,
+// their rounds are broadcast instead of being sent to the requesting client.
+func serveAPIAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		failAPI(w, r, Action{}, "method not allowed")
+		return
+	}
+
+	a, err := newAPIAction(w, r, "")
+	if err != nil {
+		failAPI(w, r, a, err.Error())
+		return
+	}
+
+	if a.Name == "start" || a.Name == "stop" || a.Name == "abort" {
+		failAPI(w, r, a, fmt.Sprintf("use /api/draws/%v", a.Name))
+		return
+	}
+	runAPIAction(w, r, a)
+}
+
+// newAPIDrawAction returns the start, stop or abort action of the request after checking the admin token.
+func newAPIDrawAction(w http.ResponseWriter, r *http.Request, name string) (*Client, Action, bool) {
+	c := newAPIClient("http", r.RemoteAddr)
+
+	var (
+		a   = Action{Name: name}
+		err = fmt.Errorf("method not allowed")
+	)
+	if r.Method == "POST" {
+		a, err = newAPIAction(w, r, name)
+	}
+	if err == nil && !checkAdminToken(a.Token) {
+		err = fmt.Errorf("invalid admin token")
+	}
+	a.Token = ""
+
+	if err != nil {
+		recordAudit(c, a, err.Error())
+		failAPI(w, r, a, err.Error())
+		return c, a, false
+	}
+
+	if a.RequestID == "" {
+		a.RequestID = newID()
+	}
+	resolvePrize(&a, currentConfig().Prizes)
+	return c, a, true
+}
+
+// serveAPIStart starts the draw. Like scheduled draws, responses of the draw are broadcast to all clients.
+func serveAPIStart(w http.ResponseWriter, r *http.Request) {
+	c, a, ok := newAPIDrawAction(w, r, "start")
+	if !ok {
+		return
+	}
+
+	if errMsg := apiStartDraw(c, a); errMsg != "" {
+		failAPI(w, r, a, errMsg)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, CommonResponse{Success: true, ErrMsg: "", Action: a})
+}
+
+// serveAPIStop stops the running draw and responds with the winners after they're committed.
+func serveAPIStop(w http.ResponseWriter, r *http.Request) {
+	c, a, ok := newAPIDrawAction(w, r, "stop")
+	if !ok {
+		return
+	}
+
+	res, errMsg := apiStopDraw(r.Context(), c, a)
+	if errMsg != "" {
+		failAPI(w, r, a, errMsg)
+		return
+	}
+
+	status := http.StatusOK
+	if !res.Success {
+		status = http.StatusInternalServerError
+	}
+	writeAPIResponse(w, status, res)
+}
+
+// serveAPIAbort aborts the running draw and responds after start() of the draw returns. Winners are not changed.
+func serveAPIAbort(w http.ResponseWriter, r *http.Request) {
+	c, a, ok := newAPIDrawAction(w, r, "abort")
+	if !ok {
+		return
+	}
+
+	res, errMsg := apiStopDraw(r.Context(), c, a)
+	if errMsg != "" {
+		failAPI(w, r, a, errMsg)
+		return
+	}
+
+	status := http.StatusOK
+	if res.ErrMsg != errDrawAborted.Error() {
+		// The draw failed before it's aborted.
+		status = http.StatusInternalServerError
+	}
+	writeAPIResponse(w, status, res)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// postAPI posts the JSON body to the HTTP API and decodes the response.
+func postAPI(t *testing.T, url, token, body string) (int, testResponse) {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest() error: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %v error: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	var res testResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("Decode() error: %v", err)
+	}
+	return resp.StatusCode, res
+}
+
+func TestAPIDraw(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	c := dialTestClient(t, srv)
+
+	if status, res := postAPI(t, srv.URL+"/api/draws/start", "", `{"prize_id":"3rd"}`); status != http.StatusUnauthorized {
+		t.Fatalf("start without token = %v %+v, want 401", status, res)
+	}
+
+	status, res := postAPI(t, srv.URL+"/api/draws/start", "secret", `{"prize_id":"3rd","request_id":"api-1"}`)
+	if status != http.StatusOK || !res.Success {
+		t.Fatalf("start = %v %+v, want 200", status, res)
+	}
+
+	// Rounds of draws started by the API are broadcast to clients.
+	if round := c.waitFor("api-1", "start"); len(round.Winners) != 3 {
+		t.Errorf("round = %+v, want 3 winners", round)
+	}
+
+	if status, res = postAPI(t, srv.URL+"/api/draws/start", "secret", `{"prize_id":"2nd"}`); status != http.StatusBadRequest {
+		t.Errorf("second start = %v %+v, want 400", status, res)
+	}
+
+	status, res = postAPI(t, srv.URL+"/api/draws/stop", "secret", ``)
+	if status != http.StatusOK || !res.Success || len(res.Winners) != 3 || !distinct(res.Winners) {
+		t.Fatalf("stop = %v %+v, want 3 distinct winners", status, res)
+	}
+	if committed := c.waitFor("api-1", "stop"); strings.Join(testIDs(committed.Winners), ",") != strings.Join(testIDs(res.Winners), ",") {
+		t.Errorf("broadcast winners = %v, want %v", testIDs(committed.Winners), testIDs(res.Winners))
+	}
+
+	resp, err := http.Get(srv.URL + "/api/winners?prize_id=3rd")
+	if err != nil {
+		t.Fatalf("GET /api/winners error: %v", err)
+	}
+	defer resp.Body.Close()
+	var winners testResponse
+	if err = json.NewDecoder(resp.Body).Decode(&winners); err != nil || len(winners.Winners) != 3 {
+		t.Errorf("GET /api/winners = %+v, %v, want 3 winners", winners, err)
+	}
+}
+
+func TestAPIAbort(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	if status, res := postAPI(t, srv.URL+"/api/draws/start", "", `{"prize_id":"3rd","request_id":"api-1"}`); status != http.StatusOK {
+		t.Fatalf("start = %v %+v, want 200", status, res)
+	}
+	c.waitFor("api-1", "start")
+
+	status, res := postAPI(t, srv.URL+"/api/draws/abort", "", ``)
+	if status != http.StatusOK || res.Name != "abort" || res.ErrMsg != errDrawAborted.Error() || len(res.Winners) != 0 {
+		t.Fatalf("abort = %v %+v, want 200 and no winners", status, res)
+	}
+	c.waitFor("api-1", "abort")
+
+	if status, res = postAPI(t, srv.URL+"/api/draws/abort", "", ``); status != http.StatusBadRequest {
+		t.Errorf("abort without draw = %v %+v, want 400", status, res)
+	}
+	if status, res = postAPI(t, srv.URL+"/api/actions", "", `{"name":"abort"}`); status != http.StatusBadRequest {
+		t.Errorf("POST /api/actions abort = %v %+v, want 400", status, res)
+	}
+}
+
+func TestAPIActions(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"name":"get_prizes"}`, http.StatusOK},
+		{`{"name":"start","prize_id":"3rd"}`, http.StatusBadRequest},
+		{`{"name":"unknown"}`, http.StatusBadRequest},
+		{`{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status, res := postAPI(t, srv.URL+"/api/actions", "", tt.body); status != tt.status {
+			t.Errorf("POST /api/actions %v = %v %+v, want %v", tt.body, status, res, tt.status)
+		}
+	}
+}
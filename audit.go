@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/northbright/lottery-server/store"
+)
+
+// Max number of audit events / history entries kept in memory.
+const (
+	maxAuditEvents    = 1000
+	maxHistoryEntries = 1000
+)
+
+// Max number of audit events waiting to be saved to the store.
+const auditQueueSize = 1024
+
+var (
+	auditMu        sync.Mutex
+	auditEvents    []AuditEvent
+	historyMu      sync.Mutex
+	historyEntries []HistoryEntry
+
+	// Audit events are saved to the store by writeAuditEvents, not by the goroutine of the client(readPump).
+	auditQueue      = make(chan auditWrite, auditQueueSize)
+	auditWriterOnce sync.Once
+	auditWG         sync.WaitGroup
+)
+
+// Read-only actions which are not audited, the front-ends send them often.
+var unauditedActions = map[string]bool{
+	"get_prizes":  true,
+	"get_winners": true,
+}
+
+// auditWrite is the audit event to save to the store it's recorded with.
+type auditWrite struct {
+	st store.Store
+	e  AuditEvent
+}
+
+// AuditEvent records an action received from a client.
+type AuditEvent = store.AuditEvent
+
+// HistoryEntry records a finished draw: committed("stop"), aborted("abort") or failed.
+type HistoryEntry struct {
+	Time             time.Time     `json:"time"`
+	RequestID        string        `json:"request_id"`
+	Action           string        `json:"action"`
+	PrizeID          string        `json:"prize_id"`
+	PrizeIndex       int           `json:"prize_index"`
+	PrizeName        string        `json:"prize_name"`
+	OldWinnerIndexes []int         `json:"old_winner_indexes"`
+	Winners          []Participant `json:"winners"`
+	Success          bool          `json:"success"`
+	ErrMsg           string        `json:"err_msg"`
+}
+
+// recordAudit records the action of the client. c is nil for actions triggered by the server, e.g. scheduled draws.
+// Draws and admin actions are recorded, read-only actions like get_winners are not.
+func recordAudit(c *Client, a Action, errMsg string) {
+	if unauditedActions[a.Name] {
+		return
+	}
+
+	e := AuditEvent{
+		Time:       time.Now(),
+		ClientID:   "server",
+		RequestID:  a.RequestID,
+		Action:     a.Name,
+		PrizeID:    a.PrizeID,
+		PrizeIndex: a.PrizeIndex,
+		Success:    errMsg == "",
+		ErrMsg:     errMsg,
+	}
+
+	if c != nil {
+		e.ClientID = c.id
+		e.RemoteAddr = c.remoteAddr
+	}
+
+	auditMu.Lock()
+	auditEvents = append(auditEvents, e)
+	if len(auditEvents) > maxAuditEvents {
+		auditEvents = auditEvents[len(auditEvents)-maxAuditEvents:]
+	}
+	auditMu.Unlock()
+
+	queueAuditEvent(e)
+}
+
+// queueAuditEvent queues the audit event to be saved to the store.
+// The event is dropped(but kept in memory) if the queue is full, e.g. the store is stuck.
+func queueAuditEvent(e AuditEvent) {
+	auditWriterOnce.Do(func() {
+		go writeAuditEvents()
+	})
+
+	auditWG.Add(1)
+	select {
+	case auditQueue <- auditWrite{st, e}:
+	default:
+		auditWG.Done()
+		slog.Error("audit queue is full, audit event is not saved", "request_id", e.RequestID, "action", e.Action)
+	}
+}
+
+// writeAuditEvents saves queued audit events to the store in order.
+func writeAuditEvents() {
+	for w := range auditQueue {
+		saveAuditEvent(w.st, w.e)
+		auditWG.Done()
+	}
+}
+
+func getAuditEvents() []AuditEvent {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	return append([]AuditEvent{}, auditEvents...)
+}
+
+func recordHistory(a Action, winners []Participant, errMsg string) {
+	e := HistoryEntry{
+		Time:             time.Now(),
+		RequestID:        a.RequestID,
+		Action:           a.Name,
+		PrizeID:          a.PrizeID,
+		PrizeIndex:       a.PrizeIndex,
+		OldWinnerIndexes: a.OldWinnerIndexes,
+		Winners:          append([]Participant{}, winners...),
+		Success:          errMsg == "",
+		ErrMsg:           errMsg,
+	}
+	if prizes := currentConfig().Prizes; a.PrizeIndex >= 0 && a.PrizeIndex < len(prizes) {
+		e.PrizeName = prizes[a.PrizeIndex].Name
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	historyEntries = append(historyEntries, e)
+	if len(historyEntries) > maxHistoryEntries {
+		historyEntries = historyEntries[len(historyEntries)-maxHistoryEntries:]
+	}
+}
+
+// findHistoryEntry returns the last history entry of the draw by the request ID of its start action.
+func findHistoryEntry(requestID string) (HistoryEntry, bool) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	for i := len(historyEntries) - 1; i >= 0; i-- {
+		if historyEntries[i].RequestID == requestID {
+			return historyEntries[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+func getHistoryEntries() []HistoryEntry {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	return append([]HistoryEntry{}, historyEntries...)
+}
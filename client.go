@@ -5,9 +5,9 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -24,7 +24,8 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Admin actions carry configs and participants CSVs, they have the same limit as bodies of the HTTP API.
+	maxMessageSize = maxAPIBodySize
 )
 
 var (
@@ -35,7 +36,7 @@ var (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin:     func(*http.Request) bool { return true },
+	CheckOrigin:     checkOrigin,
 }
 
 // Client is a middleman between the websocket connection and the hub.
@@ -45,6 +46,34 @@ type Client struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// quit is closed to send a close message and close the connection.
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	// ID is used to correlate logs of the client.
+	id         string
+	remoteAddr string
+	logger     *slog.Logger
+
+	// display is true for display clients, they only receive display states.
+	display bool
+}
+
+// actionLogger returns the logger with the request ID and name of the action.
+// c may be nil for actions triggered by the server, e.g. scheduled draws.
+func (c *Client) actionLogger(a Action) *slog.Logger {
+	if c == nil {
+		return slog.With("request_id", a.RequestID, "action", a.Name)
+	}
+	return c.logger.With("request_id", a.RequestID, "action", a.Name)
+}
+
+// close sends a close message to the peer and closes the connection by writePump.
+func (c *Client) close() {
+	c.quitOnce.Do(func() {
+		close(c.quit)
+	})
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -54,6 +83,9 @@ type Client struct {
 // reads from this goroutine.
 func (c *Client) readPump() {
 	defer func() {
+		hub.unregister(c)
+		connectedClients.Dec()
+		c.logger.Info("client disconnected")
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -63,11 +95,14 @@ func (c *Client) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				c.logger.Warn("read message error", "err", err)
 			}
 			break
 		}
 
+		if c.display {
+			continue
+		}
 		processAction(c, message)
 	}
 }
@@ -109,6 +144,10 @@ func (c *Client) writePump() {
 			if err := w.Close(); err != nil {
 				return
 			}
+		case <-c.quit:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown"))
+			return
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -120,14 +159,30 @@ func (c *Client) writePump() {
 
 // serveWs handles websocket requests from the peer.
 func serveWs(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("serveWs() ...\n")
+	if !checkOrigin(r) {
+		slog.Warn("origin not allowed", "origin", r.Header.Get("Origin"), "remote_addr", r.RemoteAddr)
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		slog.Warn("upgrade error", "remote_addr", r.RemoteAddr, "err", err)
 		return
 	}
-	client := &Client{conn: conn, send: make(chan []byte, 256)}
+
+	id := newID()
+	client := &Client{
+		conn:       conn,
+		send:       make(chan []byte, 256),
+		quit:       make(chan struct{}),
+		id:         id,
+		remoteAddr: r.RemoteAddr,
+		logger:     slog.With("client_id", id),
+	}
+	hub.register(client)
+	connectedClients.Inc()
+	client.logger.Info("client connected", "remote_addr", r.RemoteAddr)
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Timeout of HTTP requests of "ctl". Stop waits for the winners to be committed.
+const ctlTimeout = 30 * time.Second
+
+const ctlUsage = `usage: %v ctl [flags] <command> [args]
+
+Commands:
+  prizes                                   list prizes
+  winners <prize_id>                       list winners of the prize with their indexes
+  draw [-duration d] [-relottery i,j] <prize_id>
+                                           start the draw, show rolling names and stop it
+                                           after the duration or when Enter is pressed
+  start [-relottery i,j] <prize_id>        start the draw without watching it
+  stop                                     stop the running draw and list the committed winners
+  abort                                    abort the running draw without committing the winners
+
+Flags:
+`
+
+// ctlClient is the operator client of the "ctl" sub command, a backup of the browser UI.
+// Draws are watched over /ws like the browser UI, other commands use the HTTP API.
+type ctlClient struct {
+	server *url.URL
+	token  string
+	json   bool
+	out    io.Writer
+	// Rolling names are written to status, so that out only has the results.
+	status io.Writer
+
+	httpClient *http.Client
+	dialer     *websocket.Dialer
+}
+
+// runCtlCommand runs "ctl" sub commands and returns the exit code.
+func runCtlCommand(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	server := fs.String("server", envOr("SERVER", "http://localhost:8080"), fmt.Sprintf("URL of the server. env: %vSERVER", envPrefix))
+	token := fs.String("token", os.Getenv(envPrefix+"ADMIN_TOKEN"), fmt.Sprintf("admin token. env: %vADMIN_TOKEN", envPrefix))
+	jsonOutput := fs.Bool("json", false, "write responses as JSON")
+	insecure := fs.Bool("insecure", false, "skip verifying the certificate of the server, e.g. self-signed certificates")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), ctlUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	u, err := url.Parse(*server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fmt.Fprintf(os.Stderr, "invalid server URL: %v\n", *server)
+		return 2
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: *insecure}
+	c := &ctlClient{
+		server: u,
+		token:  *token,
+		json:   *jsonOutput,
+		out:    os.Stdout,
+		status: os.Stderr,
+		httpClient: &http.Client{
+			Timeout:   ctlTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		dialer: &websocket.Dialer{HandshakeTimeout: 10 * time.Second, TLSClientConfig: tlsConfig},
+	}
+
+	if err = c.run(fs.Arg(0), fs.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if _, ok := err.(ctlUsageError); ok {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// envOr returns the environment variable with envPrefix, or def if it's empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(envPrefix + key); v != "" {
+		return v
+	}
+	return def
+}
+
+// ctlUsageError is returned for invalid arguments of commands.
+type ctlUsageError string
+
+func (e ctlUsageError) Error() string {
+	return string(e)
+}
+
+func (c *ctlClient) run(cmd string, args []string) error {
+	switch cmd {
+	case "prizes":
+		return c.prizes()
+
+	case "winners":
+		if len(args) != 1 {
+			return ctlUsageError("usage: ctl winners <prize_id>")
+		}
+		return c.winners(args[0])
+
+	case "draw", "start":
+		fs := flag.NewFlagSet("ctl "+cmd, flag.ContinueOnError)
+		relottery := fs.String("relottery", "", "indexes of winners to re-lottery, e.g. 0,2(see ctl winners)")
+		duration := new(time.Duration)
+		if cmd == "draw" {
+			duration = fs.Duration("duration", 0, "stop the draw after the duration, 0 to stop it when Enter is pressed")
+		}
+		if err := fs.Parse(args); err != nil {
+			return ctlUsageError(err.Error())
+		}
+		if fs.NArg() != 1 {
+			return ctlUsageError(fmt.Sprintf("usage: ctl %v [flags] <prize_id>", cmd))
+		}
+
+		indexes, err := parseIndexes(*relottery)
+		if err != nil {
+			return ctlUsageError(fmt.Sprintf("invalid -relottery: %v", err))
+		}
+
+		a := Action{Name: "start", PrizeID: fs.Arg(0), OldWinnerIndexes: indexes}
+		if cmd == "start" {
+			return c.start(a)
+		}
+		return c.draw(a, *duration)
+
+	case "stop":
+		return c.stop()
+
+	case "abort":
+		return c.abort()
+	}
+	return ctlUsageError(fmt.Sprintf("unknown command: %v", cmd))
+}
+
+// parseIndexes parses comma separated indexes, e.g. "0,2".
+func parseIndexes(s string) ([]int, error) {
+	indexes := []int{}
+	if s == "" {
+		return indexes, nil
+	}
+
+	for _, f := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid index: %v", f)
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
+
+// call sends the request to the HTTP API and decodes the response to res.
+// It returns the error message of the response if the action failed.
+func (c *ctlClient) call(method, path string, query url.Values, body interface{}, res interface{}) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(buf)
+	}
+
+	u := c.server.ResolveReference(&url.URL{Path: path, RawQuery: query.Encode()})
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var common CommonResponse
+	if err = json.Unmarshal(buf, &common); err != nil {
+		return nil, fmt.Errorf("%v %v: %v", method, u.Path, resp.Status)
+	}
+	if err = json.Unmarshal(buf, res); err != nil {
+		return nil, err
+	}
+	if !common.Success {
+		return buf, fmt.Errorf("%v error: %v", common.Name, common.ErrMsg)
+	}
+	return buf, nil
+}
+
+// printJSON writes the raw response with -json.
+func (c *ctlClient) printJSON(buf []byte) {
+	fmt.Fprintf(c.out, "%s\n", bytes.TrimSpace(buf))
+}
+
+func (c *ctlClient) prizes() error {
+	var res PrizesResponse
+	buf, err := c.call("GET", "/api/prizes", nil, nil, &res)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		c.printJSON(buf)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIER\tNAME\tNUM\tPOLICY")
+	for _, p := range res.Prizes {
+		policy := p.Policy
+		if policy == "" {
+			policy = "exclusive"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", p.ID, p.Tier, p.Name, p.Num, policy)
+	}
+	return w.Flush()
+}
+
+func (c *ctlClient) winners(prizeID string) error {
+	var res WinnersResponse
+	buf, err := c.call("GET", "/api/winners", url.Values{"prize_id": {prizeID}}, nil, &res)
+	if err != nil {
+		return err
+	}
+	c.printWinners(buf, res)
+	return nil
+}
+
+// printWinners writes winners with their indexes, which are used by -relottery.
+func (c *ctlClient) printWinners(buf []byte, res WinnersResponse) {
+	if c.json {
+		c.printJSON(buf)
+		return
+	}
+
+	fmt.Fprintf(c.out, "%v: %v winners\n", res.PrizeID, len(res.Winners))
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tID\tNAME")
+	for i, p := range res.Winners {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", i, p.ID, p.Name)
+	}
+	w.Flush()
+}
+
+func (c *ctlClient) start(a Action) error {
+	var res CommonResponse
+	buf, err := c.call("POST", "/api/draws/start", nil, a, &res)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		c.printJSON(buf)
+		return nil
+	}
+	fmt.Fprintf(c.out, "%v: started, request_id: %v\n", res.PrizeID, res.RequestID)
+	return nil
+}
+
+func (c *ctlClient) stop() error {
+	var res WinnersResponse
+	buf, err := c.call("POST", "/api/draws/stop", nil, Action{}, &res)
+	if err != nil {
+		return err
+	}
+	c.printWinners(buf, res)
+	return nil
+}
+
+func (c *ctlClient) abort() error {
+	var res WinnersResponse
+	buf, err := c.call("POST", "/api/draws/abort", nil, Action{}, &res)
+	// The result of an aborted draw is not successful.
+	if err != nil && res.ErrMsg != errDrawAborted.Error() {
+		return err
+	}
+	if c.json {
+		c.printJSON(buf)
+		return nil
+	}
+	fmt.Fprintf(c.out, "%v: aborted, winners are not changed\n", res.PrizeID)
+	return nil
+}
+
+// wsURL returns the URL of /ws of the server.
+func (c *ctlClient) wsURL() string {
+	u := c.server.ResolveReference(&url.URL{Path: "/ws"})
+	u.Scheme = "ws"
+	if c.server.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	return u.String()
+}
+
+// ctlMessage is a response received from /ws.
+type ctlMessage struct {
+	buf []byte
+	res WinnersResponse
+}
+
+// readMessages reads responses from the connection until it's closed.
+// Queued responses are sent in one message separated by newlines, see writePump.
+func readMessages(conn *websocket.Conn, ch chan<- ctlMessage, errc chan<- error) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		for _, buf := range bytes.Split(message, newline) {
+			var res WinnersResponse
+			if err = json.Unmarshal(buf, &res); err != nil {
+				continue
+			}
+			ch <- ctlMessage{buf, res}
+		}
+	}
+}
+
+// draw starts the draw over /ws and shows rolling names until the draw is stopped
+// after the duration, by Enter, or by other clients(e.g. the browser UI).
+// Interrupts stop the draw too, so that it's never left running.
+func (c *ctlClient) draw(a Action, duration time.Duration) error {
+	conn, _, err := c.dialer.Dial(c.wsURL(), nil)
+	if err != nil {
+		return fmt.Errorf("dial %v error: %v", c.wsURL(), err)
+	}
+	defer conn.Close()
+
+	msgs := make(chan ctlMessage, 256)
+	errc := make(chan error, 1)
+	go readMessages(conn, msgs, errc)
+
+	a.RequestID, a.Token = newID(), c.token
+	if err = conn.WriteJSON(a); err != nil {
+		return err
+	}
+
+	// Stop triggers.
+	stopc := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case stopc <- struct{}{}:
+		default:
+		}
+	}
+	if duration > 0 {
+		t := time.AfterFunc(duration, trigger)
+		defer t.Stop()
+	} else {
+		fmt.Fprintln(c.status, "press Enter to stop")
+		go func() {
+			if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err == nil {
+				trigger()
+			}
+		}()
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	interrupted := ctx.Done()
+
+	stopID := ""
+	for {
+		select {
+		case <-stopc:
+		case <-interrupted:
+			interrupted = nil
+		case err = <-errc:
+			return fmt.Errorf("connection closed: %v", err)
+
+		case m := <-msgs:
+			if m.res.RequestID != a.RequestID && m.res.RequestID != stopID {
+				// Broadcast messages, e.g. state changes.
+				continue
+			}
+
+			switch {
+			case !m.res.Success:
+				fmt.Fprintln(c.status)
+				if c.json {
+					c.printJSON(m.buf)
+				}
+				return fmt.Errorf("%v error: %v", m.res.Name, m.res.ErrMsg)
+
+			case m.res.Name == "start":
+				// Rolling names of the round.
+				names := make([]string, len(m.res.Winners))
+				for i, p := range m.res.Winners {
+					names[i] = p.Name
+				}
+				fmt.Fprintf(c.status, "\r\033[K%v", strings.Join(names, "  "))
+
+			default:
+				// The draw is stopped and the winners are committed.
+				fmt.Fprintln(c.status)
+				c.printWinners(m.buf, m.res)
+				return nil
+			}
+			continue
+		}
+
+		if stopID == "" {
+			stopID = newID()
+			if err = conn.WriteJSON(Action{Name: "stop", PrizeID: a.PrizeID, RequestID: stopID, Token: c.token}); err != nil {
+				return err
+			}
+		}
+	}
+}
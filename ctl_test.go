@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// runTestCtl runs "ctl" with the args and returns the exit code and the output written to stdout.
+func runTestCtl(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	defer stderr.Close()
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	code := runCtlCommand(args)
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+
+	buf, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	return code, string(buf)
+}
+
+// parseCtlJSON parses the output of -json, which is one response per line.
+func parseCtlJSON(t *testing.T, out string) testResponse {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("output = %q, want 1 line of JSON", out)
+	}
+	var res testResponse
+	if err := json.Unmarshal([]byte(lines[0]), &res); err != nil {
+		t.Fatalf("Unmarshal(%s) error: %v", lines[0], err)
+	}
+	return res
+}
+
+func TestCtlExitCodes(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"no command", []string{"-server", srv.URL}, 2},
+		{"unknown flag", []string{"-server", srv.URL, "-unknown", "prizes"}, 2},
+		{"invalid server", []string{"-server", "ftp://localhost", "prizes"}, 2},
+		{"unknown command", []string{"-server", srv.URL, "unknown"}, 2},
+		{"winners without prize", []string{"-server", srv.URL, "winners"}, 2},
+		{"invalid relottery", []string{"-server", srv.URL, "-token", "secret", "start", "-relottery", "a", "3rd"}, 2},
+		{"prizes", []string{"-server", srv.URL, "prizes"}, 0},
+		{"winners", []string{"-server", srv.URL, "winners", "3rd"}, 0},
+		{"invalid token", []string{"-server", srv.URL, "-token", "wrong", "start", "3rd"}, 1},
+		{"unknown prize", []string{"-server", srv.URL, "-token", "secret", "start", "4th"}, 1},
+		{"stop without draw", []string{"-server", srv.URL, "-token", "secret", "stop"}, 1},
+		{"abort without draw", []string{"-server", srv.URL, "-token", "secret", "abort"}, 1},
+		{"server down", []string{"-server", "http://127.0.0.1:1", "prizes"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, out := runTestCtl(t, tt.args...); code != tt.code {
+				t.Errorf("ctl %v = %v(%q), want %v", strings.Join(tt.args, " "), code, out, tt.code)
+			}
+		})
+	}
+
+	// The token is read from the environment variable if -token is not set.
+	t.Setenv(envPrefix+"ADMIN_TOKEN", "secret")
+	if code, out := runTestCtl(t, "-server", srv.URL, "start", "3rd"); code != 0 {
+		t.Fatalf("ctl start with %vADMIN_TOKEN = %v(%q), want 0", envPrefix, code, out)
+	}
+	if code, out := runTestCtl(t, "-server", srv.URL, "stop"); code != 0 {
+		t.Fatalf("ctl stop = %v(%q), want 0", code, out)
+	}
+}
+
+func TestCtlJSON(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+
+	code, out := runTestCtl(t, "-server", srv.URL, "-json", "prizes")
+	if res := parseCtlJSON(t, out); code != 0 || !res.Success || len(res.Prizes) != 3 || res.Prizes[0].ID != "3rd" {
+		t.Fatalf("ctl -json prizes = %v, %+v, want 3 prizes", code, res)
+	}
+
+	code, out = runTestCtl(t, "-server", srv.URL, "-json", "start", "3rd")
+	if res := parseCtlJSON(t, out); code != 0 || !res.Success || res.Name != "start" || res.PrizeID != "3rd" || res.RequestID == "" {
+		t.Fatalf("ctl -json start = %v, %+v, want the started draw", code, res)
+	}
+
+	code, out = runTestCtl(t, "-server", srv.URL, "-json", "stop")
+	stopped := parseCtlJSON(t, out)
+	if code != 0 || !stopped.Success || stopped.Name != "stop" || len(stopped.Winners) != 3 || !distinct(stopped.Winners) {
+		t.Fatalf("ctl -json stop = %v, %+v, want 3 distinct winners", code, stopped)
+	}
+
+	code, out = runTestCtl(t, "-server", srv.URL, "-json", "winners", "3rd")
+	if res := parseCtlJSON(t, out); code != 0 || strings.Join(testIDs(res.Winners), ",") != strings.Join(testIDs(stopped.Winners), ",") {
+		t.Errorf("ctl -json winners = %v, %v, want %v", code, testIDs(res.Winners), testIDs(stopped.Winners))
+	}
+
+	// The result of an aborted draw is not successful, but ctl abort succeeds.
+	if code, out = runTestCtl(t, "-server", srv.URL, "start", "2nd"); code != 0 {
+		t.Fatalf("ctl start = %v(%q), want 0", code, out)
+	}
+	code, out = runTestCtl(t, "-server", srv.URL, "-json", "abort")
+	if res := parseCtlJSON(t, out); code != 0 || res.Success || res.Name != "abort" || res.ErrMsg != errDrawAborted.Error() {
+		t.Fatalf("ctl -json abort = %v, %+v, want the aborted draw", code, res)
+	}
+	if w := lot.Winners("2nd"); len(w) != 0 {
+		t.Errorf("winners after abort = %v, want none", testIDs(w))
+	}
+
+	// Failed responses are not written to stdout.
+	if code, out = runTestCtl(t, "-server", srv.URL, "-json", "stop"); code != 1 || out != "" {
+		t.Errorf("ctl -json stop without draw = %v(%q), want 1 without output", code, out)
+	}
+}
+
+func TestCtlDraw(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("url.Parse() error: %v", err)
+	}
+
+	var out strings.Builder
+	c := &ctlClient{server: u, json: true, out: &out, status: io.Discard, httpClient: srv.Client(), dialer: websocket.DefaultDialer}
+
+	if err = c.draw(Action{Name: "start", PrizeID: "2nd", OldWinnerIndexes: []int{}}, 100*time.Millisecond); err != nil {
+		t.Fatalf("draw() error: %v", err)
+	}
+	res := parseCtlJSON(t, out.String())
+	if !res.Success || res.Name != "stop" || len(res.Winners) != 2 || !distinct(res.Winners) {
+		t.Fatalf("draw() output = %+v, want 2 distinct winners", res)
+	}
+
+	if w := lot.Winners("2nd"); strings.Join(testIDs(w), ",") != strings.Join(testIDs(res.Winners), ",") {
+		t.Errorf("committed winners = %v, want %v", testIDs(w), testIDs(res.Winners))
+	}
+
+	// Draws of prizes which have enough winners fail.
+	out.Reset()
+	if err = c.draw(Action{Name: "start", PrizeID: "2nd", OldWinnerIndexes: []int{}}, 100*time.Millisecond); err == nil {
+		t.Fatalf("draw() of the drawn prize, want error")
+	}
+	if res = parseCtlJSON(t, out.String()); res.Success || res.ErrMsg == "" {
+		t.Errorf("draw() output = %+v, want the failed response", res)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Status of the display.
+const (
+	displayIdle      = "idle"
+	displayCountdown = "countdown"
+	displayRolling   = "rolling"
+	displayCommitted = "committed"
+	displayAborted   = "aborted"
+)
+
+var (
+	displayMu    sync.Mutex
+	displayState = DisplayState{Status: displayIdle}
+)
+
+// DisplayState is streamed to display clients(projector screens) connected to /display/ws.
+type DisplayState struct {
+	Status     string `json:"status"`
+	PrizeID    string `json:"prize_id"`
+	PrizeIndex int    `json:"prize_index"`
+	Prize      *Prize `json:"prize"`
+	// Theme is the theme of the prize merged with the default theme.
+	Theme Theme `json:"theme"`
+	// Rolling names, or winners when the draw is committed or the display is idle.
+	Names []Participant `json:"names"`
+	// Seconds left before the scheduled draw starts when the status is countdown.
+	Countdown int `json:"countdown,omitempty"`
+}
+
+type DisplayResponse struct {
+	CommonResponse
+	Display DisplayState `json:"display"`
+}
+
+// resolveTheme returns the theme of the prize merged with the default theme of the config.
+func resolveTheme(config Config, prizeIndex int) Theme {
+	t := Theme{}
+	if config.Theme != nil {
+		t = *config.Theme
+	}
+
+	if prizeIndex < 0 || prizeIndex >= len(config.Prizes) || config.Prizes[prizeIndex].Theme == nil {
+		return t
+	}
+
+	p := config.Prizes[prizeIndex].Theme
+	if p.Background != "" {
+		t.Background = p.Background
+	}
+	if p.Foreground != "" {
+		t.Foreground = p.Foreground
+	}
+	if p.Accent != "" {
+		t.Accent = p.Accent
+	}
+	if p.BackgroundImage != "" {
+		t.BackgroundImage = p.BackgroundImage
+	}
+	return t
+}
+
+func newDisplayResponse(s DisplayState) DisplayResponse {
+	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: Action{Name: "display", PrizeID: s.PrizeID, PrizeIndex: s.PrizeIndex}}
+	return DisplayResponse{commonRes, s}
+}
+
+// newDisplayState returns the display state of the prize with the current config.
+func newDisplayState(status string, prizeID string, names []Participant) DisplayState {
+	config := currentConfig()
+	prizeIndex := lottery.PrizeIndex(config.Prizes, prizeID)
+	s := DisplayState{
+		Status:     status,
+		PrizeID:    prizeID,
+		PrizeIndex: prizeIndex,
+		Theme:      resolveTheme(config, prizeIndex),
+		Names:      append([]Participant{}, names...),
+	}
+	if prizeIndex >= 0 {
+		p := config.Prizes[prizeIndex]
+		s.Prize = &p
+	}
+	return s
+}
+
+// setDisplay updates the display state and broadcasts it to all display clients.
+func setDisplay(status string, prizeID string, names []Participant) {
+	displayMu.Lock()
+	defer displayMu.Unlock()
+
+	displayState = newDisplayState(status, prizeID, names)
+	hub.broadcastDisplay(newDisplayResponse(displayState))
+}
+
+// setDisplayCountdown shows the countdown of the scheduled draw of the prize.
+func setDisplayCountdown(prizeID string, seconds int) {
+	displayMu.Lock()
+	defer displayMu.Unlock()
+
+	displayState = newDisplayState(displayCountdown, prizeID, lot.Winners(prizeID))
+	displayState.Countdown = seconds
+	hub.broadcastDisplay(newDisplayResponse(displayState))
+}
+
+// refreshDisplay re-sends the display state with the current config, e.g. after config is reloaded.
+func refreshDisplay() {
+	displayMu.Lock()
+	s := displayState
+	displayMu.Unlock()
+
+	switch s.Status {
+	case displayRolling:
+		return
+	case displayCountdown:
+		setDisplayCountdown(s.PrizeID, s.Countdown)
+	default:
+		setDisplay(s.Status, s.PrizeID, s.Names)
+	}
+}
+
+// displayDrawResult shows the result of the draw on the display.
+func displayDrawResult(a Action, winners []Participant, errMsg string) {
+	switch {
+	case a.Name == "abort":
+		setDisplay(displayAborted, a.PrizeID, nil)
+	case errMsg == "":
+		setDisplay(displayCommitted, a.PrizeID, winners)
+	default:
+		setDisplay(displayIdle, a.PrizeID, lot.Winners(a.PrizeID))
+	}
+}
+
+// displayPrize shows the prize and its winners on the display before the draw is started.
+// Like draws, it requires the admin token if admin_token is set.
+func displayPrize(c *Client, a Action, token string) error {
+	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: a}
+
+	// No draw can be started until the display is updated.
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	var err error
+	switch {
+	case !checkAdminToken(token):
+		err = fmt.Errorf("invalid admin token")
+	case a.PrizeIndex < 0 || a.PrizeIndex >= len(currentConfig().Prizes):
+		err = fmt.Errorf("unknown prize")
+	case cancel != nil:
+		err = errDrawRunning
+	}
+
+	if err != nil {
+		commonRes.Success = false
+		commonRes.ErrMsg = err.Error()
+		sendResponse(c, commonRes)
+		return err
+	}
+
+	setDisplay(displayIdle, a.PrizeID, lot.Winners(a.PrizeID))
+	return sendResponse(c, commonRes)
+}
+
+// serveDisplayWs handles websocket requests from display clients.
+// Display clients are read-only: messages from them are ignored.
+func serveDisplayWs(w http.ResponseWriter, r *http.Request) {
+	if !checkOrigin(r) {
+		slog.Warn("origin not allowed", "origin", r.Header.Get("Origin"), "remote_addr", r.RemoteAddr)
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("upgrade error", "remote_addr", r.RemoteAddr, "err", err)
+		return
+	}
+
+	id := newID()
+	client := &Client{
+		conn:       conn,
+		send:       make(chan []byte, 256),
+		quit:       make(chan struct{}),
+		id:         id,
+		remoteAddr: r.RemoteAddr,
+		logger:     slog.With("client_id", id),
+		display:    true,
+	}
+	hub.register(client)
+	connectedClients.Inc()
+	client.logger.Info("display connected", "remote_addr", r.RemoteAddr)
+
+	displayMu.Lock()
+	sendResponse(client, newDisplayResponse(displayState))
+	displayMu.Unlock()
+
+	go client.writePump()
+	go client.readPump()
+}
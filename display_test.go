@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDisplayStatesOnly(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+	d := dialTestPath(t, srv, "/display/ws")
+
+	if res := d.next(); res.Name != "display" || res.Display.Status != displayIdle {
+		t.Fatalf("first message = %+v, want the idle display state", res)
+	}
+
+	// Rounds of draws started by the API are broadcast to clients, but not to displays.
+	if status, res := postAPI(t, srv.URL+"/api/draws/start", "", `{"prize_id":"3rd","request_id":"api-1"}`); status != http.StatusOK {
+		t.Fatalf("start = %v %+v, want 200", status, res)
+	}
+	for i := 0; i < 3; i++ {
+		c.waitFor("api-1", "start")
+	}
+	if status, res := postAPI(t, srv.URL+"/api/draws/stop", "", ``); status != http.StatusOK {
+		t.Fatalf("stop = %v %+v, want 200", status, res)
+	}
+
+	rolling := 0
+	for {
+		res := d.next()
+		if res.Name != "display" {
+			t.Fatalf("display client got %+v, want display states only", res)
+		}
+		if res.Display.Status == displayRolling {
+			rolling++
+		}
+		if res.Display.Status == displayCommitted {
+			if rolling == 0 || len(res.Display.Names) != 3 {
+				t.Errorf("display = %v rolling states, then %+v, want rolling names and 3 winners", rolling, res.Display)
+			}
+			return
+		}
+	}
+}
+
+func TestDisplayPrizeDrawRunning(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd"})
+	c.waitFor(id, "start")
+	if res := c.do(Action{Name: "display_prize", PrizeID: "2nd"}); res.Success || res.ErrMsg != errDrawRunning.Error() {
+		t.Errorf("display_prize while a draw is running = %+v, want %q", res, errDrawRunning)
+	}
+
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	c.waitFor(id, "stop")
+	if res := c.do(Action{Name: "display_prize", PrizeID: "2nd"}); !res.Success {
+		t.Errorf("display_prize = %+v", res)
+	}
+}
+
+func TestDisplayPrizeAdminToken(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	c := dialTestClient(t, srv)
+
+	for _, token := range []string{"", "wrong"} {
+		if res := c.do(Action{Name: "display_prize", PrizeID: "2nd", Token: token}); res.Success || res.ErrMsg != "invalid admin token" {
+			t.Errorf("display_prize with token %q = %+v, want invalid admin token", token, res)
+		}
+	}
+	displayMu.Lock()
+	s := displayState
+	displayMu.Unlock()
+	if s.PrizeID == "2nd" {
+		t.Errorf("display state = %+v, want the prize not displayed", s)
+	}
+
+	if res := c.do(Action{Name: "display_prize", PrizeID: "2nd", Token: "secret"}); !res.Success {
+		t.Errorf("display_prize with token = %+v", res)
+	}
+}
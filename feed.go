@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Size of the buffer of feed subscribers.
+	feedBufferSize = 256
+	// Number of the last events kept to replay for reconnecting subscribers, e.g. Last-Event-ID of SSE.
+	// Rounds and countdowns are not kept, see replayable.
+	feedReplaySize = 1000
+)
+
+// feedEvent is an event of the feed. Data is the JSON of the response, the same as the message sent to WebSocket clients.
+// Name is the name of the action of the response, e.g. "start"(rounds), "stop", "abort", "state_changed" or "countdown".
+type feedEvent struct {
+	ID   string
+	Name string
+	Data []byte
+
+	seq uint64
+}
+
+// replayable returns true if events of the name are kept to replay.
+// Rounds of draws and countdowns are sent every 100 ms or every second and outdated by the next one.
+// Keeping them would push results of draws and state changes out of the replay buffer during a long draw.
+func replayable(name string) bool {
+	return name != "start" && name != "countdown"
+}
+
+// feed publishes events to subscribers, e.g. WatchDraw of the gRPC API and the SSE stream.
+// Like sendResponse, events are dropped for slow subscribers, so that a running draw never blocks.
+type feed struct {
+	mu     sync.Mutex
+	subs   map[chan feedEvent]bool
+	closed bool
+
+	// IDs of events are "<boot>-<seq>". boot is generated on start,
+	// so that IDs of events before a restart are not mistaken for new events.
+	boot   string
+	seq    uint64
+	replay []feedEvent
+}
+
+// eventFeed publishes rounds and results of draws, state changes and countdowns.
+var eventFeed = newFeed()
+
+func newFeed() *feed {
+	return &feed{subs: map[chan feedEvent]bool{}, boot: newID()}
+}
+
+// subscribe returns the channel of events. The channel is closed when the feed is closed.
+// If lastID is not empty, events after it are replayed first.
+// All kept events are replayed if lastID is unknown, e.g. the server restarted.
+func (f *feed) subscribe(lastID string) chan feedEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan feedEvent, feedBufferSize+feedReplaySize)
+	if f.closed {
+		close(ch)
+		return ch
+	}
+
+	if lastID != "" {
+		for _, e := range f.eventsAfter(lastID) {
+			ch <- e
+		}
+	}
+	f.subs[ch] = true
+	return ch
+}
+
+// eventsAfter returns kept events after the event of lastID. The caller should hold f.mu.
+// lastID may be the ID of an event which is not kept, e.g. a round of a draw.
+func (f *feed) eventsAfter(lastID string) []feedEvent {
+	boot, s, ok := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(s, 10, 64)
+	if !ok || err != nil || boot != f.boot || seq > f.seq {
+		return f.replay
+	}
+
+	i := sort.Search(len(f.replay), func(i int) bool { return f.replay[i].seq > seq })
+	return f.replay[i:]
+}
+
+func (f *feed) unsubscribe(ch chan feedEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.subs[ch] {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// publish publishes the response as the event of the action name.
+func (f *feed) publish(name string, res interface{}) {
+	buf, err := json.Marshal(res)
+	if err != nil {
+		slog.Error("feed publish error", "err", err)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	e := feedEvent{ID: fmt.Sprintf("%v-%v", f.boot, f.seq), Name: name, Data: buf, seq: f.seq}
+
+	if replayable(name) {
+		f.replay = append(f.replay, e)
+		if len(f.replay) > feedReplaySize {
+			f.replay = f.replay[len(f.replay)-feedReplaySize:]
+		}
+	}
+
+	for ch := range f.subs {
+		select {
+		case ch <- e:
+		default:
+			droppedMessages.Inc()
+		}
+	}
+}
+
+// close closes the channels of all subscribers, e.g. on shutdown.
+func (f *feed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		close(ch)
+	}
+	f.subs = map[chan feedEvent]bool{}
+	f.closed = true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// events returns names of the events.
+func eventNames(events []feedEvent) []string {
+	names := []string{}
+	for _, e := range events {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestFeedReplay(t *testing.T) {
+	f := newFeed()
+
+	f.publish("stop", nil)
+	// A long draw.
+	for i := 0; i < feedReplaySize*2; i++ {
+		f.publish("start", nil)
+	}
+	f.publish("countdown", nil)
+	f.publish("state_changed", nil)
+
+	// Rounds and countdowns do not push results out of the replay buffer.
+	if names := eventNames(f.replay); fmt.Sprint(names) != "[stop state_changed]" {
+		t.Fatalf("replay = %v, want [stop state_changed]", names)
+	}
+
+	first := f.replay[0].ID
+	tests := []struct {
+		name   string
+		lastID string
+		want   string
+	}{
+		{"after the result", first, "[state_changed]"},
+		{"after a round", fmt.Sprintf("%v-%v", f.boot, 10), "[state_changed]"},
+		{"before all", fmt.Sprintf("%v-%v", f.boot, 0), "[stop state_changed]"},
+		{"latest", fmt.Sprintf("%v-%v", f.boot, f.seq), "[]"},
+		{"restarted", "other-1", "[stop state_changed]"},
+		{"future", fmt.Sprintf("%v-%v", f.boot, f.seq+1), "[stop state_changed]"},
+		{"invalid", "x", "[stop state_changed]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(eventNames(f.eventsAfter(tt.lastID))); got != tt.want {
+			t.Errorf("%v: eventsAfter(%v) = %v, want %v", tt.name, tt.lastID, got, tt.want)
+		}
+	}
+}
+
+func TestFeedReplaySize(t *testing.T) {
+	f := newFeed()
+	for i := 0; i < feedReplaySize+10; i++ {
+		f.publish("stop", i)
+	}
+
+	if len(f.replay) != feedReplaySize || string(f.replay[0].Data) != "10" {
+		t.Errorf("replay = %v events from %s, want the last %v events", len(f.replay), f.replay[0].Data, feedReplaySize)
+	}
+}
+
+func TestFeedSubscribe(t *testing.T) {
+	f := newFeed()
+	f.publish("stop", 1)
+	f.publish("start", 2)
+
+	ch := f.subscribe(f.replay[0].ID)
+	f.publish("start", 3)
+	if e := <-ch; e.Name != "start" || string(e.Data) != "3" {
+		t.Errorf("event = %v %s, want new events only", e.Name, e.Data)
+	}
+
+	f.unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Errorf("channel is not closed after unsubscribe")
+	}
+
+	ch = f.subscribe("")
+	f.close()
+	if _, ok := <-ch; ok {
+		t.Errorf("channel is not closed after close")
+	}
+	if _, ok := <-f.subscribe(""); ok {
+		t.Errorf("channel of a closed feed is not closed")
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Full name of the gRPC service, see proto/lottery.proto.
+const grpcServiceName = "lottery.v1.Lottery"
+
+// The gRPC API is defined by proto/lottery.proto. The file is embedded and compiled on start(grpcFile)
+// and messages are dynamic, so no generated code is required and the .proto file is the only definition.
+//
+// Messages are converted from and to responses of actions by JSON: fields of messages have the same names as JSON fields.
+//
+//go:embed proto/lottery.proto
+var grpcProto string
+
+var grpcFile protoreflect.FileDescriptor
+
+var grpcServer *grpc.Server
+
+func init() {
+	var err error
+	if grpcFile, err = compileGRPCFile(grpcProto); err != nil {
+		panic(fmt.Sprintf("compile proto/lottery.proto error: %v", err))
+	}
+	// Register the file for the reflection service, e.g. grpcurl.
+	if err = protoregistry.GlobalFiles.RegisterFile(grpcFile); err != nil {
+		panic(fmt.Sprintf("register gRPC file descriptor error: %v", err))
+	}
+}
+
+// compileGRPCFile compiles the source of proto/lottery.proto and returns its descriptor.
+func compileGRPCFile(source string) (protoreflect.FileDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"lottery.proto": source}),
+		},
+	}
+
+	files, err := compiler.Compile(context.Background(), "lottery.proto")
+	if err != nil {
+		return nil, err
+	}
+	// Build a plain descriptor without source info of the compiler.
+	return protodesc.NewFile(protodesc.ToFileDescriptorProto(files[0]), protoregistry.GlobalFiles)
+}
+
+// grpcMessage returns a new message of the name.
+func grpcMessage(name string) *dynamicpb.Message {
+	return dynamicpb.NewMessage(grpcFile.Messages().ByName(protoreflect.Name(name)))
+}
+
+// fromGRPCMessage converts the request message to the action.
+func fromGRPCMessage(m proto.Message, a *Action) error {
+	buf, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, a)
+}
+
+// toGRPCMessage converts the JSON of the response to the message. Fields not in the message are ignored.
+func toGRPCMessage(buf []byte, name string) (proto.Message, error) {
+	m := grpcMessage(name)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(buf, m); err != nil {
+		return nil, status.Errorf(codes.Internal, "convert response error: %v", err)
+	}
+	return m, nil
+}
+
+// grpcToken returns the admin token in the "authorization: Bearer <token>" metadata.
+func grpcToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if l := md.Get("authorization"); len(l) > 0 {
+		return strings.TrimPrefix(l[0], "Bearer ")
+	}
+	return ""
+}
+
+// newGRPCClient returns the API client of the gRPC request.
+func newGRPCClient(ctx context.Context) *Client {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	return newAPIClient("grpc", remoteAddr)
+}
+
+// grpcAction processes the action like the HTTP API, see processAPIAction.
+func grpcAction(ctx context.Context, name string, a Action) (proto.Message, error) {
+	a.Name, a.Token = name, grpcToken(ctx)
+
+	buf, res, err := processAPIAction(newGRPCClient(ctx), a)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !res.Success {
+		return nil, grpcError(res.ErrMsg)
+	}
+	return toGRPCMessage(buf, grpcMethodName(name)+"Response")
+}
+
+// grpcMethodName returns the method name of the action, e.g. "GetWinners" for "get_winners".
+func grpcMethodName(action string) string {
+	var b strings.Builder
+	for _, s := range strings.Split(action, "_") {
+		if s != "" {
+			b.WriteString(strings.ToUpper(s[:1]) + s[1:])
+		}
+	}
+	return b.String()
+}
+
+// grpcError returns the status error of the failed action.
+func grpcError(errMsg string) error {
+	if apiStatus(errMsg) == http.StatusUnauthorized {
+		return status.Error(codes.Unauthenticated, errMsg)
+	}
+	return status.Error(codes.FailedPrecondition, errMsg)
+}
+
+// grpcDrawAction returns the start, stop or abort action of the request after checking the admin token.
+func grpcDrawAction(ctx context.Context, name string, a Action) (*Client, Action, error) {
+	c := newGRPCClient(ctx)
+
+	a.Name = name
+	if a.RequestID == "" {
+		a.RequestID = newID()
+	}
+	if !checkAdminToken(grpcToken(ctx)) {
+		recordAudit(c, a, "invalid admin token")
+		return c, a, status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+
+	resolvePrize(&a, currentConfig().Prizes)
+	return c, a, nil
+}
+
+func grpcStartDraw(ctx context.Context, a Action) (proto.Message, error) {
+	c, a, err := grpcDrawAction(ctx, "start", a)
+	if err != nil {
+		return nil, err
+	}
+
+	if errMsg := apiStartDraw(c, a); errMsg != "" {
+		return nil, grpcError(errMsg)
+	}
+
+	buf, err := json.Marshal(CommonResponse{Success: true, ErrMsg: "", Action: a})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toGRPCMessage(buf, "StartDrawResponse")
+}
+
+func grpcStopDraw(ctx context.Context, a Action) (proto.Message, error) {
+	return grpcEndDraw(ctx, "stop", a, "StopDrawResponse")
+}
+
+func grpcAbortDraw(ctx context.Context, a Action) (proto.Message, error) {
+	return grpcEndDraw(ctx, "abort", a, "AbortDrawResponse")
+}
+
+// grpcEndDraw stops or aborts the running draw and returns the result of the draw as the response message.
+func grpcEndDraw(ctx context.Context, name string, a Action, response string) (proto.Message, error) {
+	c, a, err := grpcDrawAction(ctx, name, a)
+	if err != nil {
+		return nil, err
+	}
+
+	res, errMsg := apiStopDraw(ctx, c, a)
+	if errMsg != "" {
+		return nil, grpcError(errMsg)
+	}
+
+	buf, err := json.Marshal(res)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toGRPCMessage(buf, response)
+}
+
+// grpcWatchDraw streams rounds and results of draws(of the prize if prize_id is set) until the client is gone.
+// They're the same as the responses start() sends to WebSocket clients.
+func grpcWatchDraw(a Action, stream grpc.ServerStream) error {
+	ch := eventFeed.subscribe("")
+	defer eventFeed.unsubscribe(ch)
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+
+			// Rounds("start") and results("stop" or "abort") of draws only.
+			if e.Name != "start" && e.Name != "stop" && e.Name != "abort" {
+				continue
+			}
+			if a.PrizeID != "" {
+				var res CommonResponse
+				if err := json.Unmarshal(e.Data, &res); err != nil || res.PrizeID != a.PrizeID {
+					continue
+				}
+			}
+
+			m, err := toGRPCMessage(e.Data, "DrawEvent")
+			if err != nil {
+				return err
+			}
+			if err = stream.SendMsg(m); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcUnary returns the method which converts the request to the action and calls f.
+func grpcUnary(name string, f func(ctx context.Context, a Action) (proto.Message, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := grpcMessage(name + "Request")
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				var a Action
+				if err := fromGRPCMessage(req.(proto.Message), &a); err != nil {
+					return nil, status.Error(codes.InvalidArgument, err.Error())
+				}
+				return f(ctx, a)
+			}
+
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+// grpcServiceDesc is the service descriptor which is generated by protoc-gen-go-grpc usually.
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		grpcUnary("GetPrizes", func(ctx context.Context, a Action) (proto.Message, error) {
+			return grpcAction(ctx, "get_prizes", a)
+		}),
+		grpcUnary("GetWinners", func(ctx context.Context, a Action) (proto.Message, error) {
+			return grpcAction(ctx, "get_winners", a)
+		}),
+		grpcUnary("GetParticipants", func(ctx context.Context, a Action) (proto.Message, error) {
+			return grpcAction(ctx, "get_participants", a)
+		}),
+		grpcUnary("StartDraw", grpcStartDraw),
+		grpcUnary("StopDraw", grpcStopDraw),
+		grpcUnary("AbortDraw", grpcAbortDraw),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "WatchDraw",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := grpcMessage("WatchDrawRequest")
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+
+			var a Action
+			if err := fromGRPCMessage(req, &a); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+			return grpcWatchDraw(a, stream)
+		},
+	}},
+	Metadata: "lottery.proto",
+}
+
+// startGRPCServer serves the gRPC API at the address. It serves TLS if TLS is enabled.
+func startGRPCServer(addr string) error {
+	var opts []grpc.ServerOption
+	if tlsEnabled(settings) {
+		creds, err := credentials.NewServerTLSFromFile(settings.TLSCertFile, settings.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	grpcServer = grpc.NewServer(opts...)
+	grpcServer.RegisterService(&grpcServiceDesc, struct{}{})
+	reflection.Register(grpcServer)
+
+	go func() {
+		slog.Info("listening(gRPC)", "addr", addr, "tls", tlsEnabled(settings))
+		if err := grpcServer.Serve(l); err != nil {
+			slog.Error("grpcServer.Serve() error", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// dialTestGRPC serves the gRPC service by bufconn and returns the connection to it.
+func dialTestGRPC(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	s.RegisterService(&grpcServiceDesc, struct{}{})
+	go s.Serve(l)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+	})
+	return conn
+}
+
+// grpcContext returns the context with the admin token in metadata if it's not empty.
+func grpcContext(t *testing.T, token string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	return ctx
+}
+
+// invokeGRPC calls the unary method with the JSON request and returns the response.
+func invokeGRPC(ctx context.Context, t *testing.T, conn *grpc.ClientConn, method, req string) (testResponse, error) {
+	t.Helper()
+
+	in := grpcMessage(method + "Request")
+	if err := protojson.Unmarshal([]byte(req), in); err != nil {
+		t.Fatalf("Unmarshal(%s) error: %v", req, err)
+	}
+	out := grpcMessage(string(grpcMethodOutput(method)))
+	if err := conn.Invoke(ctx, "/"+grpcServiceName+"/"+method, in, out); err != nil {
+		return testResponse{}, err
+	}
+	return grpcTestResponse(t, out), nil
+}
+
+// grpcMethodOutput returns the output message name of the method.
+func grpcMethodOutput(method string) protoreflect.Name {
+	return grpcFile.Services().Get(0).Methods().ByName(protoreflect.Name(method)).Output().Name()
+}
+
+// grpcTestResponse converts the message to the test response by JSON.
+func grpcTestResponse(t *testing.T, m proto.Message) testResponse {
+	t.Helper()
+
+	buf, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	var res testResponse
+	if err = json.Unmarshal(buf, &res); err != nil {
+		t.Fatalf("Unmarshal(%s) error: %v", buf, err)
+	}
+	return res
+}
+
+func TestGRPCFile(t *testing.T) {
+	// Every method of the service in proto/lottery.proto has a handler.
+	handlers := map[string]bool{}
+	for _, m := range grpcServiceDesc.Methods {
+		handlers[m.MethodName] = true
+	}
+	for _, s := range grpcServiceDesc.Streams {
+		handlers[s.StreamName] = true
+	}
+
+	svc := grpcFile.Services().ByName("Lottery")
+	if svc == nil || string(svc.FullName()) != grpcServiceName {
+		t.Fatalf("service %v not found in proto/lottery.proto", grpcServiceName)
+	}
+	methods := svc.Methods()
+	if methods.Len() != len(handlers) {
+		t.Errorf("methods = %v, handlers = %v", methods.Len(), len(handlers))
+	}
+	for i := 0; i < methods.Len(); i++ {
+		if name := string(methods.Get(i).Name()); !handlers[name] {
+			t.Errorf("no handler of method %v", name)
+		}
+	}
+
+	buf, err := os.ReadFile("proto/lottery.proto")
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	if string(buf) != grpcProto {
+		t.Errorf("embedded proto/lottery.proto is out of date")
+	}
+
+	if _, err = compileGRPCFile(grpcProto + "\nmessage Broken {"); err == nil {
+		t.Errorf("compileGRPCFile() of a broken file, want error")
+	}
+}
+
+func TestGRPCDraw(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	conn := dialTestGRPC(t)
+	ctx := grpcContext(t, "secret")
+
+	res, err := invokeGRPC(ctx, t, conn, "GetPrizes", `{}`)
+	if err != nil || len(res.Prizes) != 3 || res.Prizes[0].ID != "3rd" {
+		t.Fatalf("GetPrizes() = %+v, %v, want 3 prizes", res, err)
+	}
+
+	if res, err = invokeGRPC(ctx, t, conn, "StartDraw", `{"prize_id":"3rd","request_id":"grpc-1"}`); err != nil || res.RequestID != "grpc-1" {
+		t.Fatalf("StartDraw() = %+v, %v", res, err)
+	}
+	if _, err = invokeGRPC(ctx, t, conn, "StartDraw", `{"prize_id":"2nd"}`); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("second StartDraw() error = %v, want FailedPrecondition", err)
+	}
+
+	res, err = invokeGRPC(ctx, t, conn, "StopDraw", `{}`)
+	if err != nil || !res.Success || res.Name != "stop" || len(res.Winners) != 3 || !distinct(res.Winners) {
+		t.Fatalf("StopDraw() = %+v, %v, want 3 distinct winners", res, err)
+	}
+
+	winners, err := invokeGRPC(ctx, t, conn, "GetWinners", `{"prize_id":"3rd"}`)
+	if err != nil || strings.Join(testIDs(winners.Winners), ",") != strings.Join(testIDs(res.Winners), ",") {
+		t.Errorf("GetWinners() = %+v, %v, want %v", winners, err, testIDs(res.Winners))
+	}
+
+	if _, err = invokeGRPC(ctx, t, conn, "StopDraw", `{}`); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("StopDraw() without draw error = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestGRPCAbortDraw(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+	conn := dialTestGRPC(t)
+	ctx := grpcContext(t, "")
+
+	if _, err := invokeGRPC(ctx, t, conn, "StartDraw", `{"prize_id":"3rd"}`); err != nil {
+		t.Fatalf("StartDraw() error: %v", err)
+	}
+
+	res, err := invokeGRPC(ctx, t, conn, "AbortDraw", `{}`)
+	if err != nil || res.Success || res.Name != "abort" || res.ErrMsg != errDrawAborted.Error() || len(res.Winners) != 0 {
+		t.Fatalf("AbortDraw() = %+v, %v, want the aborted draw", res, err)
+	}
+	if w := lot.Winners("3rd"); len(w) != 0 {
+		t.Errorf("winners after AbortDraw() = %v, want none", testIDs(w))
+	}
+}
+
+func TestGRPCAdminToken(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	conn := dialTestGRPC(t)
+
+	for _, token := range []string{"", "wrong"} {
+		ctx := grpcContext(t, token)
+		for _, method := range []string{"GetParticipants", "StartDraw", "StopDraw", "AbortDraw"} {
+			if _, err := invokeGRPC(ctx, t, conn, method, `{}`); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("%v() with token %q error = %v, want Unauthenticated", method, token, err)
+			}
+		}
+	}
+
+	// Read-only methods do not require the token.
+	if _, err := invokeGRPC(grpcContext(t, ""), t, conn, "GetPrizes", `{}`); err != nil {
+		t.Errorf("GetPrizes() without token error: %v", err)
+	}
+
+	res, err := invokeGRPC(grpcContext(t, "secret"), t, conn, "GetParticipants", `{}`)
+	if err != nil || len(res.Participants) != 10 {
+		t.Errorf("GetParticipants() = %+v, %v, want 10 participants", res, err)
+	}
+}
+
+func TestGRPCWatchDraw(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+	conn := dialTestGRPC(t)
+	ctx := grpcContext(t, "")
+
+	stream, err := conn.NewStream(ctx, &grpcServiceDesc.Streams[0], "/"+grpcServiceName+"/WatchDraw")
+	if err != nil {
+		t.Fatalf("NewStream() error: %v", err)
+	}
+	req := grpcMessage("WatchDrawRequest")
+	if err = protojson.Unmarshal([]byte(`{"prize_id":"2nd"}`), req); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if err = stream.SendMsg(req); err != nil {
+		t.Fatalf("SendMsg() error: %v", err)
+	}
+	if err = stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend() error: %v", err)
+	}
+
+	// Draws of other prizes are not streamed.
+	c.draw("3rd", nil, 1)
+	committed := c.draw("2nd", nil, 2)
+
+	for {
+		m := grpcMessage("DrawEvent")
+		if err = stream.RecvMsg(m); err != nil {
+			t.Fatalf("RecvMsg() error: %v", err)
+		}
+
+		e := grpcTestResponse(t, m)
+		if e.PrizeID != "2nd" {
+			t.Fatalf("event of prize %v = %+v, want prize 2nd only", e.PrizeID, e)
+		}
+		if e.Name == "stop" {
+			if strings.Join(testIDs(e.Winners), ",") != strings.Join(testIDs(committed.Winners), ",") {
+				t.Errorf("committed winners = %v, want %v", testIDs(e.Winners), testIDs(committed.Winners))
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/northbright/lottery-server/lottery"
+	"github.com/northbright/lottery-server/store"
+)
+
+// Time allowed to receive a response in tests.
+const testTimeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	// Logs of the server are noise in test output.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+func testConfig() Config {
+	return Config{Prizes: []Prize{
+		{ID: "3rd", Tier: 1, Name: "3rd", Num: 3},
+		{ID: "2nd", Tier: 2, Name: "2nd", Num: 2},
+		{ID: "1st", Tier: 3, Name: "1st", Num: 1},
+	}}
+}
+
+func testParticipants(n int) []Participant {
+	participants := []Participant{}
+	for i := 1; i <= n; i++ {
+		participants = append(participants, Participant{ID: fmt.Sprint(i), Name: fmt.Sprintf("P%v", i)})
+	}
+	return participants
+}
+
+// newTestServer resets the state of the server with the config and participants,
+// and serves /ws and the HTTP API by httptest.
+func newTestServer(t *testing.T, c Config, p []Participant) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	settings = defaultServerSettings()
+	settings.ResultsDir = dir
+	settings.ConfigFile = filepath.Join(dir, "config.json")
+	settings.ParticipantsFile = filepath.Join(dir, "participants.csv")
+	settings.FulfillmentFile = filepath.Join(dir, "fulfillment.json")
+	settings.ScheduleFile = filepath.Join(dir, "schedule.json")
+	settings.MediaDir = filepath.Join(dir, "media")
+
+	lottery.NormalizeConfig(&c)
+	config, participants = c, p
+	st = store.NewMemory()
+	displayMu.Lock()
+	displayState = DisplayState{Status: displayIdle}
+	displayMu.Unlock()
+	eventFeed = newFeed()
+	scheduleMu.Lock()
+	schedule = []ScheduledDraw{}
+	scheduleMu.Unlock()
+
+	var err error
+	if lot, err = lottery.New(config, participants); err != nil {
+		t.Fatalf("lottery.New() error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", serveWs)
+	mux.HandleFunc("/display/ws", serveDisplayWs)
+	mux.Handle("/api/", apiHandler())
+	srv := httptest.NewServer(mux)
+
+	t.Cleanup(func() {
+		stopTestDraw()
+		srv.Close()
+
+		// Wait for readPump of clients to return, which may still be processing actions(e.g. audits).
+		hub.closeAll()
+		for deadline := time.Now().Add(testTimeout); hub.len() > 0; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Errorf("%v clients are still connected", hub.len())
+				break
+			}
+		}
+	})
+	return srv
+}
+
+// stopTestDraw stops the draw left running by a failed test, and waits for start() of the last draw,
+// which records the history and updates the display after the response is sent.
+func stopTestDraw() {
+	controlMu.Lock()
+	if cancel != nil {
+		stopDrawLocked(nil, Action{Name: "stop"})
+	}
+	controlMu.Unlock()
+
+	mutex.Lock()
+	mutex.Unlock()
+}
+
+// testResponse has fields of all responses used by tests.
+type testResponse struct {
+	CommonResponse
+	Winners []Participant `json:"winners"`
+	Prizes  []Prize       `json:"prizes"`
+	Config  *Config       `json:"config"`
+	Changes []string      `json:"changes"`
+
+	Participants    []Participant `json:"participants"`
+	ParticipantsCSV string        `json:"participants_csv"`
+
+	Display DisplayState    `json:"display"`
+	Report  InventoryReport `json:"report"`
+	// Seconds of the countdown.
+	Seconds int `json:"seconds"`
+}
+
+// fakeClient is a WebSocket client of /ws which scripts actions like the front-end.
+type fakeClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+	// Responses received but not read yet. Queued responses are sent in one message, see writePump.
+	pending [][]byte
+}
+
+func dialTestClient(t *testing.T, srv *httptest.Server) *fakeClient {
+	t.Helper()
+
+	return dialTestPath(t, srv, "/ws")
+}
+
+// dialTestPath dials the WebSocket of the path, e.g. /display/ws.
+func dialTestPath(t *testing.T, srv *httptest.Server, path string) *fakeClient {
+	t.Helper()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &fakeClient{t: t, conn: conn}
+}
+
+// send sends the action and returns its request ID, which is generated if it's empty.
+func (c *fakeClient) send(a Action) string {
+	c.t.Helper()
+
+	if a.RequestID == "" {
+		a.RequestID = newID()
+	}
+	if err := c.conn.WriteJSON(a); err != nil {
+		c.t.Fatalf("WriteJSON() error: %v", err)
+	}
+	return a.RequestID
+}
+
+// next returns the next response.
+func (c *fakeClient) next() testResponse {
+	c.t.Helper()
+
+	for len(c.pending) == 0 {
+		c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("ReadMessage() error: %v", err)
+		}
+		c.pending = bytes.Split(message, newline)
+	}
+
+	buf := c.pending[0]
+	c.pending = c.pending[1:]
+
+	var res testResponse
+	if err := json.Unmarshal(buf, &res); err != nil {
+		c.t.Fatalf("Unmarshal(%s) error: %v", buf, err)
+	}
+	return res
+}
+
+// waitFor returns the first response of the request with the action name.
+// Other responses are skipped, e.g. rounds of the draw and broadcast messages.
+func (c *fakeClient) waitFor(requestID, name string) testResponse {
+	c.t.Helper()
+
+	for {
+		res := c.next()
+		if res.RequestID == requestID && res.Name == name {
+			return res
+		}
+	}
+}
+
+// do sends the action and returns its response.
+func (c *fakeClient) do(a Action) testResponse {
+	c.t.Helper()
+
+	return c.waitFor(c.send(a), a.Name)
+}
+
+// draw starts the draw, waits for rounds, stops it and returns the committed response.
+func (c *fakeClient) draw(prizeID string, oldWinnerIndexes []int, rounds int) testResponse {
+	c.t.Helper()
+
+	id := c.send(Action{Name: "start", PrizeID: prizeID, OldWinnerIndexes: oldWinnerIndexes})
+	for i := 0; i < rounds; i++ {
+		res := c.waitFor(id, "start")
+		if !res.Success {
+			c.t.Fatalf("start %v error: %v", prizeID, res.ErrMsg)
+		}
+	}
+
+	c.send(Action{Name: "stop", PrizeID: prizeID})
+	return c.waitFor(id, "stop")
+}
+
+// testIDs returns IDs of the participants.
+func testIDs(participants []Participant) []string {
+	s := []string{}
+	for _, p := range participants {
+		s = append(s, p.ID)
+	}
+	return s
+}
+
+// distinct returns true if participants have distinct IDs.
+func distinct(participants []Participant) bool {
+	m := map[string]bool{}
+	for _, p := range participants {
+		if m[p.ID] {
+			return false
+		}
+		m[p.ID] = true
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+)
+
+// Hub maintains the set of connected clients and broadcasts messages to them.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*Client]bool
+}
+
+var hub = newHub()
+
+func newHub() *Hub {
+	return &Hub{clients: map[*Client]bool{}}
+}
+
+func (h *Hub) register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clients[c] = true
+}
+
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, c)
+}
+
+func (h *Hub) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.clients)
+}
+
+// closeAll sends close messages to all clients and closes the connections.
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		c.close()
+	}
+}
+
+// broadcast sends the response to all connected clients except display clients,
+// which only receive display states by broadcastDisplay(e.g. not every round of draws).
+func (h *Hub) broadcast(res interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		if c.display {
+			continue
+		}
+		if err := sendResponse(c, res); err != nil {
+			c.logger.Warn("broadcast error", "err", err)
+		}
+	}
+}
+
+// broadcastDisplay sends the response to all display clients.
+func (h *Hub) broadcastDisplay(res interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		if !c.display {
+			continue
+		}
+		if err := sendResponse(c, res); err != nil {
+			c.logger.Warn("broadcast error", "err", err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Fulfillment records when the prize is claimed and shipped to the winner.
+type Fulfillment struct {
+	PrizeID       string     `json:"prize_id"`
+	ParticipantID string     `json:"participant_id"`
+	ClaimedAt     *time.Time `json:"claimed_at,omitempty"`
+	ShippedAt     *time.Time `json:"shipped_at,omitempty"`
+}
+
+type fulfillmentKey struct {
+	prizeID       string
+	participantID string
+}
+
+var (
+	fulfillmentMu sync.Mutex
+	fulfillments  = map[fulfillmentKey]Fulfillment{}
+)
+
+// InventoryItemReport is the report of an inventory item.
+type InventoryItemReport struct {
+	InventoryItem
+	Awarded      int     `json:"awarded"`
+	Claimed      int     `json:"claimed"`
+	Shipped      int     `json:"shipped"`
+	Remaining    int     `json:"remaining"`
+	TotalValue   float64 `json:"total_value"`
+	AwardedValue float64 `json:"awarded_value"`
+}
+
+// SponsorReport totals prize values of a sponsor in a currency.
+type SponsorReport struct {
+	Sponsor      string  `json:"sponsor"`
+	Currency     string  `json:"currency"`
+	Quantity     int     `json:"quantity"`
+	Awarded      int     `json:"awarded"`
+	TotalValue   float64 `json:"total_value"`
+	AwardedValue float64 `json:"awarded_value"`
+}
+
+// WinnerFulfillment is the fulfillment state of a winner of the prize with a SKU.
+type WinnerFulfillment struct {
+	PrizeID     string      `json:"prize_id"`
+	PrizeName   string      `json:"prize_name"`
+	SKU         string      `json:"sku"`
+	Participant Participant `json:"participant"`
+	ClaimedAt   *time.Time  `json:"claimed_at,omitempty"`
+	ShippedAt   *time.Time  `json:"shipped_at,omitempty"`
+}
+
+type InventoryReport struct {
+	Items    []InventoryItemReport `json:"items"`
+	Sponsors []SponsorReport       `json:"sponsors"`
+	Winners  []WinnerFulfillment   `json:"winners"`
+}
+
+type InventoryResponse struct {
+	CommonResponse
+	Report InventoryReport `json:"report"`
+}
+
+// loadFulfillments loads the fulfillment file. It's OK if the file does not exist.
+func loadFulfillments(file string) error {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var l []Fulfillment
+	if err = json.Unmarshal(buf, &l); err != nil {
+		return err
+	}
+
+	fulfillmentMu.Lock()
+	defer fulfillmentMu.Unlock()
+
+	fulfillments = map[fulfillmentKey]Fulfillment{}
+	for _, f := range l {
+		fulfillments[fulfillmentKey{f.PrizeID, f.ParticipantID}] = f
+	}
+	return nil
+}
+
+// saveFulfillments writes fulfillments to the file. The caller should hold fulfillmentMu.
+func saveFulfillments(file string) error {
+	l := []Fulfillment{}
+	for _, f := range fulfillments {
+		l = append(l, f)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].PrizeID != l[j].PrizeID {
+			return l[i].PrizeID < l[j].PrizeID
+		}
+		return l[i].ParticipantID < l[j].ParticipantID
+	})
+
+	buf, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, append(buf, '\n'))
+}
+
+// fulfill marks the prize as claimed or shipped(also claimed if it's not) by the winner.
+func fulfill(prizeID string, participantID string, shipped bool) error {
+	prizes := currentConfig().Prizes
+	prizeIndex := lottery.PrizeIndex(prizes, prizeID)
+	if prizeIndex < 0 {
+		return fmt.Errorf("unknown prize")
+	}
+
+	found := false
+	for _, w := range lot.Winners(prizeID) {
+		if w.ID == participantID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("participant %v is not a winner of prize %v", redact(participantID), prizes[prizeIndex].Name)
+	}
+
+	fulfillmentMu.Lock()
+	defer fulfillmentMu.Unlock()
+
+	k := fulfillmentKey{prizeID, participantID}
+	old, existed := fulfillments[k]
+	f := old
+	f.PrizeID, f.ParticipantID = prizeID, participantID
+
+	now := time.Now()
+	if f.ClaimedAt == nil {
+		f.ClaimedAt = &now
+	}
+	if shipped && f.ShippedAt == nil {
+		f.ShippedAt = &now
+	}
+
+	fulfillments[k] = f
+	if err := saveFulfillments(settings.FulfillmentFile); err != nil {
+		// Roll back.
+		if existed {
+			fulfillments[k] = old
+		} else {
+			delete(fulfillments, k)
+		}
+		return fmt.Errorf("saveFulfillments() error: %v", err)
+	}
+	return nil
+}
+
+// getInventoryReport returns the inventory report of the config and the winners of prizes by prize IDs,
+// e.g. a snapshot of lot.AllWinners().
+// Only fulfillments of current winners are counted(winners may be replaced by re-lottery).
+func getInventoryReport(config Config, winnerMap map[string][]Participant) InventoryReport {
+	fulfillmentMu.Lock()
+	defer fulfillmentMu.Unlock()
+
+	r := InventoryReport{Items: []InventoryItemReport{}, Sponsors: []SponsorReport{}, Winners: []WinnerFulfillment{}}
+
+	items := map[string]*InventoryItemReport{}
+	for _, item := range config.Inventory {
+		r.Items = append(r.Items, InventoryItemReport{InventoryItem: item})
+	}
+	for i := range r.Items {
+		items[r.Items[i].SKU] = &r.Items[i]
+	}
+
+	for _, p := range config.Prizes {
+		item, ok := items[p.SKU]
+		if !ok {
+			continue
+		}
+
+		for _, w := range winnerMap[p.ID] {
+			f := fulfillments[fulfillmentKey{p.ID, w.ID}]
+			item.Awarded++
+			if f.ClaimedAt != nil {
+				item.Claimed++
+			}
+			if f.ShippedAt != nil {
+				item.Shipped++
+			}
+			r.Winners = append(r.Winners, WinnerFulfillment{p.ID, p.Name, p.SKU, w, f.ClaimedAt, f.ShippedAt})
+		}
+	}
+
+	sponsors := map[[2]string]*SponsorReport{}
+	var keys [][2]string
+	for i := range r.Items {
+		item := &r.Items[i]
+		if item.Remaining = item.Quantity - item.Awarded; item.Remaining < 0 {
+			item.Remaining = 0
+		}
+		item.TotalValue = item.UnitValue * float64(item.Quantity)
+		item.AwardedValue = item.UnitValue * float64(item.Awarded)
+
+		k := [2]string{item.Sponsor, item.Currency}
+		s, ok := sponsors[k]
+		if !ok {
+			s = &SponsorReport{Sponsor: item.Sponsor, Currency: item.Currency}
+			sponsors[k] = s
+			keys = append(keys, k)
+		}
+		s.Quantity += item.Quantity
+		s.Awarded += item.Awarded
+		s.TotalValue += item.TotalValue
+		s.AwardedValue += item.AwardedValue
+	}
+
+	for _, k := range keys {
+		r.Sponsors = append(r.Sponsors, *sponsors[k])
+	}
+	return r
+}
+
+// serveInventory serves the inventory report: GET /api/inventory.
+func serveInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !checkAdminRequest(r) {
+		http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getInventoryReport(currentConfig(), lot.AllWinners()))
+}
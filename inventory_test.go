@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestGetInventoryReport(t *testing.T) {
+	c := testConfig()
+	c.Prizes[0].SKU, c.Prizes[1].SKU = "mug", "mug"
+	c.Inventory = []InventoryItem{{SKU: "mug", Name: "Mug", Sponsor: "ACME", UnitValue: 10, Currency: "USD", Quantity: 5}}
+	newTestServer(t, c, testParticipants(10))
+
+	// The report is made of the winners passed in, not the winners in lot.
+	winners := map[string][]Participant{"3rd": testParticipants(3), "2nd": testParticipants(10)[5:6]}
+	r := getInventoryReport(currentConfig(), winners)
+
+	if len(r.Items) != 1 || r.Items[0].Awarded != 4 || r.Items[0].Remaining != 1 || r.Items[0].AwardedValue != 40 {
+		t.Fatalf("items = %+v, want 4 awarded and 1 remaining", r.Items)
+	}
+	if len(r.Winners) != 4 || r.Winners[3].PrizeID != "2nd" || r.Winners[3].Participant.ID != "6" {
+		t.Errorf("winners = %+v, want 4 winners of 3rd and 2nd", r.Winners)
+	}
+	if len(r.Sponsors) != 1 || r.Sponsors[0].Sponsor != "ACME" || r.Sponsors[0].Quantity != 5 || r.Sponsors[0].Awarded != 4 {
+		t.Errorf("sponsors = %+v, want ACME with 4 awarded", r.Sponsors)
+	}
+}
+
+func TestFulfill(t *testing.T) {
+	c := testConfig()
+	c.Prizes[0].SKU = "mug"
+	c.Inventory = []InventoryItem{{SKU: "mug", Name: "Mug", Sponsor: "ACME", Quantity: 5}}
+	srv := newTestServer(t, c, testParticipants(10))
+	fulfillmentMu.Lock()
+	fulfillments = map[fulfillmentKey]Fulfillment{}
+	fulfillmentMu.Unlock()
+	client := dialTestClient(t, srv)
+
+	winners := client.draw("3rd", nil, 1).Winners
+	losers := map[string]bool{}
+	for _, p := range participants {
+		losers[p.ID] = true
+	}
+	for _, w := range winners {
+		delete(losers, w.ID)
+	}
+	loser := ""
+	for id := range losers {
+		loser = id
+		break
+	}
+
+	for _, tt := range []struct {
+		name, prizeID, participantID string
+	}{
+		{"claim_prize", "4th", winners[0].ID},
+		{"claim_prize", "3rd", loser},
+		{"ship_prize", "2nd", winners[0].ID},
+	} {
+		if res := client.do(Action{Name: tt.name, PrizeID: tt.prizeID, ParticipantID: tt.participantID}); res.Success {
+			t.Errorf("%v of prize %v by %v = %+v, want error", tt.name, tt.prizeID, tt.participantID, res)
+		}
+	}
+
+	res := client.do(Action{Name: "claim_prize", PrizeID: "3rd", ParticipantID: winners[0].ID})
+	if items := res.Report.Items; !res.Success || len(items) != 1 || items[0].Claimed != 1 || items[0].Shipped != 0 {
+		t.Fatalf("claim_prize = %+v, want 1 claimed", res)
+	}
+
+	// Shipped prizes are claimed too.
+	res = client.do(Action{Name: "ship_prize", PrizeID: "3rd", ParticipantID: winners[1].ID})
+	if items := res.Report.Items; !res.Success || items[0].Claimed != 2 || items[0].Shipped != 1 {
+		t.Fatalf("ship_prize = %+v, want 2 claimed and 1 shipped", res)
+	}
+	for _, w := range res.Report.Winners {
+		if w.Participant.ID == winners[1].ID && (w.ClaimedAt == nil || w.ShippedAt == nil) {
+			t.Errorf("winner %+v, want claimed and shipped", w)
+		}
+	}
+
+	// Fulfillments are loaded from the file after restart.
+	fulfillmentMu.Lock()
+	fulfillments = map[fulfillmentKey]Fulfillment{}
+	fulfillmentMu.Unlock()
+	if err := loadFulfillments(settings.FulfillmentFile); err != nil {
+		t.Fatalf("loadFulfillments() error: %v", err)
+	}
+	r := getInventoryReport(currentConfig(), lot.AllWinners())
+	if r.Items[0].Claimed != 2 || r.Items[0].Shipped != 1 {
+		t.Errorf("items after loadFulfillments() = %+v, want 2 claimed and 1 shipped", r.Items)
+	}
+
+	// Fulfillments of winners replaced by re-lottery are not counted.
+	// The replaced winner may win again.
+	claimed := 1
+	for _, w := range client.draw("3rd", []int{0}, 1).Winners {
+		if w.ID == winners[0].ID {
+			claimed++
+		}
+	}
+	r = getInventoryReport(currentConfig(), lot.AllWinners())
+	if r.Items[0].Claimed != claimed || r.Items[0].Shipped != 1 {
+		t.Errorf("items after re-lottery = %+v, want %v claimed and 1 shipped", r.Items, claimed)
+	}
+}
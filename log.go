@@ -4,17 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"path"
+	"path/filepath"
 	"time"
-
-	"github.com/northbright/pathhelper"
 )
 
 func getLogFileName() string {
 	t := time.Now()
 	fileName := fmt.Sprintf("%02d-%02d-%02d.txt", t.Hour(), t.Minute(), t.Second())
-	currentDir, _ := pathhelper.GetCurrentExecDir()
-	p := path.Join(currentDir, fileName)
+	p := filepath.Join(settings.ResultsDir, fileName)
 	return p
 }
 
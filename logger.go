@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Redaction policies of participant names, IDs and emails in logs.
+const (
+	redactNone = "none" // Log as is.
+	redactMask = "mask" // Keep the first and the last character: "Frank" -> "F***k".
+	// Replace with HMAC-SHA256 keyed by log_redact_key(stable, so it can be correlated).
+	// The key makes hashes of guessable values, e.g. employee IDs, irreversible without it.
+	redactHash = "hash"
+)
+
+var (
+	redactPolicy = redactMask
+	// Key of HMAC of the hash policy.
+	redactKey []byte
+)
+
+func init() {
+	// Participants logged by the lottery engine are redacted by the same policy.
+	lottery.Redact = redact
+}
+
+// newLogHandler creates the slog handler of the level and format.
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %v", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid log format: %v", format)
+	}
+}
+
+func validateRedactPolicy(redact, key string) error {
+	switch redact {
+	case redactNone, redactMask:
+		return nil
+	case redactHash:
+		if key == "" {
+			return fmt.Errorf("log_redact_key is required by log redaction policy: hash")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid log redaction policy: %v", redact)
+	}
+}
+
+// setupLogger sets the default slog logger and the redaction policy.
+func setupLogger(w io.Writer, level, format, redact, redactKey string) error {
+	if err := validateRedactPolicy(redact, redactKey); err != nil {
+		return err
+	}
+
+	h, err := newLogHandler(w, level, format)
+	if err != nil {
+		return err
+	}
+
+	setRedactPolicy(redact, redactKey)
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+func setRedactPolicy(redact, key string) {
+	redactPolicy, redactKey = redact, []byte(key)
+}
+
+// redact redacts personal data according to the redaction policy.
+func redact(s string) string {
+	switch redactPolicy {
+	case redactNone:
+		return s
+	case redactHash:
+		if s == "" {
+			return s
+		}
+		mac := hmac.New(sha256.New, redactKey)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	default:
+		r := []rune(s)
+		if len(r) <= 2 {
+			return strings.Repeat("*", len(r))
+		}
+		return string(r[0]) + strings.Repeat("*", len(r)-2) + string(r[len(r)-1])
+	}
+}
+
+// participantList logs participants redacted.
+type participantList []Participant
+
+func (l participantList) LogValue() slog.Value {
+	var s []string
+	for _, p := range l {
+		s = append(s, redact(p.ID)+":"+redact(p.Name))
+	}
+	return slog.StringValue(strings.Join(s, ","))
+}
+
+// newID returns a random ID used to correlate logs of a client or a request.
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
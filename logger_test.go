@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	t.Cleanup(func() { setRedactPolicy(redactMask, "") })
+
+	tests := []struct {
+		policy string
+		s      string
+		want   string
+	}{
+		{redactNone, "Frank", "Frank"},
+		{redactMask, "Frank", "F***k"},
+		{redactMask, "Al", "**"},
+		{redactHash, "", ""},
+	}
+	for _, tt := range tests {
+		setRedactPolicy(tt.policy, "key")
+		if got := redact(tt.s); got != tt.want {
+			t.Errorf("redact(%q) by %v = %q, want %q", tt.s, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestRedactHash(t *testing.T) {
+	t.Cleanup(func() { setRedactPolicy(redactMask, "") })
+
+	setRedactPolicy(redactHash, "key1")
+	h := redact("1001")
+	if len(h) != 16 || h == "1001" {
+		t.Fatalf("redact(1001) = %q, want 16 hex chars", h)
+	}
+	if got := redact("1001"); got != h {
+		t.Errorf("redact(1001) = %q, then %q, want stable hashes", h, got)
+	}
+	if got := redact("1002"); got == h {
+		t.Errorf("redact(1002) = redact(1001) = %q", got)
+	}
+
+	// Hashes can't be recomputed without the key.
+	setRedactPolicy(redactHash, "key2")
+	if got := redact("1001"); got == h {
+		t.Errorf("redact(1001) with another key = %q, want a different hash", got)
+	}
+}
+
+func TestValidateRedactPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		key    string
+		err    bool
+	}{
+		{redactNone, "", false},
+		{redactMask, "", false},
+		{redactHash, "secret", false},
+		{redactHash, "", true},
+		{"base64", "", true},
+	}
+	for _, tt := range tests {
+		if err := validateRedactPolicy(tt.policy, tt.key); (err != nil) != tt.err {
+			t.Errorf("validateRedactPolicy(%q, %q) error = %v, want error: %v", tt.policy, tt.key, err, tt.err)
+		}
+	}
+}
+
+func TestSetupLoggerRedaction(t *testing.T) {
+	old := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(old)
+		setRedactPolicy(redactMask, "")
+	})
+
+	frank := Participant{ID: "1001", Name: "Frank"}
+	setRedactPolicy(redactHash, "key")
+	hashedID, hashedName := redact(frank.ID), redact(frank.Name)
+
+	tests := []struct {
+		policy string
+		want   []string
+		// Values which must not be logged.
+		hidden []string
+	}{
+		{redactNone, []string{"1001:Frank", `"id":"1001"`, `"name":"Frank"`}, nil},
+		{redactMask, []string{"1**1:F***k", `"id":"1**1"`, `"name":"F***k"`}, []string{"1001", "Frank"}},
+		{redactHash, []string{hashedID + ":" + hashedName, `"id":"` + hashedID + `"`}, []string{"1001", "Frank"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := setupLogger(&buf, "debug", "json", tt.policy, "key"); err != nil {
+				t.Fatalf("setupLogger() error: %v", err)
+			}
+
+			// Participants logged by the server and by the lottery engine.
+			slog.Debug("winners", "winners", participantList{frank}, "winner", frank)
+
+			var m map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+				t.Fatalf("log %q is not JSON: %v", buf.String(), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("log = %q, want %q", buf.String(), want)
+				}
+			}
+			for _, hidden := range tt.hidden {
+				if strings.Contains(buf.String(), hidden) {
+					t.Errorf("log = %q, want %q redacted", buf.String(), hidden)
+				}
+			}
+		})
+	}
+}
+
+func TestSetupLoggerLevel(t *testing.T) {
+	old := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(old)
+		setRedactPolicy(redactMask, "")
+	})
+
+	var buf bytes.Buffer
+	if err := setupLogger(&buf, "warn", "text", redactMask, ""); err != nil {
+		t.Fatalf("setupLogger() error: %v", err)
+	}
+	slog.Info("hidden")
+	slog.Warn("shown")
+	if s := buf.String(); strings.Contains(s, "hidden") || !strings.Contains(s, "level=WARN msg=shown") {
+		t.Errorf("log = %q, want warnings only in text", s)
+	}
+
+	for _, args := range [][]string{{"verbose", "text", redactMask, ""}, {"info", "xml", redactMask, ""}, {"info", "text", redactHash, ""}} {
+		if err := setupLogger(&buf, args[0], args[1], args[2], args[3]); err == nil {
+			t.Errorf("setupLogger(%q) error = nil", args)
+		}
+	}
+}
@@ -2,56 +2,72 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
-	"path"
+	"os"
 	"sync"
 	"time"
 
-	"github.com/northbright/csvhelper"
-	"github.com/northbright/pathhelper"
+	"github.com/northbright/lottery-server/lottery"
 )
 
-var (
-	participantsCSV   = `participants.csv`
-	configFile        = `config.json`
-	config            Config
-	participants      []Participant
-	availParticipants []Participant
-	winnerMap         = map[int][]Participant{}
-	ctx               context.Context
-	cancel            context.CancelFunc = nil
-	mutex                                = &sync.Mutex{}
-	chDone                               = make(chan struct{})
+// Types of the lottery engine used by the server.
+type (
+	Participant   = lottery.Participant
+	Prize         = lottery.Prize
+	Theme         = lottery.Theme
+	Blacklist     = lottery.Blacklist
+	Config        = lottery.Config
+	InventoryItem = lottery.InventoryItem
 )
 
-type Participant struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-}
-
-type Prize struct {
-	Name    string `json:"name"`
-	Num     int    `json:"num"`
-	Content string `json:"content"`
-}
-
-type Blacklist struct {
-	MaxPrizeIndex int      `json:"max_prize_index"`
-	IDs           []string `json:"ids"`
-}
-
-type Config struct {
-	Prizes     []Prize     `json:"prizes"`
-	Blacklists []Blacklist `json:"blacklists"`
-}
+var (
+	// Current config and participants of the server. They're changed with lot by applyState only,
+	// and read by currentConfig and currentParticipants.
+	config       Config
+	participants []Participant
+	// stateMu protects config and participants.
+	stateMu sync.RWMutex
+	// updateMu serializes changes of config and participants made from the current ones, see updateState.
+	updateMu sync.Mutex
+	// lot is the lottery engine which keeps winners of prizes.
+	lot    *lottery.Lottery
+	ctx    context.Context
+	cancel context.CancelCauseFunc = nil
+	mutex                          = &sync.Mutex{}
+	chDone                         = make(chan struct{})
+
+	// controlMu serializes starting and stopping draws by clients and the scheduler.
+	controlMu sync.Mutex
+	// Request ID of the start action of the running draw.
+	runningRequestID string
+	// runningDone is closed when start() of the running draw returns(winners are committed or discarded).
+	runningDone chan struct{}
+
+	// errDrawAborted is the cause to cancel the running draw without committing the winners.
+	errDrawAborted = errors.New("draw aborted")
+)
 
 type Action struct {
-	Name             string `json:"name"`
+	Name string `json:"name"`
+	// PrizeID is preferred. PrizeIndex is used if PrizeID is empty(old clients), see resolvePrize.
+	PrizeID          string `json:"prize_id,omitempty"`
 	PrizeIndex       int    `json:"prize_index"`
 	OldWinnerIndexes []int  `json:"old_winner_indexes"`
+	// RequestID is used to correlate logs and responses of the action.
+	// It's generated by the server if it's empty.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Payloads of admin actions.
+	Config          *Config `json:"config,omitempty"`
+	ParticipantsCSV string  `json:"participants_csv,omitempty"`
+	// Winner to claim or ship the prize.
+	ParticipantID string `json:"participant_id,omitempty"`
+	// Token is required by admin actions if admin_token is set.
+	Token string `json:"token,omitempty"`
 }
 
 type CommonResponse struct {
@@ -71,44 +87,53 @@ type WinnersResponse struct {
 }
 
 func loadParticipants(file string) ([]Participant, error) {
-	currentDir, _ := pathhelper.GetCurrentExecDir()
-	file = path.Join(currentDir, file)
-
-	rows, err := csvhelper.ReadFile(file)
+	f, err := os.Open(file)
 	if err != nil {
 		return []Participant{}, err
 	}
+	defer f.Close()
 
-	var participants []Participant
-	for _, row := range rows {
-		if len(row) != 2 {
-			return []Participant{}, fmt.Errorf("incorrect participants CSV")
-		}
-		participants = append(participants, Participant{row[0], row[1]})
+	// Emails are optional per row, like the CSV of update_participants.
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return []Participant{}, err
 	}
-	return participants, nil
 
+	return lottery.ParseParticipants(rows)
 }
 
 func loadConfig(file string, config *Config) error {
-	currentDir, _ := pathhelper.GetCurrentExecDir()
-	file = path.Join(currentDir, file)
-
 	// Load Conifg.
 	buf, err := ioutil.ReadFile(file)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(buf, config)
+	if err = json.Unmarshal(buf, config); err != nil {
+		return err
+	}
+
+	lottery.NormalizeConfig(config)
+	return nil
 }
 
+// sendResponse queues the response to the client.
+// The response is dropped if the send buffer of the client is full(e.g. the client is gone),
+// so that a running draw never blocks on a slow client.
 func sendResponse(c *Client, res interface{}) error {
 	buf, err := json.Marshal(res)
 	if err != nil {
 		return err
 	}
-	c.send <- buf
+
+	select {
+	case c.send <- buf:
+	default:
+		droppedMessages.Inc()
+		return fmt.Errorf("send buffer is full, message dropped")
+	}
 	return nil
 }
 
@@ -122,381 +147,273 @@ func parseAction(message []byte) (Action, error) {
 }
 
 func processAction(c *Client, message []byte) {
-	fmt.Printf("processAction()..., message: %s\n", message)
-
-	//mutex := &sync.Mutex{}
-
 	action, err := parseAction(message)
 
 	if err != nil {
-		fmt.Printf("parseAction() error: %v\n", err)
+		c.logger.Error("parseAction() error", "err", err)
+		countActionError("unknown")
 		return
 	}
 
+	if action.RequestID == "" {
+		action.RequestID = newID()
+	}
+	resolvePrize(&action, currentConfig().Prizes)
+
+	l := c.actionLogger(action)
+	l.Debug("processAction()", "prize_id", action.PrizeID, "prize_index", action.PrizeIndex, "old_winner_indexes", action.OldWinnerIndexes)
+
+	// Do not send the token back in responses.
+	token := action.Token
+	action.Token = ""
+
+	errMsg := ""
+	defer func() {
+		recordAudit(c, action, errMsg)
+	}()
+
 	switch action.Name {
 	case "get_prizes":
 		if err = getPrizes(c, action); err != nil {
-			fmt.Printf("getPrizes() error: %v\n", err)
+			errMsg = err.Error()
+			l.Error("getPrizes() error", "err", err)
+			countActionError(action.Name)
 		}
 
 	case "get_winners":
 		if err = getWinners(c, action, mutex); err != nil {
-			fmt.Printf("getWinners() error: %v\n", err)
+			errMsg = err.Error()
+			l.Error("getWinners() error", "err", err)
+			countActionError(action.Name)
 		}
 
-	case "start":
-		if cancel != nil {
-			errMsg := fmt.Sprintf("start() is already running")
-			sendWinnersResponse(c, action, []Participant{}, errMsg)
-			fmt.Println(errMsg)
-			break
+	case "display_prize":
+		if err = displayPrize(c, action, token); err != nil {
+			errMsg = err.Error()
+			l.Warn("displayPrize() error", "err", err)
+			countActionError(action.Name)
 		}
 
-		if err := validate(config.Prizes, action.PrizeIndex, winnerMap[action.PrizeIndex], action.OldWinnerIndexes); err != nil {
-			errMsg := fmt.Sprintf("validate() error: %v", err)
-			sendWinnersResponse(c, action, []Participant{}, errMsg)
-			fmt.Println(errMsg)
-			break
+	case "get_config", "update_config", "get_participants", "update_participants", "get_history", "get_audit",
+		"get_inventory", "claim_prize", "ship_prize":
+		if errMsg = processAdminAction(c, action, token); errMsg != "" {
+			l.Warn(errMsg)
+			countActionError(action.Name)
 		}
 
-		prizeNum, err := getPrizeNum(config.Prizes, action.PrizeIndex, action.OldWinnerIndexes)
-		if err != nil {
-			errMsg := fmt.Sprintf("getPrizeNum() error: %v", err)
+	case "start", "stop", "abort":
+		switch {
+		case !checkAdminToken(token):
+			errMsg = "invalid admin token"
 			sendWinnersResponse(c, action, []Participant{}, errMsg)
-			fmt.Println(errMsg)
-			break
+			l.Warn(errMsg)
+			countActionError(action.Name)
+		case action.Name == "start":
+			errMsg = startDraw(c, action)
+		case action.Name == "stop":
+			errMsg = stopDraw(c, action)
+		default:
+			errMsg = abortDraw(c, action)
 		}
 
-		// Return older winners for re-lottery.
-		returnedWinners := getReturnedWinners(winnerMap[action.PrizeIndex], action.OldWinnerIndexes)
-		availParticipants = append(availParticipants, returnedWinners...)
-
-		updatedAvailables := getAvailableParticipantsAfterRemovedBlacklist(
-			action.PrizeIndex,
-			availParticipants,
-			config.Blacklists)
-
-		fmt.Printf("updatedAvailables: %v\n", updatedAvailables)
-
-		ctx, cancel = context.WithCancel(context.Background())
-		go start(ctx, c, action, prizeNum, updatedAvailables, mutex)
-
-	case "stop":
-		fmt.Printf("stop\n")
-		if cancel == nil {
-			errMsg := fmt.Sprintf("no start is running for prize: %v", action.PrizeIndex)
-			sendWinnersResponse(c, action, []Participant{}, errMsg)
-			break
-		}
-		cancel()
-		<-ctx.Done()
-		// Set cancel to nil
-		cancel = nil
-		fmt.Printf("stop <- ctx.Done()\n")
+	default:
+		errMsg = "unknown action"
+		l.Warn(errMsg)
+		countActionError(action.Name)
 	}
 }
 
-func getPrizes(c *Client, a Action) error {
-	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: a}
-	res := PrizesResponse{commonRes, config.Prizes}
+// startDraw starts the draw of the action and returns the error message if it fails.
+// Responses are broadcast to all clients if c is nil(e.g. scheduled draws).
+func startDraw(c *Client, action Action) string {
+	controlMu.Lock()
+	defer controlMu.Unlock()
 
-	buf, err := json.Marshal(res)
-	if err != nil {
-		return err
+	l := c.actionLogger(action)
+	fail := func(errMsg string) string {
+		sendWinnersResponse(c, action, []Participant{}, errMsg)
+		l.Warn(errMsg)
+		countActionError(action.Name)
+		return errMsg
 	}
-	c.send <- buf
-	return nil
-}
-
-func getWinners(c *Client, a Action, mutex *sync.Mutex) error {
-	//mutex.Lock()
-	//defer mutex.Unlock()
-
-	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: a}
 
-	winners := []Participant{}
-	if _, ok := winnerMap[a.PrizeIndex]; ok {
-		winners = winnerMap[a.PrizeIndex]
+	if shuttingDown() {
+		return fail("server is shutting down")
 	}
 
-	res := WinnersResponse{commonRes, winners}
+	if cancel != nil {
+		return fail(fmt.Sprintf("start() is already running"))
+	}
 
-	buf, err := json.Marshal(res)
+	ctx, cancel = context.WithCancelCause(context.Background())
+	d, err := lot.Draw(ctx, action.PrizeID, lottery.DrawOptions{
+		OldWinnerIndexes: action.OldWinnerIndexes,
+		Interval:         time.Millisecond * 100,
+		OnRound: func(winners []Participant) {
+			t := time.Now()
+			sendWinnersResponse(c, action, winners, "")
+			tickSendSeconds.Observe(time.Since(t).Seconds())
+			eventFeed.publish(action.Name, genWinnersResponse(action, winners, ""))
+			setDisplay(displayRolling, action.PrizeID, winners)
+		},
+	})
 	if err != nil {
-		return err
+		cancel(nil)
+		cancel = nil
+		return fail(err.Error())
 	}
-	c.send <- buf
-	return nil
-}
 
-func start(ctx context.Context, c *Client, a Action, prizeNum int, availables []Participant, mutex *sync.Mutex) {
-	var (
-		err     error
-		errMsg  = ""
-		winners = []Participant{}
-	)
-
-	mutex.Lock()
-	defer mutex.Unlock()
+	l.Info("start", "prize_id", action.PrizeID, "prize_num", d.Num, "eligible", d.Eligible)
+	setEligibleParticipants(action.PrizeID, d.Eligible)
 
-	defer func() {
-		sendWinnersResponse(c, a, winners, errMsg)
+	done := make(chan struct{})
+	runningRequestID, runningDone = action.RequestID, done
+	drawsStarted.Inc()
+	go func() {
+		start(ctx, c, action, d, mutex)
+		close(done)
 	}()
-
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Printf("ctx.Done() in getWinners\n")
-			// Modify action name when cancel() is called("stop" action received).
-			a.Name = "stop"
-
-			// If old winners and old winner indexes(want to re-lottery) are not empty.
-			// Update winners for relottery
-			if len(winnerMap[a.PrizeIndex]) > 0 && len(a.OldWinnerIndexes) > 0 {
-				oldWinners := winnerMap[a.PrizeIndex]
-
-				if winners, err = updateRelotteryWinners(oldWinners, a.OldWinnerIndexes, winners); err != nil {
-					errMsg = fmt.Sprintf("relottery error: %v", err)
-					fmt.Println(errMsg)
-					return
-				}
-			}
-
-			winnerMap[a.PrizeIndex] = winners
-
-			fmt.Printf("winners: %v\n", winners)
-			fmt.Printf("before remove winners, availParticipants: %v\n", availParticipants)
-
-			// Remove winners from available participants.
-			availParticipants = removeWinners(availParticipants, winners)
-
-			fmt.Printf("after remove winners, availParticipants: %v\n", availParticipants)
-
-			// log winners response
-			logWinnerResponse(a, winners, errMsg)
-			return
-		default:
-		}
-
-		winners, availables, err = round(prizeNum, availables, winners)
-		if err != nil {
-			errMsg = fmt.Sprintf("rount() error: %v", err)
-			fmt.Println(errMsg)
-			return
-		}
-
-		/*
-			for i, p := range winners {
-				fmt.Printf("%v: ID: %v, Name: %v\n", i, p.ID, p.Name)
-			}
-		*/
-
-		// Update winners for relottery
-		tmpWinners := winners
-		if len(winnerMap[a.PrizeIndex]) > 0 && len(a.OldWinnerIndexes) > 0 {
-			oldWinners := winnerMap[a.PrizeIndex]
-
-			if tmpWinners, err = updateRelotteryWinners(oldWinners, a.OldWinnerIndexes, winners); err != nil {
-				errMsg = fmt.Sprintf("relottery error: %v", err)
-				fmt.Println(errMsg)
-				return
-			}
-		}
-
-		sendWinnersResponse(c, a, tmpWinners, errMsg)
-		time.Sleep(time.Millisecond * 100)
-	}
+	return ""
 }
 
-// updateRelotteryWinners updates the winners which need to relottery previous prize.
-// It replaces old winners (specified in old winner indexes) with new winners.
-func updateRelotteryWinners(oldWinners []Participant, relotteryOldWinnerIndexes []int, relotteryWinners []Participant) ([]Participant, error) {
-	if len(relotteryWinners) != len(relotteryOldWinnerIndexes) {
-		return []Participant{}, fmt.Errorf("len(relottery winners) != len(relottery old winner indexes)")
-	}
-
-	// Update winners with relottery winners
-	for i, idx := range relotteryOldWinnerIndexes {
-		oldWinners[idx] = relotteryWinners[i]
-	}
+// stopDraw stops the running draw and returns the error message if no draw is running.
+func stopDraw(c *Client, action Action) string {
+	controlMu.Lock()
+	defer controlMu.Unlock()
 
-	// return updated winners
-	return oldWinners, nil
+	return stopDrawLocked(c, action)
 }
 
-func removeWinners(origin []Participant, winners []Participant) []Participant {
-	var updated []Participant
-	for _, p := range origin {
-		found := false
-
-		for _, w := range winners {
-			if p.ID == w.ID {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			updated = append(updated, p)
-		}
-	}
-
-	return updated
+// stopDrawLocked is stopDraw with controlMu held.
+func stopDrawLocked(c *Client, action Action) string {
+	return endDrawLocked(c, action, nil)
 }
 
-func verifyWinners(winners []Participant) bool {
-	m := map[string]Participant{}
+// abortDraw cancels the running draw without committing the winners,
+// and returns the error message if no draw is running.
+func abortDraw(c *Client, action Action) string {
+	controlMu.Lock()
+	defer controlMu.Unlock()
 
-	for _, p := range winners {
-		if _, ok := m[p.ID]; ok {
-			return false
-		}
-		m[p.ID] = p
-	}
-	return true
+	return abortDrawLocked(c, action)
 }
 
-func round(prizeNum int, availables []Participant, oldWinners []Participant) ([]Participant, []Participant, error) {
-	winners := []Participant{}
-
-	availables = append(availables, oldWinners...)
-
-	if prizeNum <= 0 {
-		return winners, availables, fmt.Errorf("incorrect prize number")
-	}
-
-	m := len(availables)
-	if m <= 0 {
-		return winners, availables, fmt.Errorf("no participants")
-	}
-
-	// Set prize num to m(number of participants),
-	// if number of participants is less than prize num:-).
-	if m < prizeNum {
-		prizeNum = m
-	}
-
-	for i := 0; i < prizeNum; i++ {
-		rand.Seed(time.Now().UnixNano())
-		idx := rand.Intn(len(availables))
-		winners = append(winners, availables[idx])
-		// Update participants
-		availables = append(availables[0:idx], availables[idx+1:]...)
-	}
-
-	valid := verifyWinners(winners)
-	if !valid {
-		return []Participant{}, availables, fmt.Errorf("invalid winners: %v", winners)
-	}
+// abortDrawLocked is abortDraw with controlMu held.
+func abortDrawLocked(c *Client, action Action) string {
+	return endDrawLocked(c, action, errDrawAborted)
+}
 
-	return winners, availables, nil
+// endDrawLocked cancels the running draw with the cause, errDrawAborted to discard the winners or nil to commit them.
+// start() of the draw sends the result. It waits for start() to return, so that the next draw starts
+// from the committed winners(start() never takes controlMu).
+func endDrawLocked(c *Client, action Action, cause error) string {
+	l := c.actionLogger(action)
+
+	if cancel == nil {
+		errMsg := fmt.Sprintf("no start is running for prize: %v", action.PrizeID)
+		sendWinnersResponse(c, action, []Participant{}, errMsg)
+		l.Warn(errMsg)
+		countActionError(action.Name)
+		return errMsg
+	}
+	if cause == errDrawAborted {
+		drawsAborted.Inc()
+	} else {
+		drawsStopped.Inc()
+	}
+	cancel(cause)
+	<-runningDone
+	// Set cancel to nil
+	cancel = nil
+	runningRequestID, runningDone = "", nil
+	l.Info(action.Name, "prize_id", action.PrizeID)
+	return ""
 }
 
-func getBlacklistIDs(blacklists []Blacklist, prizeIndex int) map[string]string {
-	m := map[string]string{}
+func getPrizes(c *Client, a Action) error {
+	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: a}
+	res := PrizesResponse{commonRes, currentConfig().Prizes}
 
-	if len(blacklists) <= 0 {
-		return m
-	}
+	return sendResponse(c, res)
+}
 
-	for _, blacklist := range blacklists {
-		// Prizes are sorted by level(DESC order).
-		// Blacklist.MaxPrizeIndex means:
-		// the participants can not participate the lottery which prize index > MaxPrizeIndex.
-		// e.g.
-		// "prizes": [ {"name":"3rd prize", "num": 10}, {"name":"2nd prize", "num": 5}, {"name":"1st prize", "num": 1} ]
-		// "blacklists": [ {"max_prize_index":1, "ids": "0"} ]
-		// participants csv:
-		// 1,Frank
-		// 2,Bob
-		// 3,Tom
-		// ......
-		// It means "Frank" and "Bob" can only paticipate "3rd prize"(index = 0) and "2nd prize"(index = 1).
-		if prizeIndex <= blacklist.MaxPrizeIndex {
-			continue
-		}
+func getWinners(c *Client, a Action, mutex *sync.Mutex) error {
+	//mutex.Lock()
+	//defer mutex.Unlock()
 
-		for _, ID := range blacklist.IDs {
-			m[ID] = ID
-		}
-	}
+	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: a}
 
-	return m
+	res := WinnersResponse{commonRes, lot.Winners(a.PrizeID)}
+	return sendResponse(c, res)
 }
 
-func removeBlacklist(origin []Participant, blacklist map[string]string) []Participant {
-	updated := []Participant{}
+// start waits for the draw to stop and commits the winners, or discards them if the draw is aborted.
+func start(ctx context.Context, c *Client, a Action, d *lottery.Draw, mutex *sync.Mutex) {
+	var (
+		err     error
+		errMsg  = ""
+		winners = []Participant{}
+	)
 
-	for _, p := range origin {
-		found := false
-		for ID, _ := range blacklist {
-			if p.ID == ID {
-				found = true
-				break
-			}
-		}
-		if !found {
-			updated = append(updated, p)
-		}
-	}
-	return updated
-}
+	l := c.actionLogger(a)
 
-func needLottery(oldWinners []Participant, oldWinnerIndexes []int) (bool, error) {
-	nOldWinners := len(oldWinners)
+	mutex.Lock()
+	defer mutex.Unlock()
 
-	if nOldWinners == 0 {
-		// Winner indexes are not empty(want to re-lottery) for 1st time lottery.
-		if len(oldWinnerIndexes) != 0 {
-			return false, fmt.Errorf("1st time to lottery, invalid returned winner indexes")
-		}
-		// 1st time lottery.
-		return true, nil
-	} else {
-		// Older winners are not empty, it's re-lottery but with no winner indexes.
-		if len(oldWinnerIndexes) == 0 {
-			return false, nil
-		}
+	defer func() {
+		sendWinnersResponse(c, a, winners, errMsg)
+		eventFeed.publish(a.Name, genWinnersResponse(a, winners, errMsg))
+		recordHistory(a, winners, errMsg)
+		displayDrawResult(a, winners, errMsg)
+	}()
 
-		// Check if winner indexes are valid.
-		for _, idx := range oldWinnerIndexes {
-			if idx < 0 || idx >= nOldWinners {
-				return false, fmt.Errorf("invalid returned winner index: %v\n", idx)
-			}
-		}
-		// Re-lottery
-		return true, nil
+	<-d.Done()
+	if err = d.Err(); err != nil {
+		errMsg = err.Error()
+		l.Error(errMsg)
+		return
 	}
-}
-
-func getReturnedWinners(oldWinners []Participant, oldWinnerIndexes []int) []Participant {
-	returnedWinners := []Participant{}
 
-	l := len(oldWinners)
-	if l <= 0 {
-		return returnedWinners
-	}
+	if context.Cause(ctx) == errDrawAborted {
+		// Do not commit the winners. Committed winners(including the winners to re-lottery) are not changed.
+		a.Name = "abort"
+		errMsg = errDrawAborted.Error()
+		// Notify all clients, not only the client which started the draw.
+		c = nil
 
-	if len(oldWinnerIndexes) <= 0 {
-		return returnedWinners
+		l.Warn("draw aborted", "prize_id", a.PrizeID)
+		logWinnerResponse(a, winners, errMsg)
+		return
 	}
 
-	for _, idx := range oldWinnerIndexes {
-		if idx < 0 || idx >= l {
-			continue
-		}
+	// Modify action name when cancel() is called("stop" action received).
+	a.Name = "stop"
 
-		returnedWinners = append(returnedWinners, oldWinners[idx])
-		fmt.Printf("return winner: %v\n", oldWinners[idx])
+	if winners, err = lot.Commit(d); err != nil {
+		winners = []Participant{}
+		errMsg = fmt.Sprintf("commit error: %v", err)
+		l.Error(errMsg)
+		return
 	}
-	return returnedWinners
-}
-
-func getAvailableParticipantsAfterRemovedBlacklist(prizeIndex int, origin []Participant, blacklists []Blacklist) []Participant {
-	updatedAvailables := origin
-	blacklistIDs := getBlacklistIDs(blacklists, prizeIndex)
-	updatedAvailables = removeBlacklist(updatedAvailables, blacklistIDs)
-	return updatedAvailables
+	drawsCommitted.Inc()
+
+	l.Info("winners committed", "prize_id", a.PrizeID, "winners", participantList(winners))
+	saveDraw(a, d.Drawn(), winners)
+
+	// log winners response
+	logWinnerResponse(a, winners, errMsg)
+
+	// The prize of the draw, the config may be changed after the action is received.
+	notifyDrawCommitted(DrawEvent{
+		Event:            "draw_committed",
+		Time:             time.Now(),
+		PrizeID:          d.PrizeID,
+		PrizeIndex:       d.PrizeIndex,
+		Prize:            d.Prize,
+		OldWinnerIndexes: a.OldWinnerIndexes,
+		Drawn:            d.Drawn(),
+		Winners:          append([]Participant{}, winners...),
+	})
 }
 
 func genWinnersResponse(a Action, winners []Participant, errMsg string) WinnersResponse {
@@ -509,8 +426,13 @@ func genWinnersResponse(a Action, winners []Participant, errMsg string) WinnersR
 	return WinnersResponse{CommonResponse: commonRes, Winners: winners}
 }
 
+// sendWinnersResponse sends the response to the client, or all clients if c is nil.
 func sendWinnersResponse(c *Client, a Action, winners []Participant, errMsg string) {
 	res := genWinnersResponse(a, winners, errMsg)
+	if c == nil {
+		hub.broadcast(res)
+		return
+	}
 	sendResponse(c, res)
 }
 
@@ -518,41 +440,3 @@ func logWinnerResponse(a Action, winners []Participant, errMsg string) error {
 	res := genWinnersResponse(a, winners, errMsg)
 	return logResponse(res)
 }
-
-func validate(prizes []Prize, prizeIndex int, oldWinners []Participant, oldWinnerIndexes []int) error {
-	need, err := needLottery(oldWinners, oldWinnerIndexes)
-	if err != nil {
-		return fmt.Errorf("needLottery() error: %v\n", err)
-	}
-
-	if !need {
-		return fmt.Errorf("no need")
-	}
-
-	fmt.Printf("need = true\n")
-
-	if len(prizes) <= 0 {
-		return fmt.Errorf("no prizes")
-	}
-
-	if prizeIndex < 0 || prizeIndex >= len(prizes) {
-		return fmt.Errorf("prize index error")
-	}
-
-	return nil
-}
-
-func getPrizeNum(prizes []Prize, prizeIndex int, oldWinnerIndexes []int) (int, error) {
-	prizeNum := 0
-	if len(oldWinnerIndexes) > 0 {
-		prizeNum = len(oldWinnerIndexes)
-	} else {
-		prizeNum = prizes[prizeIndex].Num
-	}
-
-	if prizeNum <= 0 {
-		return 0, fmt.Errorf("no prizes for prize index: %v\n", prizeIndex)
-	}
-
-	return prizeNum, nil
-}
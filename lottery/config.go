@@ -0,0 +1,240 @@
+package lottery
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Prize struct {
+	// ID is the stable ID of the prize. It's generated if it's empty(old format), see NormalizeConfig.
+	ID string `json:"id"`
+	// Tier is the level of the prize, higher tiers are more valuable.
+	// Tiers are the indexes of prizes if no tier is set(old format).
+	Tier    int    `json:"tier"`
+	Name    string `json:"name"`
+	Num     int    `json:"num"`
+	Content string `json:"content"`
+
+	// URLs of media shown on the display, e.g. "/media/xxx.png" returned by /api/media.
+	Image       string `json:"image,omitempty"`
+	Video       string `json:"video,omitempty"`
+	SponsorLogo string `json:"sponsor_logo,omitempty"`
+
+	// Theme overrides the default theme of the config.
+	Theme *Theme `json:"theme,omitempty"`
+
+	// SKU of the inventory item. Prizes with the same SKU share the stock.
+	// The stock is not tracked if it's empty.
+	SKU string `json:"sku,omitempty"`
+
+	// Policy decides who can win the prize by the prizes they've won:
+	// "exclusive"(default) for participants who have not won any prize,
+	// "repeat" for all participants, "max_wins" for participants who have won less than MaxWins prizes,
+	// "category" for participants who have not won any prize of the same category.
+	// Winners of the prize can't win it again in any case.
+	Policy   string `json:"policy,omitempty"`
+	MaxWins  int    `json:"max_wins,omitempty"`
+	Category string `json:"category,omitempty"`
+
+	// Quotas limit the number of winners by attributes of participants,
+	// e.g. at least 1 winner per office, or at most 30% of winners from one department.
+	Quotas []Quota `json:"quotas,omitempty"`
+}
+
+// Theme contains colors(CSS colors) and background image of the display.
+// Empty fields fall back to the default theme.
+type Theme struct {
+	Background      string `json:"background,omitempty"`
+	Foreground      string `json:"foreground,omitempty"`
+	Accent          string `json:"accent,omitempty"`
+	BackgroundImage string `json:"background_image,omitempty"`
+}
+
+// Blacklist limits the prizes which the participants can win.
+type Blacklist struct {
+	// The participants can't win prizes which tier > MaxTier.
+	MaxTier *int `json:"max_tier,omitempty"`
+	// The participants can't win the prizes.
+	PrizeIDs []string `json:"prize_ids,omitempty"`
+	// IDs of the participants.
+	IDs []string `json:"ids"`
+
+	// MaxPrizeIndex is the old format of MaxTier.
+	// It's converted to the tier of the prize when the config is loaded, see NormalizeConfig.
+	MaxPrizeIndex *int `json:"max_prize_index,omitempty"`
+}
+
+type Config struct {
+	Prizes     []Prize     `json:"prizes"`
+	Blacklists []Blacklist `json:"blacklists"`
+	// Default theme of the display.
+	Theme *Theme `json:"theme,omitempty"`
+	// Inventory of prizes.
+	Inventory []InventoryItem `json:"inventory,omitempty"`
+}
+
+// NormalizeConfig migrates the config of the old format which relies on the order of prizes:
+// prizes without IDs get generated IDs("prize-<index>"), tiers are the indexes if no tier is set,
+// and max_prize_index of blacklists is converted to max_tier(tier of the prize).
+func NormalizeConfig(config *Config) {
+	IDs := map[string]bool{}
+	tiered := false
+	for _, p := range config.Prizes {
+		if p.ID != "" {
+			IDs[p.ID] = true
+		}
+		if p.Tier != 0 {
+			tiered = true
+		}
+	}
+
+	for i := range config.Prizes {
+		p := &config.Prizes[i]
+		if p.ID == "" {
+			p.ID = fmt.Sprintf("prize-%v", i)
+			for n := 1; IDs[p.ID]; n++ {
+				p.ID = fmt.Sprintf("prize-%v-%v", i, n)
+			}
+			IDs[p.ID] = true
+		}
+		if !tiered {
+			p.Tier = i
+		}
+	}
+
+	for i := range config.Blacklists {
+		b := &config.Blacklists[i]
+		if b.MaxPrizeIndex == nil || b.MaxTier != nil {
+			continue
+		}
+		// Keep invalid index to be reported by ValidateConfig.
+		if *b.MaxPrizeIndex < 0 || *b.MaxPrizeIndex >= len(config.Prizes) {
+			continue
+		}
+		tier := config.Prizes[*b.MaxPrizeIndex].Tier
+		b.MaxTier = &tier
+		b.MaxPrizeIndex = nil
+	}
+}
+
+// PrizeIndex returns the index of the prize, or -1 if it's not found.
+func PrizeIndex(prizes []Prize, ID string) int {
+	for i, p := range prizes {
+		if p.ID == ID {
+			return i
+		}
+	}
+	return -1
+}
+
+// ValidateConfig validates prizes, blacklists and participants and returns all errors.
+// Participant IDs are not included in errors, they may be sensitive.
+func ValidateConfig(config Config, participants []Participant) error {
+	var errs []error
+
+	if len(participants) == 0 {
+		errs = append(errs, fmt.Errorf("participants: empty"))
+	}
+
+	IDs := map[string]int{}
+	for i, p := range participants {
+		if p.ID == "" {
+			errs = append(errs, fmt.Errorf("participants[%v]: empty id", i))
+			continue
+		}
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("participants[%v]: empty name", i))
+		}
+		if j, ok := IDs[p.ID]; ok {
+			errs = append(errs, fmt.Errorf("participants[%v]: duplicate id(participants[%v])", i, j))
+			continue
+		}
+		IDs[p.ID] = i
+	}
+
+	if len(config.Prizes) == 0 {
+		errs = append(errs, fmt.Errorf("prizes: empty"))
+	}
+
+	SKUs := map[string]int{}
+	for i, item := range config.Inventory {
+		if item.SKU == "" {
+			errs = append(errs, fmt.Errorf("inventory[%v]: empty sku", i))
+			continue
+		}
+		if j, ok := SKUs[item.SKU]; ok {
+			errs = append(errs, fmt.Errorf("inventory[%v]: duplicate sku %v(inventory[%v])", i, item.SKU, j))
+			continue
+		}
+		SKUs[item.SKU] = i
+
+		if item.Quantity < 0 {
+			errs = append(errs, fmt.Errorf("inventory[%v]: quantity should be >= 0", i))
+		}
+		if item.UnitValue < 0 {
+			errs = append(errs, fmt.Errorf("inventory[%v]: unit_value should be >= 0", i))
+		}
+		if item.UnitValue > 0 && item.Currency == "" {
+			errs = append(errs, fmt.Errorf("inventory[%v]: empty currency", i))
+		}
+	}
+
+	prizeIDs := map[string]int{}
+	for i, p := range config.Prizes {
+		if p.ID == "" {
+			errs = append(errs, fmt.Errorf("prizes[%v]: empty id", i))
+		} else if j, ok := prizeIDs[p.ID]; ok {
+			errs = append(errs, fmt.Errorf("prizes[%v]: duplicate id %v(prizes[%v])", i, p.ID, j))
+		} else {
+			prizeIDs[p.ID] = i
+		}
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("prizes[%v]: empty name", i))
+		}
+		if p.Num <= 0 {
+			errs = append(errs, fmt.Errorf("prizes[%v]: num should be > 0", i))
+		}
+		if _, ok := SKUs[p.SKU]; p.SKU != "" && !ok {
+			errs = append(errs, fmt.Errorf("prizes[%v]: unknown sku %v", i, p.SKU))
+		}
+		if err := validatePolicy(p); err != nil {
+			errs = append(errs, fmt.Errorf("prizes[%v]: %v", i, err))
+		}
+		for j, q := range p.Quotas {
+			if err := validateQuota(q); err != nil {
+				errs = append(errs, fmt.Errorf("prizes[%v].quotas[%v]: %v", i, j, err))
+			} else if len(attrValues(participants, q.Attr)) == 0 {
+				errs = append(errs, fmt.Errorf("prizes[%v].quotas[%v]: no participant has attr %v", i, j, q.Attr))
+			} else if q.MaxPercent > 0 && maxByPercent(q.MaxPercent, p.Num) == 0 {
+				// The group could never win the prize.
+				errs = append(errs, fmt.Errorf("prizes[%v].quotas[%v]: max_percent %v of %v winners is 0(rounded down)", i, j, q.MaxPercent, p.Num))
+			}
+		}
+	}
+
+	for i, b := range config.Blacklists {
+		// max_prize_index is converted to max_tier by NormalizeConfig if it's valid.
+		if b.MaxPrizeIndex != nil {
+			if b.MaxTier != nil {
+				errs = append(errs, fmt.Errorf("blacklists[%v]: max_prize_index and max_tier can't be set together", i))
+			} else {
+				errs = append(errs, fmt.Errorf("blacklists[%v]: max_prize_index %v is out of range [0, %v)", i, *b.MaxPrizeIndex, len(config.Prizes)))
+			}
+		}
+		if b.MaxTier == nil && b.MaxPrizeIndex == nil && len(b.PrizeIDs) == 0 {
+			errs = append(errs, fmt.Errorf("blacklists[%v]: max_tier or prize_ids is required", i))
+		}
+		for j, ID := range b.PrizeIDs {
+			if _, ok := prizeIDs[ID]; !ok {
+				errs = append(errs, fmt.Errorf("blacklists[%v].prize_ids[%v]: unknown prize id %v", i, j, ID))
+			}
+		}
+		for j, ID := range b.IDs {
+			if _, ok := IDs[ID]; !ok {
+				errs = append(errs, fmt.Errorf("blacklists[%v].ids[%v]: unknown participant id", i, j))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
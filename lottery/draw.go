@@ -0,0 +1,457 @@
+package lottery
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DrawOptions are options of a draw.
+type DrawOptions struct {
+	// Indexes of old winners of the prize to re-lottery, see Redraw.
+	OldWinnerIndexes []int
+	// Interval between rounds. If it's > 0, rounds are drawn every interval until ctx of the draw is done
+	// (names rolling on screens). Otherwise only one round is drawn.
+	Interval time.Duration
+	// OnRound is called with the winners of each round(merged into old winners for re-lottery).
+	// It's called in the goroutine of the draw except the first round.
+	OnRound func(winners []Participant)
+}
+
+// Draw is a draw of a prize. The winners of its last round are committed by Lottery.Commit.
+type Draw struct {
+	PrizeID    string
+	PrizeIndex int
+	// Prize is the prize in the config when the draw started.
+	// The draw can only be committed if the config is not changed.
+	Prize            Prize
+	OldWinnerIndexes []int
+	// Num is the number of winners to draw.
+	Num int
+	// Eligible is the number of eligible participants.
+	Eligible int
+
+	// Version of the lottery when the draw started.
+	version int
+	// Copy of the winners of the prize when the draw started. Rounds never change the winners of the lottery,
+	// they're replaced by Commit only, so that a draw which is not committed(e.g. aborted or failed) leaves them untouched.
+	oldWinners []Participant
+	pool       []Participant
+	groups     []quotaGroup
+	opts       DrawOptions
+
+	done chan struct{}
+	mu   sync.Mutex
+	// Winners of the last round.
+	drawn []Participant
+	err   error
+}
+
+// Done returns a channel which is closed when the draw stops rolling:
+// ctx of the draw is done or a round fails.
+func (d *Draw) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the error of the round which stopped the draw.
+func (d *Draw) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.err
+}
+
+// Drawn returns the winners of the last round(not merged into old winners).
+func (d *Draw) Drawn() []Participant {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Participant{}, d.drawn...)
+}
+
+// Draw starts a draw of the prize: it validates the draw, draws the first round and returns.
+// Rounds are drawn in a goroutine until ctx is done if opts.Interval > 0.
+// If the prize has winners and no old winner indexes are set, the rest of the prize is drawn(e.g. it was short of stock).
+func (l *Lottery) Draw(ctx context.Context, prizeID string, opts DrawOptions) (*Draw, error) {
+	l.mu.Lock()
+	d, err := l.newDraw(prizeID, opts)
+	l.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.round(); err != nil {
+		return nil, err
+	}
+
+	if opts.Interval <= 0 {
+		close(d.done)
+		return d, nil
+	}
+
+	go d.roll(ctx)
+	return d, nil
+}
+
+// Redraw starts a re-lottery of the old winners of the prize at the indexes.
+func (l *Lottery) Redraw(ctx context.Context, prizeID string, oldWinnerIndexes []int, opts DrawOptions) (*Draw, error) {
+	opts.OldWinnerIndexes = oldWinnerIndexes
+	return l.Draw(ctx, prizeID, opts)
+}
+
+// newDraw validates and prepares the draw. The caller should hold l.mu.
+func (l *Lottery) newDraw(prizeID string, opts DrawOptions) (*Draw, error) {
+	prizeIndex := PrizeIndex(l.config.Prizes, prizeID)
+	oldWinners := append([]Participant{}, l.winners[prizeID]...)
+
+	if err := validate(l.config.Prizes, prizeIndex, oldWinners, opts.OldWinnerIndexes); err != nil {
+		return nil, fmt.Errorf("validate() error: %v", err)
+	}
+
+	prizeNum, err := getPrizeNum(l.config.Prizes, prizeIndex, oldWinners, opts.OldWinnerIndexes, remainingStock(l.config, l.winners, prizeIndex))
+	if err != nil {
+		return nil, fmt.Errorf("getPrizeNum() error: %v", err)
+	}
+
+	// Return older winners for re-lottery.
+	returned := getReturnedWinners(oldWinners, opts.OldWinnerIndexes)
+
+	// Eligible participants are derived from the winners of all prizes by the policy of the prize.
+	pool := eligibleParticipants(l.config, l.participants, l.winners, prizeIndex, returned)
+
+	// Kept winners(not re-lotteried) count towards quotas of the prize.
+	n := prizeNum
+	if len(pool) < n {
+		n = len(pool)
+	}
+	kept := removeWinners(oldWinners, returned)
+	groups := newQuotaGroups(l.config.Prizes[prizeIndex].Quotas, l.participants, kept, len(kept)+n)
+	if err = checkQuotas(n, pool, groups); err != nil {
+		return nil, fmt.Errorf("quotas error: %v", err)
+	}
+
+	return &Draw{
+		PrizeID:          prizeID,
+		PrizeIndex:       prizeIndex,
+		Prize:            l.config.Prizes[prizeIndex],
+		OldWinnerIndexes: opts.OldWinnerIndexes,
+		Num:              prizeNum,
+		Eligible:         len(pool),
+		version:          l.version,
+		oldWinners:       oldWinners,
+		pool:             pool,
+		groups:           groups,
+		opts:             opts,
+		done:             make(chan struct{}),
+	}, nil
+}
+
+// roll draws rounds every interval until ctx is done or a round fails.
+func (d *Draw) roll(ctx context.Context) {
+	defer close(d.done)
+
+	t := time.NewTicker(d.opts.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := d.round(); err != nil {
+			d.mu.Lock()
+			d.err = err
+			d.mu.Unlock()
+			return
+		}
+	}
+}
+
+// round draws a round and calls OnRound with the winners.
+func (d *Draw) round() error {
+	d.mu.Lock()
+	winners, pool, err := round(d.Num, d.pool, d.drawn, d.groups)
+	if err != nil {
+		d.mu.Unlock()
+		return fmt.Errorf("round() error: %v", err)
+	}
+	d.drawn, d.pool = winners, pool
+	d.mu.Unlock()
+
+	// Update winners for relottery
+	merged := winners
+	if len(d.oldWinners) > 0 && len(d.OldWinnerIndexes) > 0 {
+		if merged, err = updateRelotteryWinners(d.oldWinners, d.OldWinnerIndexes, winners); err != nil {
+			return fmt.Errorf("relottery error: %v", err)
+		}
+	}
+
+	if d.opts.OnRound != nil {
+		d.opts.OnRound(merged)
+	}
+	return nil
+}
+
+// updateRelotteryWinners returns the winners which need to relottery previous prize.
+// It replaces old winners (specified in old winner indexes) with new winners in a copy, oldWinners is not changed.
+func updateRelotteryWinners(oldWinners []Participant, relotteryOldWinnerIndexes []int, relotteryWinners []Participant) ([]Participant, error) {
+	if len(relotteryWinners) != len(relotteryOldWinnerIndexes) {
+		return []Participant{}, fmt.Errorf("len(relottery winners) != len(relottery old winner indexes)")
+	}
+
+	// Update winners with relottery winners
+	winners := append([]Participant{}, oldWinners...)
+	for i, idx := range relotteryOldWinnerIndexes {
+		if idx < 0 || idx >= len(winners) {
+			return []Participant{}, fmt.Errorf("invalid returned winner index: %v", idx)
+		}
+		winners[idx] = relotteryWinners[i]
+	}
+
+	// return updated winners
+	return winners, nil
+}
+
+func removeWinners(origin []Participant, winners []Participant) []Participant {
+	var updated []Participant
+	for _, p := range origin {
+		found := false
+
+		for _, w := range winners {
+			if p.ID == w.ID {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			updated = append(updated, p)
+		}
+	}
+
+	return updated
+}
+
+func verifyWinners(winners []Participant) bool {
+	m := map[string]Participant{}
+
+	for _, p := range winners {
+		if _, ok := m[p.ID]; ok {
+			return false
+		}
+		m[p.ID] = p
+	}
+	return true
+}
+
+// round draws prizeNum winners randomly. Winners of the last round(oldWinners) are returned to availables first.
+// Winners satisfy the quotas if quotaGroups is not empty.
+func round(prizeNum int, availables []Participant, oldWinners []Participant, quotaGroups []quotaGroup) ([]Participant, []Participant, error) {
+	winners := []Participant{}
+
+	availables = append(availables, oldWinners...)
+
+	if prizeNum <= 0 {
+		return winners, availables, fmt.Errorf("incorrect prize number")
+	}
+
+	m := len(availables)
+	if m <= 0 {
+		return winners, availables, fmt.Errorf("no participants")
+	}
+
+	// Set prize num to m(number of participants),
+	// if number of participants is less than prize num:-).
+	if m < prizeNum {
+		prizeNum = m
+	}
+
+	if len(quotaGroups) > 0 {
+		var err error
+		if winners, err = drawWithQuotas(prizeNum, availables, quotaGroups); err != nil {
+			return []Participant{}, availables, err
+		}
+		availables = removeWinners(availables, winners)
+	} else {
+		for i := 0; i < prizeNum; i++ {
+			idx := rand.Intn(len(availables))
+			winners = append(winners, availables[idx])
+			// Update participants
+			availables = append(availables[0:idx], availables[idx+1:]...)
+		}
+	}
+
+	valid := verifyWinners(winners)
+	if !valid {
+		return []Participant{}, availables, fmt.Errorf("invalid winners: %v", winners)
+	}
+
+	return winners, availables, nil
+}
+
+// getBlacklistIDs returns IDs of participants who can't win the prize.
+// e.g.
+// "prizes": [ {"id":"3rd", "tier":1, "num": 10}, {"id":"2nd", "tier":2, "num": 5}, {"id":"1st", "tier":3, "num": 1} ]
+// "blacklists": [ {"max_tier":2, "ids": ["1", "2"]}, {"prize_ids": ["2nd"], "ids": ["3"]} ]
+// participants csv:
+// 1,Frank
+// 2,Bob
+// 3,Tom
+// ......
+// It means "Frank" and "Bob" can only win "3rd" and "2nd"(tier <= 2), "Tom" can't win "2nd".
+func getBlacklistIDs(blacklists []Blacklist, prize Prize) map[string]string {
+	m := map[string]string{}
+
+	if len(blacklists) <= 0 {
+		return m
+	}
+
+	for _, blacklist := range blacklists {
+		excluded := blacklist.MaxTier != nil && prize.Tier > *blacklist.MaxTier
+		for _, ID := range blacklist.PrizeIDs {
+			if ID == prize.ID {
+				excluded = true
+			}
+		}
+
+		if !excluded {
+			continue
+		}
+
+		for _, ID := range blacklist.IDs {
+			m[ID] = ID
+		}
+	}
+
+	return m
+}
+
+func removeBlacklist(origin []Participant, blacklist map[string]string) []Participant {
+	updated := []Participant{}
+
+	for _, p := range origin {
+		found := false
+		for ID, _ := range blacklist {
+			if p.ID == ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			updated = append(updated, p)
+		}
+	}
+	return updated
+}
+
+func needLottery(oldWinners []Participant, oldWinnerIndexes []int) (bool, error) {
+	nOldWinners := len(oldWinners)
+
+	if nOldWinners == 0 {
+		// Winner indexes are not empty(want to re-lottery) for 1st time lottery.
+		if len(oldWinnerIndexes) != 0 {
+			return false, fmt.Errorf("1st time to lottery, invalid returned winner indexes")
+		}
+		// 1st time lottery.
+		return true, nil
+	} else {
+		// Older winners are not empty, it's re-lottery but with no winner indexes.
+		if len(oldWinnerIndexes) == 0 {
+			return false, nil
+		}
+
+		// Check if winner indexes are valid.
+		for _, idx := range oldWinnerIndexes {
+			if idx < 0 || idx >= nOldWinners {
+				return false, fmt.Errorf("invalid returned winner index: %v\n", idx)
+			}
+		}
+		// Re-lottery
+		return true, nil
+	}
+}
+
+func getReturnedWinners(oldWinners []Participant, oldWinnerIndexes []int) []Participant {
+	returnedWinners := []Participant{}
+
+	l := len(oldWinners)
+	if l <= 0 {
+		return returnedWinners
+	}
+
+	if len(oldWinnerIndexes) <= 0 {
+		return returnedWinners
+	}
+
+	for _, idx := range oldWinnerIndexes {
+		if idx < 0 || idx >= l {
+			continue
+		}
+
+		returnedWinners = append(returnedWinners, oldWinners[idx])
+	}
+	return returnedWinners
+}
+
+func validate(prizes []Prize, prizeIndex int, oldWinners []Participant, oldWinnerIndexes []int) error {
+	if len(prizes) <= 0 {
+		return fmt.Errorf("no prizes")
+	}
+
+	if prizeIndex < 0 || prizeIndex >= len(prizes) {
+		return fmt.Errorf("prize index error")
+	}
+
+	// Winners drawn for the same index would replace each other and be dropped by the commit.
+	seen := map[int]bool{}
+	for _, idx := range oldWinnerIndexes {
+		if seen[idx] {
+			return fmt.Errorf("duplicate returned winner index: %v", idx)
+		}
+		seen[idx] = true
+	}
+
+	need, err := needLottery(oldWinners, oldWinnerIndexes)
+	if err != nil {
+		return fmt.Errorf("needLottery() error: %v\n", err)
+	}
+
+	// The prize was short of stock(or its num was increased), draw for the rest.
+	if !need && len(oldWinnerIndexes) == 0 && len(oldWinners) < prizes[prizeIndex].Num {
+		need = true
+	}
+
+	if !need {
+		return fmt.Errorf("no need")
+	}
+
+	return nil
+}
+
+// getPrizeNum returns the number of winners to draw.
+// Re-lottery does not consume the stock, otherwise it's the rest of the prize capped by the stock(< 0 if it's not tracked).
+func getPrizeNum(prizes []Prize, prizeIndex int, oldWinners []Participant, oldWinnerIndexes []int, stock int) (int, error) {
+	prizeNum := 0
+	if len(oldWinnerIndexes) > 0 {
+		prizeNum = len(oldWinnerIndexes)
+	} else {
+		prizeNum = prizes[prizeIndex].Num - len(oldWinners)
+		if stock >= 0 && prizeNum > stock {
+			if stock == 0 {
+				return 0, fmt.Errorf("out of stock: %v", prizes[prizeIndex].SKU)
+			}
+			prizeNum = stock
+		}
+	}
+
+	if prizeNum <= 0 {
+		return 0, fmt.Errorf("no prizes for prize index: %v\n", prizeIndex)
+	}
+
+	return prizeNum, nil
+}
@@ -0,0 +1,295 @@
+package lottery
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testParticipants(n int) []Participant {
+	participants := []Participant{}
+	for i := 1; i <= n; i++ {
+		participants = append(participants, Participant{ID: fmt.Sprint(i), Name: fmt.Sprintf("P%v", i)})
+	}
+	return participants
+}
+
+func testPrizes() []Prize {
+	return []Prize{
+		{ID: "3rd", Tier: 1, Name: "3rd", Num: 3},
+		{ID: "2nd", Tier: 2, Name: "2nd", Num: 2},
+		{ID: "1st", Tier: 3, Name: "1st", Num: 1},
+	}
+}
+
+func ids(participants []Participant) []string {
+	s := []string{}
+	for _, p := range participants {
+		s = append(s, p.ID)
+	}
+	return s
+}
+
+func TestNeedLottery(t *testing.T) {
+	winners := testParticipants(3)
+
+	tests := []struct {
+		name       string
+		oldWinners []Participant
+		indexes    []int
+		need       bool
+		err        bool
+	}{
+		{"first draw", nil, nil, true, false},
+		{"first draw with indexes", nil, []int{0}, false, true},
+		{"drawn", winners, nil, false, false},
+		{"re-lottery", winners, []int{0, 2}, true, false},
+		{"negative index", winners, []int{-1}, false, true},
+		{"index out of range", winners, []int{3}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			need, err := needLottery(tt.oldWinners, tt.indexes)
+			if (err != nil) != tt.err {
+				t.Fatalf("needLottery() error = %v, want error: %v", err, tt.err)
+			}
+			if need != tt.need {
+				t.Errorf("needLottery() = %v, want %v", need, tt.need)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	prizes := testPrizes()
+
+	tests := []struct {
+		name       string
+		prizes     []Prize
+		prizeIndex int
+		oldWinners []Participant
+		indexes    []int
+		err        string
+	}{
+		{"first draw", prizes, 0, nil, nil, ""},
+		{"no prizes", nil, 0, nil, nil, "no prizes"},
+		{"prize index out of range", prizes, 3, nil, nil, "prize index error"},
+		{"negative prize index", prizes, -1, nil, nil, "prize index error"},
+		{"drawn", prizes, 0, testParticipants(3), nil, "no need"},
+		{"rest of the prize", prizes, 0, testParticipants(2), nil, ""},
+		{"re-lottery", prizes, 0, testParticipants(3), []int{1}, ""},
+		{"invalid index", prizes, 0, testParticipants(3), []int{5}, "needLottery() error"},
+		{"duplicate indexes", prizes, 0, testParticipants(3), []int{0, 2, 0}, "duplicate returned winner index: 0"},
+		{"first draw with indexes", prizes, 0, nil, []int{0}, "needLottery() error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(tt.prizes, tt.prizeIndex, tt.oldWinners, tt.indexes)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("validate() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestGetPrizeNum(t *testing.T) {
+	prizes := testPrizes()
+	prizes[0].SKU = "mug"
+
+	tests := []struct {
+		name       string
+		prizeIndex int
+		oldWinners []Participant
+		indexes    []int
+		stock      int
+		num        int
+		err        bool
+	}{
+		{"first draw", 0, nil, nil, -1, 3, false},
+		{"rest of the prize", 0, testParticipants(1), nil, -1, 2, false},
+		{"re-lottery", 0, testParticipants(3), []int{0, 2}, -1, 2, false},
+		{"re-lottery without stock", 0, testParticipants(3), []int{1}, 0, 1, false},
+		{"short of stock", 0, nil, nil, 2, 2, false},
+		{"enough stock", 0, nil, nil, 5, 3, false},
+		{"out of stock", 0, nil, nil, 0, 0, true},
+		{"drawn", 2, testParticipants(1), nil, -1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			num, err := getPrizeNum(prizes, tt.prizeIndex, tt.oldWinners, tt.indexes, tt.stock)
+			if (err != nil) != tt.err {
+				t.Fatalf("getPrizeNum() error = %v, want error: %v", err, tt.err)
+			}
+			if num != tt.num {
+				t.Errorf("getPrizeNum() = %v, want %v", num, tt.num)
+			}
+		})
+	}
+}
+
+func TestUpdateRelotteryWinners(t *testing.T) {
+	p := testParticipants(6)
+
+	tests := []struct {
+		name       string
+		oldWinners []Participant
+		indexes    []int
+		winners    []Participant
+		want       []string
+		err        bool
+	}{
+		{"one", p[:3], []int{1}, p[3:4], []string{"1", "4", "3"}, false},
+		{"two", p[:3], []int{2, 0}, p[3:5], []string{"5", "2", "4"}, false},
+		{"all", p[:3], []int{0, 1, 2}, p[3:6], []string{"4", "5", "6"}, false},
+		{"length mismatch", p[:3], []int{0, 1}, p[3:4], nil, true},
+		{"index out of range", p[:3], []int{3}, p[3:4], nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldWinners := append([]Participant{}, tt.oldWinners...)
+			got, err := updateRelotteryWinners(oldWinners, tt.indexes, tt.winners)
+			if (err != nil) != tt.err {
+				t.Fatalf("updateRelotteryWinners() error = %v, want error: %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Errorf("updateRelotteryWinners() = %v, want %v", ids(got), tt.want)
+			}
+			if !reflect.DeepEqual(oldWinners, tt.oldWinners) {
+				t.Errorf("updateRelotteryWinners() changed old winners: %v, want %v", ids(oldWinners), ids(tt.oldWinners))
+			}
+		})
+	}
+}
+
+func TestGetBlacklistIDs(t *testing.T) {
+	prizes := testPrizes()
+	maxTier := 2
+	blacklists := []Blacklist{
+		{MaxTier: &maxTier, IDs: []string{"1", "2"}},
+		{PrizeIDs: []string{"2nd"}, IDs: []string{"3"}},
+	}
+
+	tests := []struct {
+		name       string
+		blacklists []Blacklist
+		prize      Prize
+		want       []string
+	}{
+		{"no blacklists", nil, prizes[2], nil},
+		{"under max tier", blacklists, prizes[0], nil},
+		{"prize ID", blacklists, prizes[1], []string{"3"}},
+		{"over max tier", blacklists, prizes[2], []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := getBlacklistIDs(tt.blacklists, tt.prize)
+			if len(m) != len(tt.want) {
+				t.Fatalf("getBlacklistIDs() = %v, want %v", m, tt.want)
+			}
+			for _, ID := range tt.want {
+				if _, ok := m[ID]; !ok {
+					t.Errorf("getBlacklistIDs() = %v, want %v", m, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRound(t *testing.T) {
+	t.Run("winners", func(t *testing.T) {
+		pool := testParticipants(10)
+		for i := 0; i < 100; i++ {
+			winners, availables, err := round(3, append([]Participant{}, pool...), nil, nil)
+			if err != nil {
+				t.Fatalf("round() error: %v", err)
+			}
+			if len(winners) != 3 || len(availables) != 7 {
+				t.Fatalf("round() = %v winners, %v availables, want 3, 7", len(winners), len(availables))
+			}
+			if !verifyWinners(append(winners, availables...)) {
+				t.Fatalf("round() winners %v overlap availables %v", ids(winners), ids(availables))
+			}
+		}
+	})
+
+	t.Run("winners of the last round are returned", func(t *testing.T) {
+		pool := testParticipants(5)
+		winners, availables, err := round(2, pool, nil, nil)
+		if err != nil {
+			t.Fatalf("round() error: %v", err)
+		}
+
+		winners, availables, err = round(2, availables, winners, nil)
+		if err != nil {
+			t.Fatalf("round() error: %v", err)
+		}
+		if len(winners)+len(availables) != 5 || !verifyWinners(append(winners, availables...)) {
+			t.Fatalf("round() = %v, %v, want 5 distinct participants", ids(winners), ids(availables))
+		}
+	})
+
+	t.Run("fewer participants than the prize", func(t *testing.T) {
+		winners, availables, err := round(5, testParticipants(2), nil, nil)
+		if err != nil {
+			t.Fatalf("round() error: %v", err)
+		}
+		if len(winners) != 2 || len(availables) != 0 {
+			t.Fatalf("round() = %v winners, %v availables, want 2, 0", len(winners), len(availables))
+		}
+	})
+
+	t.Run("no participants", func(t *testing.T) {
+		if _, _, err := round(1, nil, nil, nil); err == nil {
+			t.Fatalf("round() error = nil, want error")
+		}
+	})
+
+	t.Run("incorrect prize number", func(t *testing.T) {
+		if _, _, err := round(0, testParticipants(3), nil, nil); err == nil {
+			t.Fatalf("round() error = nil, want error")
+		}
+	})
+
+	t.Run("quotas", func(t *testing.T) {
+		pool := testParticipants(10)
+		for i := range pool {
+			office := "SH"
+			if i < 2 {
+				office = "BJ"
+			}
+			pool[i].Attrs = map[string]string{"office": office}
+		}
+		groups := newQuotaGroups([]Quota{{Attr: "office", Value: "BJ", Min: 2}}, pool, nil, 3)
+
+		for i := 0; i < 50; i++ {
+			winners, _, err := round(3, append([]Participant{}, pool...), nil, groups)
+			if err != nil {
+				t.Fatalf("round() error: %v", err)
+			}
+			bj := 0
+			for _, w := range winners {
+				if w.Attrs["office"] == "BJ" {
+					bj++
+				}
+			}
+			if bj != 2 {
+				t.Fatalf("round() = %v, want 2 winners of BJ", ids(winners))
+			}
+		}
+	})
+}
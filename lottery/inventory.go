@@ -0,0 +1,42 @@
+package lottery
+
+// InventoryItem is the stock of a prize item.
+type InventoryItem struct {
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	Sponsor   string  `json:"sponsor"`
+	UnitValue float64 `json:"unit_value"`
+	Currency  string  `json:"currency"`
+	// Quantity in stock, including the awarded ones. Increase it to top up the stock.
+	Quantity int `json:"quantity"`
+}
+
+// AwardedBySKU returns the number of winners of prizes with each SKU.
+func AwardedBySKU(config Config, winnerMap map[string][]Participant) map[string]int {
+	awarded := map[string]int{}
+	for ID, winners := range winnerMap {
+		if i := PrizeIndex(config.Prizes, ID); i >= 0 && config.Prizes[i].SKU != "" {
+			awarded[config.Prizes[i].SKU] += len(winners)
+		}
+	}
+	return awarded
+}
+
+// remainingStock returns the remaining stock of the prize, or -1 if the stock of the prize is not tracked.
+func remainingStock(config Config, winnerMap map[string][]Participant, prizeIndex int) int {
+	if prizeIndex < 0 || prizeIndex >= len(config.Prizes) || config.Prizes[prizeIndex].SKU == "" {
+		return -1
+	}
+
+	SKU := config.Prizes[prizeIndex].SKU
+	for _, item := range config.Inventory {
+		if item.SKU != SKU {
+			continue
+		}
+		if n := item.Quantity - AwardedBySKU(config, winnerMap)[SKU]; n > 0 {
+			return n
+		}
+		return 0
+	}
+	return -1
+}
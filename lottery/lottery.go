@@ -0,0 +1,166 @@
+// Package lottery is the draw engine of the lottery server.
+// It draws winners of prizes from participants by the policies, blacklists, quotas and stock of prizes,
+// and keeps the winners of prizes.
+//
+// A draw is started by Lottery.Draw(or Lottery.Redraw to re-lottery some winners) and rolls until its context is done,
+// then its winners are committed by Lottery.Commit:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	d, err := l.Draw(ctx, "1st", lottery.DrawOptions{Interval: 100 * time.Millisecond, OnRound: show})
+//	...
+//	cancel()
+//	winners, err := l.Commit(d)
+package lottery
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrStale is returned by Commit if the winners, config or participants are changed after the draw started.
+var ErrStale = errors.New("state changed after the draw started")
+
+// Lottery keeps the config, participants and winners of prizes. It's safe for concurrent use.
+type Lottery struct {
+	mu           sync.Mutex
+	config       Config
+	participants []Participant
+	// Winners of prizes by prize IDs.
+	winners map[string][]Participant
+	// Increased when the state is changed, to detect stale draws.
+	version int
+}
+
+// New normalizes and validates the config and returns a lottery without winners.
+func New(config Config, participants []Participant) (*Lottery, error) {
+	NormalizeConfig(&config)
+	if err := ValidateConfig(config, participants); err != nil {
+		return nil, err
+	}
+
+	return &Lottery{config: config, participants: append([]Participant{}, participants...), winners: map[string][]Participant{}}, nil
+}
+
+// Config returns the config.
+func (l *Lottery) Config() Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.config
+}
+
+// Participants returns a copy of the participants.
+func (l *Lottery) Participants() []Participant {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Participant{}, l.participants...)
+}
+
+// SetState replaces the config and participants. Winners are kept by prize IDs.
+// The caller should check the changes are safe, e.g. no prize with winners is removed.
+func (l *Lottery) SetState(config Config, participants []Participant) error {
+	NormalizeConfig(&config)
+	if err := ValidateConfig(config, participants); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.config, l.participants = config, append([]Participant{}, participants...)
+	l.version++
+	return nil
+}
+
+// Restore replaces the winners of prizes by prize IDs, e.g. winners loaded from a store after a restart.
+func (l *Lottery) Restore(winners map[string][]Participant) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.winners = map[string][]Participant{}
+	for ID, w := range winners {
+		l.winners[ID] = append([]Participant{}, w...)
+	}
+	l.version++
+}
+
+// Winners returns the winners of the prize.
+func (l *Lottery) Winners(prizeID string) []Participant {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Participant{}, l.winners[prizeID]...)
+}
+
+// AllWinners returns the winners of all prizes by prize IDs.
+func (l *Lottery) AllWinners() map[string][]Participant {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := map[string][]Participant{}
+	for ID, winners := range l.winners {
+		m[ID] = append([]Participant{}, winners...)
+	}
+	return m
+}
+
+// Eligible returns the participants who can win the prize by its policy and blacklists.
+func (l *Lottery) Eligible(prizeID string) ([]Participant, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := PrizeIndex(l.config.Prizes, prizeID)
+	if i < 0 {
+		return nil, fmt.Errorf("unknown prize: %v", prizeID)
+	}
+	return eligibleParticipants(l.config, l.participants, l.winners, i, nil), nil
+}
+
+// RemainingStock returns the remaining stock of the prize, or -1 if the stock of the prize is not tracked.
+func (l *Lottery) RemainingStock(prizeID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return remainingStock(l.config, l.winners, PrizeIndex(l.config.Prizes, prizeID))
+}
+
+// Commit waits for the draw to stop rolling and commits the winners of its last round.
+// For re-lottery, the old winners at the indexes are replaced. For the rest of the prize, winners are appended to old winners.
+// It returns all winners of the prize.
+//
+// Winners are only changed by Commit and all at once. A draw which is not committed, fails or is stale changes nothing.
+func (l *Lottery) Commit(d *Draw) ([]Participant, error) {
+	<-d.done
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d.version != l.version {
+		return nil, ErrStale
+	}
+
+	winners := d.Drawn()
+
+	// If old winners and old winner indexes(want to re-lottery) are not empty.
+	// Update winners for relottery
+	if len(d.oldWinners) > 0 && len(d.OldWinnerIndexes) > 0 {
+		var err error
+		if winners, err = updateRelotteryWinners(d.oldWinners, d.OldWinnerIndexes, winners); err != nil {
+			return nil, fmt.Errorf("relottery error: %v", err)
+		}
+	}
+
+	// Draw for the rest of the prize which was short of stock: append winners to old winners.
+	if len(d.OldWinnerIndexes) == 0 && len(d.oldWinners) > 0 {
+		winners = append(append([]Participant{}, d.oldWinners...), winners...)
+	}
+
+	l.winners[d.PrizeID] = winners
+	l.version++
+	return append([]Participant{}, winners...), nil
+}
@@ -0,0 +1,244 @@
+package lottery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestLottery(t *testing.T, config Config, n int) *Lottery {
+	t.Helper()
+
+	l, err := New(config, testParticipants(n))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return l
+}
+
+// drawOnce draws the prize with one round and commits the winners.
+func drawOnce(t *testing.T, l *Lottery, prizeID string, indexes []int) []Participant {
+	t.Helper()
+
+	d, err := l.Redraw(context.Background(), prizeID, indexes, DrawOptions{})
+	if err != nil {
+		t.Fatalf("Redraw(%v, %v) error: %v", prizeID, indexes, err)
+	}
+	winners, err := l.Commit(d)
+	if err != nil {
+		t.Fatalf("Commit(%v) error: %v", prizeID, err)
+	}
+	return winners
+}
+
+func TestDrawCommit(t *testing.T) {
+	l := newTestLottery(t, Config{Prizes: testPrizes()}, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rounds := make(chan []Participant, 100)
+	d, err := l.Draw(ctx, "3rd", DrawOptions{Interval: time.Millisecond, OnRound: func(winners []Participant) {
+		select {
+		case rounds <- winners:
+		default:
+		}
+	}})
+	if err != nil {
+		t.Fatalf("Draw() error: %v", err)
+	}
+	if d.Num != 3 || d.Eligible != 10 || d.PrizeIndex != 0 || d.Prize.ID != "3rd" {
+		t.Errorf("Draw() num = %v, eligible = %v, prize = %v(%v), want 3, 10, 3rd(0)", d.Num, d.Eligible, d.Prize.ID, d.PrizeIndex)
+	}
+
+	for i := 0; i < 3; i++ {
+		if winners := <-rounds; len(winners) != 3 {
+			t.Fatalf("round winners = %v, want 3", ids(winners))
+		}
+	}
+	cancel()
+
+	winners, err := l.Commit(d)
+	if err != nil {
+		t.Fatalf("Commit() error: %v", err)
+	}
+	if len(winners) != 3 || !verifyWinners(winners) {
+		t.Fatalf("Commit() = %v, want 3 distinct winners", ids(winners))
+	}
+	if got := l.Winners("3rd"); len(got) != 3 {
+		t.Errorf("Winners() = %v, want %v", ids(got), ids(winners))
+	}
+
+	if _, err = l.Draw(context.Background(), "3rd", DrawOptions{}); err == nil {
+		t.Errorf("Draw() of the drawn prize error = nil, want error")
+	}
+}
+
+func TestExclusivePolicy(t *testing.T) {
+	// 6 participants for 6 winners: everyone wins exactly one prize.
+	l := newTestLottery(t, Config{Prizes: testPrizes()}, 6)
+
+	won := map[string]string{}
+	for _, prize := range testPrizes() {
+		for _, w := range drawOnce(t, l, prize.ID, nil) {
+			if p, ok := won[w.ID]; ok {
+				t.Fatalf("%v won %v and %v", w.ID, p, prize.ID)
+			}
+			won[w.ID] = prize.ID
+		}
+	}
+	if len(won) != 6 {
+		t.Errorf("winners = %v, want 6", len(won))
+	}
+}
+
+func TestBlacklists(t *testing.T) {
+	maxTier := 1
+	config := Config{
+		Prizes:     testPrizes(),
+		Blacklists: []Blacklist{{MaxTier: &maxTier, IDs: []string{"1", "2"}}, {PrizeIDs: []string{"3rd"}, IDs: []string{"3"}}},
+	}
+	l := newTestLottery(t, config, 10)
+
+	tests := []struct {
+		prizeID  string
+		excluded []string
+	}{
+		{"3rd", []string{"3"}},
+		{"2nd", []string{"1", "2"}},
+		{"1st", []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		eligible, err := l.Eligible(tt.prizeID)
+		if err != nil {
+			t.Fatalf("Eligible(%v) error: %v", tt.prizeID, err)
+		}
+		for _, p := range eligible {
+			for _, ID := range tt.excluded {
+				if p.ID == ID {
+					t.Errorf("Eligible(%v) has blacklisted %v", tt.prizeID, ID)
+				}
+			}
+		}
+	}
+}
+
+func TestRedraw(t *testing.T) {
+	l := newTestLottery(t, Config{Prizes: testPrizes()}, 10)
+
+	old := drawOnce(t, l, "3rd", nil)
+	winners := drawOnce(t, l, "3rd", []int{1})
+
+	if len(winners) != 3 || !verifyWinners(winners) {
+		t.Fatalf("Redraw() = %v, want 3 distinct winners", ids(winners))
+	}
+	if winners[0].ID != old[0].ID || winners[2].ID != old[2].ID {
+		t.Errorf("Redraw([1]) = %v, kept winners of %v are changed", ids(winners), ids(old))
+	}
+
+	if _, err := l.Redraw(context.Background(), "3rd", []int{3}, DrawOptions{}); err == nil {
+		t.Errorf("Redraw([3]) error = nil, want error")
+	}
+	if _, err := l.Redraw(context.Background(), "3rd", []int{0, 0}, DrawOptions{}); err == nil {
+		t.Errorf("Redraw([0 0]) error = nil, want error")
+	}
+}
+
+func TestCommitStale(t *testing.T) {
+	config := Config{Prizes: testPrizes()}
+	l := newTestLottery(t, config, 10)
+
+	d, err := l.Draw(context.Background(), "3rd", DrawOptions{})
+	if err != nil {
+		t.Fatalf("Draw() error: %v", err)
+	}
+	if err = l.SetState(config, testParticipants(10)); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+	if _, err = l.Commit(d); err != ErrStale {
+		t.Fatalf("Commit() error = %v, want ErrStale", err)
+	}
+	if winners := l.Winners("3rd"); len(winners) != 0 {
+		t.Errorf("Winners() = %v, want no winners", ids(winners))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	l := newTestLottery(t, Config{Prizes: testPrizes()}, 10)
+
+	l.Restore(map[string][]Participant{"1st": testParticipants(1)})
+	if winners := l.Winners("1st"); len(winners) != 1 || winners[0].ID != "1" {
+		t.Fatalf("Winners() = %v, want [1]", ids(winners))
+	}
+
+	eligible, err := l.Eligible("3rd")
+	if err != nil {
+		t.Fatalf("Eligible() error: %v", err)
+	}
+	if len(eligible) != 9 {
+		t.Errorf("Eligible() = %v, want 9 participants without the winner of 1st", len(eligible))
+	}
+}
+
+func TestRedrawTransaction(t *testing.T) {
+	l := newTestLottery(t, Config{Prizes: testPrizes()}, 10)
+	old := drawOnce(t, l, "3rd", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rounds := make(chan []Participant, 100)
+	d, err := l.Redraw(ctx, "3rd", []int{0, 2}, DrawOptions{Interval: time.Millisecond, OnRound: func(winners []Participant) {
+		select {
+		case rounds <- winners:
+		default:
+		}
+	}})
+	if err != nil {
+		t.Fatalf("Redraw() error: %v", err)
+	}
+
+	// Rounds preview the merged winners, but the committed winners are not changed before Commit.
+	for i := 0; i < 5; i++ {
+		if preview := <-rounds; len(preview) != 3 || preview[1].ID != old[1].ID {
+			t.Fatalf("round = %v, want 3 winners with the kept winner of %v", ids(preview), ids(old))
+		}
+		if got := l.Winners("3rd"); !reflect.DeepEqual(got, old) {
+			t.Fatalf("Winners() while rolling = %v, want %v", ids(got), ids(old))
+		}
+	}
+	cancel()
+
+	// The draw is discarded(e.g. aborted): nothing is rolled back since nothing is changed.
+	<-d.Done()
+	if got := l.Winners("3rd"); !reflect.DeepEqual(got, old) {
+		t.Fatalf("Winners() after the draw is discarded = %v, want %v", ids(got), ids(old))
+	}
+
+	winners, err := l.Commit(d)
+	if err != nil {
+		t.Fatalf("Commit() error: %v", err)
+	}
+	if got := l.Winners("3rd"); !reflect.DeepEqual(got, winners) || !verifyWinners(got) {
+		t.Errorf("Winners() after Commit() = %v, want %v", ids(got), ids(winners))
+	}
+
+	// A draw is committed once.
+	if _, err = l.Commit(d); err != ErrStale {
+		t.Errorf("second Commit() error = %v, want ErrStale", err)
+	}
+}
+
+func TestParticipantsCopy(t *testing.T) {
+	participants := testParticipants(10)
+	l := newTestLottery(t, Config{Prizes: testPrizes()}, 1)
+	if err := l.SetState(Config{Prizes: testPrizes()}, participants); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+
+	// Changes of the slices of callers do not change the lottery.
+	participants[0].ID = "x"
+	got := l.Participants()
+	got[1].ID = "y"
+
+	if got = l.Participants(); got[0].ID != "1" || got[1].ID != "2" {
+		t.Errorf("Participants() = %v, want participants which are not changed by callers", ids(got))
+	}
+}
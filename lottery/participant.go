@@ -0,0 +1,136 @@
+package lottery
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// Redact redacts IDs and names of participants in logs. It's set by the server by its redaction policy.
+var Redact = func(s string) string { return s }
+
+type Participant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Email is optional(3rd column of participants CSV).
+	// It's used to notify winners and never sent to clients.
+	Email string `json:"-"`
+	// Attrs are extra columns of participants CSV with a header, e.g. "office" and "department".
+	// They're used by quotas of prizes.
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// LogValue implements slog.LogValuer. Participants are always logged redacted.
+func (p Participant) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", Redact(p.ID)),
+		slog.String("name", Redact(p.Name)),
+	)
+}
+
+// ParseParticipants parses rows of participants CSV: id,name[,email].
+// If the first row is a header starting with "id,name", columns are mapped by the header:
+// "email" is the email and other columns are attributes.
+func ParseParticipants(rows [][]string) ([]Participant, error) {
+	if len(rows) > 0 && len(rows[0]) >= 2 && strings.EqualFold(rows[0][0], "id") && strings.EqualFold(rows[0][1], "name") {
+		return parseWithHeader(rows[0], rows[1:])
+	}
+
+	var participants []Participant
+	for _, row := range rows {
+		if len(row) != 2 && len(row) != 3 {
+			return []Participant{}, fmt.Errorf("incorrect participants CSV")
+		}
+		p := Participant{ID: row[0], Name: row[1]}
+		if len(row) == 3 {
+			p.Email = row[2]
+		}
+		participants = append(participants, p)
+	}
+	return participants, nil
+}
+
+func parseWithHeader(header []string, rows [][]string) ([]Participant, error) {
+	columns := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			return []Participant{}, fmt.Errorf("incorrect participants CSV: empty column name in header")
+		}
+		if _, ok := columns[h]; ok {
+			return []Participant{}, fmt.Errorf("incorrect participants CSV: duplicate column %v in header", h)
+		}
+		columns[h] = i
+	}
+
+	var participants []Participant
+	for i, row := range rows {
+		if len(row) != len(header) {
+			return []Participant{}, fmt.Errorf("incorrect participants CSV: row %v has %v columns, header has %v", i+2, len(row), len(header))
+		}
+
+		p := Participant{ID: row[0], Name: row[1]}
+		for j := 2; j < len(row); j++ {
+			name := strings.TrimSpace(header[j])
+			if strings.EqualFold(name, "email") {
+				p.Email = row[j]
+				continue
+			}
+			if p.Attrs == nil {
+				p.Attrs = map[string]string{}
+			}
+			p.Attrs[name] = row[j]
+		}
+		participants = append(participants, p)
+	}
+	return participants, nil
+}
+
+// FormatParticipants returns rows of participants CSV which are parsed back by ParseParticipants.
+// Emails are omitted unless withEmail is true.
+// The header is added if any participant has attrs(sorted by names) or an email.
+func FormatParticipants(participants []Participant, withEmail bool) [][]string {
+	hasEmail := false
+	attrs := map[string]bool{}
+	for _, p := range participants {
+		if withEmail && p.Email != "" {
+			hasEmail = true
+		}
+		for name := range p.Attrs {
+			attrs[name] = true
+		}
+	}
+
+	rows := [][]string{}
+	if !hasEmail && len(attrs) == 0 {
+		for _, p := range participants {
+			rows = append(rows, []string{p.ID, p.Name})
+		}
+		return rows
+	}
+
+	var names []string
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	header := []string{"id", "name"}
+	if hasEmail {
+		header = append(header, "email")
+	}
+	rows = append(rows, append(header, names...))
+
+	for _, p := range participants {
+		row := []string{p.ID, p.Name}
+		if hasEmail {
+			row = append(row, p.Email)
+		}
+		for _, name := range names {
+			row = append(row, p.Attrs[name])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,97 @@
+package lottery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatParticipants(t *testing.T) {
+	plain := []Participant{{ID: "1", Name: "Frank"}, {ID: "2", Name: "Bob"}}
+	emails := []Participant{{ID: "1", Name: "Frank", Email: "frank@example.com"}, {ID: "2", Name: "Bob"}}
+	attrs := []Participant{
+		{ID: "1", Name: "Frank", Email: "frank@example.com", Attrs: map[string]string{"office": "SH", "department": "R&D"}},
+		{ID: "2", Name: "Bob", Attrs: map[string]string{"office": "BJ"}},
+	}
+
+	tests := []struct {
+		name         string
+		participants []Participant
+		withEmail    bool
+		rows         [][]string
+		parsed       []Participant
+	}{
+		{"plain", plain, true, [][]string{{"1", "Frank"}, {"2", "Bob"}}, plain},
+		{"emails", emails, true, [][]string{{"id", "name", "email"}, {"1", "Frank", "frank@example.com"}, {"2", "Bob", ""}}, emails},
+		{"emails omitted", emails, false, [][]string{{"1", "Frank"}, {"2", "Bob"}}, plain},
+		{"attrs", attrs, true, [][]string{
+			{"id", "name", "email", "department", "office"},
+			{"1", "Frank", "frank@example.com", "R&D", "SH"},
+			{"2", "Bob", "", "", "BJ"},
+		}, []Participant{
+			attrs[0],
+			{ID: "2", Name: "Bob", Attrs: map[string]string{"office": "BJ", "department": ""}},
+		}},
+		{"attrs without emails", attrs, false, [][]string{
+			{"id", "name", "department", "office"},
+			{"1", "Frank", "R&D", "SH"},
+			{"2", "Bob", "", "BJ"},
+		}, []Participant{
+			{ID: "1", Name: "Frank", Attrs: map[string]string{"office": "SH", "department": "R&D"}},
+			{ID: "2", Name: "Bob", Attrs: map[string]string{"office": "BJ", "department": ""}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := FormatParticipants(tt.participants, tt.withEmail)
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Fatalf("FormatParticipants() = %q, want %q", rows, tt.rows)
+			}
+
+			parsed, err := ParseParticipants(rows)
+			if err != nil {
+				t.Fatalf("ParseParticipants() error: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.parsed) {
+				t.Errorf("ParseParticipants() = %+v, want %+v", parsed, tt.parsed)
+			}
+		})
+	}
+}
+
+func TestParseParticipants(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want []Participant
+		err  bool
+	}{
+		{"no header", [][]string{{"1", "Frank"}, {"2", "Bob", "bob@example.com"}}, []Participant{
+			{ID: "1", Name: "Frank"},
+			{ID: "2", Name: "Bob", Email: "bob@example.com"},
+		}, false},
+		{"too many columns without header", [][]string{{"1", "Frank", "frank@example.com", "SH"}}, nil, true},
+		{"header", [][]string{{"ID", "Name", "Office", "EMAIL"}, {"1", "Frank", "SH", "frank@example.com"}}, []Participant{
+			{ID: "1", Name: "Frank", Email: "frank@example.com", Attrs: map[string]string{"Office": "SH"}},
+		}, false},
+		{"header with spaces", [][]string{{"id", "name", " office "}, {"1", "Frank", "SH"}}, []Participant{
+			{ID: "1", Name: "Frank", Attrs: map[string]string{"office": "SH"}},
+		}, false},
+		{"header only", [][]string{{"id", "name", "office"}}, nil, false},
+		{"empty column name", [][]string{{"id", "name", ""}, {"1", "Frank", "SH"}}, nil, true},
+		{"duplicate column", [][]string{{"id", "name", "office", "office"}, {"1", "Frank", "SH", "BJ"}}, nil, true},
+		{"row length mismatch", [][]string{{"id", "name", "office"}, {"1", "Frank"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseParticipants(tt.rows)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseParticipants() error = %v, want error: %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseParticipants() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package lottery
+
+import (
+	"fmt"
+)
+
+// Policies of prizes. See Prize.Policy.
+const (
+	policyExclusive = "exclusive"
+	policyRepeat    = "repeat"
+	policyMaxWins   = "max_wins"
+	policyCategory  = "category"
+)
+
+func validatePolicy(p Prize) error {
+	switch p.Policy {
+	case "", policyExclusive, policyRepeat:
+	case policyMaxWins:
+		if p.MaxWins <= 0 {
+			return fmt.Errorf("max_wins should be > 0 for policy %v", p.Policy)
+		}
+	case policyCategory:
+		if p.Category == "" {
+			return fmt.Errorf("empty category for policy %v", p.Policy)
+		}
+	default:
+		return fmt.Errorf("unknown policy %v", p.Policy)
+	}
+	return nil
+}
+
+// eligibleParticipants returns the participants who can win the prize by its policy and blacklists.
+// Returned winners(to re-lottery) of the prize are not counted as its winners.
+func eligibleParticipants(config Config, participants []Participant, winnerMap map[string][]Participant, prizeIndex int, returned []Participant) []Participant {
+	prize := config.Prizes[prizeIndex]
+
+	returnedIDs := map[string]bool{}
+	for _, p := range returned {
+		returnedIDs[p.ID] = true
+	}
+
+	var (
+		// Winners of the prize.
+		current = map[string]bool{}
+		// Number of prizes won by each participant.
+		wins = map[string]int{}
+		// Participants who have won a prize of the same category.
+		categoryWins = map[string]bool{}
+	)
+
+	for ID, winners := range winnerMap {
+		i := PrizeIndex(config.Prizes, ID)
+		for _, w := range winners {
+			if ID == prize.ID {
+				if returnedIDs[w.ID] {
+					continue
+				}
+				current[w.ID] = true
+			}
+
+			wins[w.ID]++
+			if prize.Category != "" && i >= 0 && config.Prizes[i].Category == prize.Category {
+				categoryWins[w.ID] = true
+			}
+		}
+	}
+
+	eligible := []Participant{}
+	for _, p := range participants {
+		if current[p.ID] {
+			continue
+		}
+
+		switch prize.Policy {
+		case policyRepeat:
+		case policyMaxWins:
+			if wins[p.ID] >= prize.MaxWins {
+				continue
+			}
+		case policyCategory:
+			if categoryWins[p.ID] {
+				continue
+			}
+		default:
+			if wins[p.ID] > 0 {
+				continue
+			}
+		}
+		eligible = append(eligible, p)
+	}
+
+	return removeBlacklist(eligible, getBlacklistIDs(config.Blacklists, prize))
+}
@@ -0,0 +1,91 @@
+package lottery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		prize Prize
+		err   bool
+	}{
+		{"default", Prize{}, false},
+		{"exclusive", Prize{Policy: "exclusive"}, false},
+		{"repeat", Prize{Policy: "repeat"}, false},
+		{"max_wins", Prize{Policy: "max_wins", MaxWins: 2}, false},
+		{"max_wins without max", Prize{Policy: "max_wins"}, true},
+		{"category", Prize{Policy: "category", Category: "gadgets"}, false},
+		{"category without category", Prize{Policy: "category"}, true},
+		{"unknown", Prize{Policy: "lucky"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePolicy(tt.prize); (err != nil) != tt.err {
+				t.Errorf("validatePolicy() error = %v, want error: %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEligibleParticipants(t *testing.T) {
+	p := testParticipants(6)
+	// 1 and 2 won phones, 3 won a mug, 1 won a mug too.
+	winnerMap := map[string][]Participant{
+		"phone": {p[0], p[1]},
+		"mug":   {p[2], p[0]},
+	}
+
+	tests := []struct {
+		name     string
+		prize    Prize
+		returned []Participant
+		want     []string
+	}{
+		{"exclusive", Prize{ID: "tv"}, nil, []string{"4", "5", "6"}},
+		{"repeat", Prize{ID: "tv", Policy: "repeat"}, nil, []string{"1", "2", "3", "4", "5", "6"}},
+		{"repeat excludes winners of the prize", Prize{ID: "mug", Policy: "repeat"}, nil, []string{"2", "4", "5", "6"}},
+		{"max_wins", Prize{ID: "tv", Policy: "max_wins", MaxWins: 2}, nil, []string{"2", "3", "4", "5", "6"}},
+		{"max_wins of 1", Prize{ID: "tv", Policy: "max_wins", MaxWins: 1}, nil, []string{"4", "5", "6"}},
+		{"category", Prize{ID: "tv", Policy: "category", Category: "electronics"}, nil, []string{"3", "4", "5", "6"}},
+		{"category without winners", Prize{ID: "tv", Policy: "category", Category: "books"}, nil, []string{"1", "2", "3", "4", "5", "6"}},
+		// Returned winners are drawn again in the re-lottery but their other prizes still count.
+		{"returned winners of the prize", Prize{ID: "mug", Policy: "repeat"}, []Participant{p[2]}, []string{"2", "3", "4", "5", "6"}},
+		{"returned winners with other prizes", Prize{ID: "mug"}, []Participant{p[0]}, []string{"4", "5", "6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Prizes: []Prize{
+				{ID: "phone", Tier: 3, Category: "electronics"},
+				{ID: "mug", Tier: 1, Category: "kitchen"},
+			}}
+			if i := PrizeIndex(config.Prizes, tt.prize.ID); i >= 0 {
+				config.Prizes[i] = tt.prize
+			} else {
+				config.Prizes = append(config.Prizes, tt.prize)
+			}
+
+			got := eligibleParticipants(config, p, winnerMap, PrizeIndex(config.Prizes, tt.prize.ID), tt.returned)
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Errorf("eligibleParticipants() = %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestEligibleParticipantsBlacklists(t *testing.T) {
+	p := testParticipants(4)
+	config := Config{
+		Prizes:     []Prize{{ID: "tv", Policy: "repeat"}},
+		Blacklists: []Blacklist{{PrizeIDs: []string{"tv"}, IDs: []string{"2"}}},
+	}
+
+	// Blacklists apply to all policies.
+	got := eligibleParticipants(config, p, map[string][]Participant{"mug": {p[0]}}, 0, nil)
+	if want := []string{"1", "3", "4"}; !reflect.DeepEqual(ids(got), want) {
+		t.Errorf("eligibleParticipants() = %v, want %v", ids(got), want)
+	}
+}
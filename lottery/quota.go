@@ -0,0 +1,270 @@
+package lottery
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Max attempts to draw winners which satisfy quotas.
+const maxQuotaAttempts = 100
+
+// Quota limits the number of winners of the prize by an attribute of participants(extra column of participants CSV).
+type Quota struct {
+	// Attr is the attribute, e.g. "office".
+	Attr string `json:"attr"`
+	// Value limits the quota to participants with the value, e.g. "Shanghai".
+	// The quota applies to each value of the attribute if it's empty.
+	Value string `json:"value,omitempty"`
+	// Min number of winners.
+	Min int `json:"min,omitempty"`
+	// Max number of winners, 0 for no limit.
+	Max int `json:"max,omitempty"`
+	// Max percent of winners of the prize, e.g. 30. 0 for no limit.
+	MaxPercent float64 `json:"max_percent,omitempty"`
+}
+
+func validateQuota(q Quota) error {
+	switch {
+	case q.Attr == "":
+		return fmt.Errorf("empty attr")
+	case q.Min < 0 || q.Max < 0:
+		return fmt.Errorf("min and max should be >= 0")
+	case q.MaxPercent < 0 || q.MaxPercent > 100:
+		return fmt.Errorf("max_percent should be in [0, 100]")
+	case q.Min == 0 && q.Max == 0 && q.MaxPercent == 0:
+		return fmt.Errorf("min, max or max_percent is required")
+	case q.Max > 0 && q.Min > q.Max:
+		return fmt.Errorf("min %v > max %v", q.Min, q.Max)
+	}
+	return nil
+}
+
+// maxByPercent returns the max number of winners by max_percent of total winners, rounded down,
+// e.g. 30% of 5 winners is 1.
+func maxByPercent(percent float64, total int) int {
+	return int(math.Floor(percent / 100 * float64(total)))
+}
+
+// quotaGroup is a quota applied to the participants with a value of the attribute.
+type quotaGroup struct {
+	// Index of the quota in the quotas of the prize.
+	quota int
+	attr  string
+	value string
+	min   int
+	// Max number of winners, -1 for no limit.
+	max int
+	// Number of kept winners(not re-lotteried) in the group.
+	kept int
+}
+
+func (g quotaGroup) String() string {
+	return fmt.Sprintf("%v=%v", g.attr, g.value)
+}
+
+func (g quotaGroup) has(p Participant) bool {
+	return p.Attrs[g.attr] == g.value
+}
+
+// newQuotaGroups returns the groups of the quotas.
+// Values of quotas without a value are collected from all participants.
+// total is the number of winners of the prize after the draw(kept winners and drawn ones).
+func newQuotaGroups(quotas []Quota, participants []Participant, kept []Participant, total int) []quotaGroup {
+	var groups []quotaGroup
+
+	for i, q := range quotas {
+		values := []string{q.Value}
+		if q.Value == "" {
+			values = attrValues(participants, q.Attr)
+		}
+
+		max := -1
+		if q.Max > 0 {
+			max = q.Max
+		}
+		if q.MaxPercent > 0 {
+			if n := maxByPercent(q.MaxPercent, total); max < 0 || n < max {
+				max = n
+			}
+		}
+
+		for _, v := range values {
+			g := quotaGroup{quota: i, attr: q.Attr, value: v, min: q.Min, max: max}
+			for _, w := range kept {
+				if g.has(w) {
+					g.kept++
+				}
+			}
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// attrValues returns the sorted non-empty values of the attribute of participants.
+func attrValues(participants []Participant, attr string) []string {
+	m := map[string]bool{}
+	for _, p := range participants {
+		if v := p.Attrs[attr]; v != "" {
+			m[v] = true
+		}
+	}
+
+	values := []string{}
+	for v := range m {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// checkQuotas returns an error if it's impossible to draw n winners from the pool which satisfy the quotas.
+func checkQuotas(n int, pool []Participant, groups []quotaGroup) error {
+	// Needed and max winners of quotas.
+	needed := map[int]int{}
+	capacity := map[int]int{}
+	for _, g := range groups {
+		avail := 0
+		for _, p := range pool {
+			if g.has(p) {
+				avail++
+			}
+		}
+
+		need := g.min - g.kept
+		if need < 0 {
+			need = 0
+		}
+		if need > avail {
+			return fmt.Errorf("quota %v needs at least %v more winners, but only %v eligible participants", g, need, avail)
+		}
+		needed[g.quota] += need
+
+		if g.max < 0 {
+			continue
+		}
+		if g.kept+need > g.max {
+			return fmt.Errorf("quota %v allows at most %v winners, but needs %v(%v kept)", g, g.max, g.kept+need, g.kept)
+		}
+		if left := g.max - g.kept; left < avail {
+			avail = left
+		}
+		capacity[g.quota] += avail
+	}
+
+	for i, need := range needed {
+		if need > n {
+			return fmt.Errorf("quotas of %v need at least %v winners, but only %v are drawn", groups[groupOf(groups, i)].attr, need, n)
+		}
+	}
+
+	for i, c := range capacity {
+		// Participants out of the groups of the quota are not limited by it.
+		for _, p := range pool {
+			in := false
+			for _, g := range groups {
+				if g.quota == i && g.has(p) {
+					in = true
+					break
+				}
+			}
+			if !in {
+				c++
+			}
+		}
+		if c < n {
+			return fmt.Errorf("quotas of %v allow at most %v winners, but %v are drawn", groups[groupOf(groups, i)].attr, c, n)
+		}
+	}
+	return nil
+}
+
+// groupOf returns the index of the first group of the quota.
+func groupOf(groups []quotaGroup, quota int) int {
+	for i, g := range groups {
+		if g.quota == quota {
+			return i
+		}
+	}
+	return 0
+}
+
+// drawWithQuotas draws n winners from the pool randomly which satisfy the quotas.
+// It fills min quotas first and then draws the rest without exceeding max quotas.
+// It retries if the random choices lead to a dead end(quotas of different attributes may conflict).
+func drawWithQuotas(n int, pool []Participant, groups []quotaGroup) ([]Participant, error) {
+	if err := checkQuotas(n, pool, groups); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxQuotaAttempts; attempt++ {
+		if winners, ok := tryDrawWithQuotas(n, pool, groups); ok {
+			return winners, nil
+		}
+	}
+	return nil, fmt.Errorf("no winners satisfy the quotas after %v attempts, relax the quotas", maxQuotaAttempts)
+}
+
+func tryDrawWithQuotas(n int, pool []Participant, groups []quotaGroup) ([]Participant, bool) {
+	counts := make([]int, len(groups))
+	for i, g := range groups {
+		counts[i] = g.kept
+	}
+
+	var (
+		winners = []Participant{}
+		chosen  = make([]bool, len(pool))
+		perm    = rand.Perm(len(pool))
+	)
+
+	// fits returns true if p can win without exceeding max quotas.
+	fits := func(p Participant) bool {
+		for i, g := range groups {
+			if g.max >= 0 && g.has(p) && counts[i] >= g.max {
+				return false
+			}
+		}
+		return true
+	}
+
+	choose := func(j int) {
+		chosen[j] = true
+		winners = append(winners, pool[j])
+		for i, g := range groups {
+			if g.has(pool[j]) {
+				counts[i]++
+			}
+		}
+	}
+
+	// Fill min quotas in random order.
+	for _, i := range rand.Perm(len(groups)) {
+		for _, j := range perm {
+			if counts[i] >= groups[i].min || len(winners) >= n {
+				break
+			}
+			if !chosen[j] && groups[i].has(pool[j]) && fits(pool[j]) {
+				choose(j)
+			}
+		}
+		if counts[i] < groups[i].min {
+			return nil, false
+		}
+	}
+
+	// Draw the rest.
+	for _, j := range perm {
+		if len(winners) >= n {
+			break
+		}
+		if !chosen[j] && fits(pool[j]) {
+			choose(j)
+		}
+	}
+
+	// Shuffle winners, or winners of min quotas are always listed first.
+	rand.Shuffle(len(winners), func(i, j int) { winners[i], winners[j] = winners[j], winners[i] })
+	return winners, len(winners) == n
+}
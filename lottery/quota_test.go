@@ -0,0 +1,236 @@
+package lottery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// officeParticipants returns n participants of each office.
+func officeParticipants(offices map[string]int) []Participant {
+	participants := []Participant{}
+	for _, office := range []string{"BJ", "SH", "SZ"} {
+		for i := 0; i < offices[office]; i++ {
+			p := Participant{ID: fmt.Sprintf("%v%v", office, i+1), Name: office, Attrs: map[string]string{"office": office}}
+			participants = append(participants, p)
+		}
+	}
+	return participants
+}
+
+func countOffices(winners []Participant) map[string]int {
+	m := map[string]int{}
+	for _, w := range winners {
+		m[w.Attrs["office"]]++
+	}
+	return m
+}
+
+func TestValidateQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota Quota
+		err   string
+	}{
+		{"min", Quota{Attr: "office", Min: 1}, ""},
+		{"max percent", Quota{Attr: "office", Value: "SH", MaxPercent: 30}, ""},
+		{"min equals max", Quota{Attr: "office", Min: 2, Max: 2}, ""},
+		{"empty attr", Quota{Min: 1}, "empty attr"},
+		{"negative min", Quota{Attr: "office", Min: -1}, ">= 0"},
+		{"max percent over 100", Quota{Attr: "office", MaxPercent: 101}, "[0, 100]"},
+		{"no limits", Quota{Attr: "office"}, "required"},
+		{"min over max", Quota{Attr: "office", Min: 3, Max: 2}, "min 3 > max 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateQuota(tt.quota)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("validateQuota() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("validateQuota() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewQuotaGroups(t *testing.T) {
+	pool := officeParticipants(map[string]int{"BJ": 2, "SH": 5, "SZ": 3})
+	kept := []Participant{pool[0], pool[2]}
+
+	groups := newQuotaGroups([]Quota{
+		{Attr: "office", Min: 1},
+		{Attr: "office", Value: "SH", Max: 4, MaxPercent: 30},
+		{Attr: "office", Value: "SZ", MaxPercent: 55},
+	}, pool, kept, 10)
+
+	want := []string{
+		"office=BJ min 1 max -1 kept 1",
+		"office=SH min 1 max -1 kept 1",
+		"office=SZ min 1 max -1 kept 0",
+		// The lower of max and max_percent of 10 winners.
+		"office=SH min 0 max 3 kept 1",
+		// 55% of 10 winners is rounded down.
+		"office=SZ min 0 max 5 kept 0",
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("newQuotaGroups() = %v, want %v groups", groups, len(want))
+	}
+	for i, g := range groups {
+		if got := fmt.Sprintf("%v min %v max %v kept %v", g, g.min, g.max, g.kept); got != want[i] {
+			t.Errorf("group %v = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestValidateConfigMaxPercent(t *testing.T) {
+	pool := officeParticipants(map[string]int{"BJ": 2, "SH": 5, "SZ": 3})
+
+	tests := []struct {
+		name    string
+		num     int
+		percent float64
+		err     string
+	}{
+		{"small prize", 3, 10, "max_percent 10 of 3 winners is 0"},
+		{"one winner", 1, 99, "max_percent 99 of 1 winners is 0"},
+		{"rounded down to 1", 3, 34, ""},
+		{"large prize", 10, 10, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Prizes: []Prize{{ID: "1st", Name: "1st", Num: tt.num, Quotas: []Quota{{Attr: "office", MaxPercent: tt.percent}}}}}
+			err := ValidateConfig(c, pool)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("ValidateConfig() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("ValidateConfig() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckQuotas(t *testing.T) {
+	pool := officeParticipants(map[string]int{"BJ": 1, "SH": 6, "SZ": 2})
+
+	tests := []struct {
+		name   string
+		n      int
+		quotas []Quota
+		kept   []Participant
+		err    string
+	}{
+		{"satisfied", 3, []Quota{{Attr: "office", Min: 1}}, nil, ""},
+		{"not enough participants", 3, []Quota{{Attr: "office", Value: "BJ", Min: 2}}, nil, "only 1 eligible"},
+		{"min of all values over n", 2, []Quota{{Attr: "office", Min: 1}}, nil, "need at least 3 winners"},
+		{"kept winners count for min", 2, []Quota{{Attr: "office", Min: 1}}, []Participant{{ID: "x", Attrs: map[string]string{"office": "SH"}}}, ""},
+		{"kept winners over max", 1, []Quota{{Attr: "office", Value: "SH", Max: 1, Min: 1}},
+			[]Participant{{ID: "x", Attrs: map[string]string{"office": "SH"}}, {ID: "y", Attrs: map[string]string{"office": "SH"}}}, "at most 1 winners"},
+		{"max too low", 5, []Quota{{Attr: "office", Max: 1}}, nil, "allow at most 3 winners"},
+		// Participants without the value are not limited.
+		{"max of a value", 4, []Quota{{Attr: "office", Value: "SH", Max: 1}}, nil, ""},
+		{"max of a value too low", 5, []Quota{{Attr: "office", Value: "SH", Max: 1}}, nil, "allow at most 4 winners"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := newQuotaGroups(tt.quotas, pool, tt.kept, tt.n+len(tt.kept))
+			err := checkQuotas(tt.n, pool, groups)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("checkQuotas() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("checkQuotas() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDrawWithQuotas(t *testing.T) {
+	pool := officeParticipants(map[string]int{"BJ": 2, "SH": 10, "SZ": 3})
+	for i := range pool {
+		dept := "sales"
+		if i%2 == 0 {
+			dept = "R&D"
+		}
+		pool[i].Attrs["department"] = dept
+	}
+
+	tests := []struct {
+		name   string
+		n      int
+		quotas []Quota
+		check  func(winners []Participant) bool
+	}{
+		{"min per office", 4, []Quota{{Attr: "office", Min: 1}}, func(winners []Participant) bool {
+			m := countOffices(winners)
+			return m["BJ"] >= 1 && m["SH"] >= 1 && m["SZ"] >= 1
+		}},
+		{"max percent", 10, []Quota{{Attr: "office", Value: "SH", MaxPercent: 50}}, func(winners []Participant) bool {
+			return countOffices(winners)["SH"] == 5
+		}},
+		{"min and max", 6, []Quota{{Attr: "office", Value: "BJ", Min: 2, Max: 2}, {Attr: "office", Value: "SZ", Max: 1}}, func(winners []Participant) bool {
+			m := countOffices(winners)
+			return m["BJ"] == 2 && m["SZ"] <= 1
+		}},
+		{"attributes combined", 6, []Quota{{Attr: "office", Min: 1}, {Attr: "department", Max: 3}}, func(winners []Participant) bool {
+			m := countOffices(winners)
+			depts := map[string]int{}
+			for _, w := range winners {
+				depts[w.Attrs["department"]]++
+			}
+			return m["BJ"] >= 1 && m["SH"] >= 1 && m["SZ"] >= 1 && depts["sales"] == 3 && depts["R&D"] == 3
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				groups := newQuotaGroups(tt.quotas, pool, nil, tt.n)
+				winners, err := drawWithQuotas(tt.n, pool, groups)
+				if err != nil {
+					t.Fatalf("drawWithQuotas() error: %v", err)
+				}
+				if len(winners) != tt.n || !verifyWinners(winners) || !tt.check(winners) {
+					t.Fatalf("drawWithQuotas() = %v %v, want %v winners satisfying the quotas", ids(winners), countOffices(winners), tt.n)
+				}
+			}
+		})
+	}
+}
+
+func TestRelotteryQuotas(t *testing.T) {
+	pool := officeParticipants(map[string]int{"BJ": 3, "SH": 6})
+	config := Config{Prizes: []Prize{{ID: "3rd", Name: "3rd", Num: 3, Quotas: []Quota{{Attr: "office", Value: "BJ", Max: 1}}}}}
+	l, err := New(config, pool)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		winners := drawOnce(t, l, "3rd", nil)
+		if countOffices(winners)["BJ"] > 1 {
+			t.Fatalf("winners = %v, want at most 1 of BJ", ids(winners))
+		}
+
+		// Kept winners count for the quotas of the re-lottery.
+		winners = drawOnce(t, l, "3rd", []int{1})
+		if countOffices(winners)["BJ"] > 1 {
+			t.Fatalf("re-lottery winners = %v, want at most 1 of BJ", ids(winners))
+		}
+
+		l.Restore(map[string][]Participant{})
+	}
+}
@@ -0,0 +1,438 @@
+package lottery
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// SimulateOptions are options of Simulate.
+type SimulateOptions struct {
+	// Runs is the number of times to run the event.
+	Runs int
+	// PrizeIDs are the prizes to draw in order. All prizes are drawn in the order of the config if it's empty.
+	PrizeIDs []string
+	// AbsentRate is the probability of a winner being absent. Absent winners are re-lotteried
+	// up to MaxRelotteries times per prize.
+	AbsentRate     float64
+	MaxRelotteries int
+}
+
+// Simulation is the report of Simulate.
+type Simulation struct {
+	Runs         int                `json:"runs"`
+	Prizes       []PrizeStats       `json:"prizes"`
+	Participants []ParticipantStats `json:"participants"`
+	// Blacklists are compared with a simulation without blacklists. It's empty if the config has no blacklists.
+	Blacklists []BlacklistStats `json:"blacklists,omitempty"`
+}
+
+// PrizeStats are statistics of a prize of the simulation.
+type PrizeStats struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Num  int    `json:"num"`
+	// Average numbers of winners and eligible participants per run.
+	// Winners are less than Num if the prize is short of stock or eligible participants.
+	AvgWinners  float64 `json:"avg_winners"`
+	AvgEligible float64 `json:"avg_eligible"`
+	Relotteries int     `json:"relotteries"`
+	// Runs in which the draw of the prize failed, e.g. quotas can't be satisfied. Err is the first error.
+	Failures int    `json:"failures"`
+	Err      string `json:"err,omitempty"`
+
+	// Chi-square test of the uniformity of wins. Participants are compared with the ones in the same situation:
+	// blacklisted for the same prizes and with the same attributes used by quotas. DF is 0 if there's nothing to test,
+	// e.g. every eligible participant wins the prize.
+	ChiSquare float64 `json:"chi_square"`
+	DF        int     `json:"df"`
+	PValue    float64 `json:"p_value"`
+}
+
+// ParticipantStats are win probabilities of a participant.
+type ParticipantStats struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Probabilities of winning prizes by prize IDs.
+	Prizes map[string]float64 `json:"prizes"`
+	// Probability of winning any prize.
+	Any float64 `json:"any"`
+	// Indexes of blacklists of the participant.
+	Blacklists []int `json:"blacklists,omitempty"`
+}
+
+// BlacklistStats are effects of a blacklist: average probabilities of winning any prize
+// of the listed participants and the others, with and without blacklists.
+type BlacklistStats struct {
+	Index        int      `json:"index"`
+	MaxTier      *int     `json:"max_tier,omitempty"`
+	PrizeIDs     []string `json:"prize_ids,omitempty"`
+	Participants int      `json:"participants"`
+
+	Listed        float64 `json:"listed"`
+	ListedWithout float64 `json:"listed_without"`
+	Others        float64 `json:"others"`
+	OthersWithout float64 `json:"others_without"`
+}
+
+// Simulate runs the event(draws prizes in order with one round each, like stopping the draw at a random moment)
+// opts.Runs times with the same draw logic as the server, and reports win probabilities and uniformity tests.
+func Simulate(config Config, participants []Participant, opts SimulateOptions) (*Simulation, error) {
+	NormalizeConfig(&config)
+	if err := ValidateConfig(config, participants); err != nil {
+		return nil, err
+	}
+	if opts.Runs <= 0 {
+		return nil, fmt.Errorf("runs must be > 0")
+	}
+	if opts.AbsentRate < 0 || opts.AbsentRate >= 1 {
+		return nil, fmt.Errorf("absent rate must be in [0, 1)")
+	}
+
+	order := []int{}
+	for _, ID := range opts.PrizeIDs {
+		i := PrizeIndex(config.Prizes, ID)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown prize: %v", ID)
+		}
+		order = append(order, i)
+	}
+	if len(order) == 0 {
+		for i := range config.Prizes {
+			order = append(order, i)
+		}
+	}
+
+	c, err := simulate(config, participants, order, opts)
+	if err != nil {
+		return nil, err
+	}
+	s := c.report(config, participants, order, opts.Runs)
+
+	if len(config.Blacklists) > 0 {
+		without := config
+		without.Blacklists = nil
+		base, err := simulate(without, participants, order, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.Blacklists = blacklistStats(config, participants, c, base, opts.Runs)
+	}
+	return s, nil
+}
+
+// simCounts are counts of a simulation. Wins are indexed by prize and participant indexes.
+type simCounts struct {
+	wins        [][]int
+	anyWins     []int
+	winners     []int
+	eligible    []int
+	relotteries []int
+	failures    []int
+	errs        []string
+}
+
+func simulate(config Config, participants []Participant, order []int, opts SimulateOptions) (*simCounts, error) {
+	l, err := New(config, participants)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, p := range participants {
+		index[p.ID] = i
+	}
+
+	n := len(config.Prizes)
+	c := &simCounts{
+		wins:        make([][]int, n),
+		anyWins:     make([]int, len(participants)),
+		winners:     make([]int, n),
+		eligible:    make([]int, n),
+		relotteries: make([]int, n),
+		failures:    make([]int, n),
+		errs:        make([]string, n),
+	}
+	for i := range c.wins {
+		c.wins[i] = make([]int, len(participants))
+	}
+
+	fail := func(i int, err error) {
+		c.failures[i]++
+		if c.errs[i] == "" {
+			c.errs[i] = err.Error()
+		}
+	}
+
+	ctx := context.Background()
+	for run := 0; run < opts.Runs; run++ {
+		l.Restore(nil)
+
+		for _, i := range order {
+			ID := config.Prizes[i].ID
+			d, err := l.Draw(ctx, ID, DrawOptions{})
+			if err != nil {
+				fail(i, err)
+				continue
+			}
+			c.eligible[i] += d.Eligible
+
+			winners, err := l.Commit(d)
+			if err != nil {
+				fail(i, err)
+				continue
+			}
+
+			for r := 0; r < opts.MaxRelotteries; r++ {
+				absent := []int{}
+				for j := range winners {
+					if rand.Float64() < opts.AbsentRate {
+						absent = append(absent, j)
+					}
+				}
+				if len(absent) == 0 {
+					break
+				}
+
+				c.relotteries[i]++
+				if d, err = l.Redraw(ctx, ID, absent, DrawOptions{}); err == nil {
+					winners, err = l.Commit(d)
+				}
+				if err != nil {
+					fail(i, fmt.Errorf("re-lottery error: %v", err))
+					break
+				}
+			}
+		}
+
+		won := map[int]bool{}
+		for i, prize := range config.Prizes {
+			for _, p := range l.Winners(prize.ID) {
+				j := index[p.ID]
+				c.wins[i][j]++
+				c.winners[i]++
+				won[j] = true
+			}
+		}
+		for j := range won {
+			c.anyWins[j]++
+		}
+	}
+	return c, nil
+}
+
+func (c *simCounts) report(config Config, participants []Participant, order []int, runs int) *Simulation {
+	R := float64(runs)
+	s := &Simulation{Runs: runs}
+
+	groups := exchangeableGroups(config, participants)
+	for _, i := range order {
+		prize := config.Prizes[i]
+		chi2, df := chiSquare(c.wins[i], groups, runs)
+		ps := PrizeStats{
+			ID:          prize.ID,
+			Name:        prize.Name,
+			Num:         prize.Num,
+			AvgWinners:  float64(c.winners[i]) / R,
+			AvgEligible: float64(c.eligible[i]) / R,
+			Relotteries: c.relotteries[i],
+			Failures:    c.failures[i],
+			Err:         c.errs[i],
+			ChiSquare:   chi2,
+			DF:          df,
+			PValue:      1,
+		}
+		if df > 0 {
+			ps.PValue = chiSquarePValue(chi2, df)
+		}
+		s.Prizes = append(s.Prizes, ps)
+	}
+
+	for j, p := range participants {
+		ps := ParticipantStats{ID: p.ID, Name: p.Name, Prizes: map[string]float64{}, Any: float64(c.anyWins[j]) / R}
+		for _, i := range order {
+			ps.Prizes[config.Prizes[i].ID] = float64(c.wins[i][j]) / R
+		}
+		for k, b := range config.Blacklists {
+			for _, ID := range b.IDs {
+				if ID == p.ID {
+					ps.Blacklists = append(ps.Blacklists, k)
+					break
+				}
+			}
+		}
+		s.Participants = append(s.Participants, ps)
+	}
+	return s
+}
+
+// exchangeableGroups groups indexes of participants who have the same chances by the config:
+// blacklisted for the same prizes and with the same attributes used by quotas.
+func exchangeableGroups(config Config, participants []Participant) [][]int {
+	blacklists := make([]map[string]string, len(config.Prizes))
+	for i, prize := range config.Prizes {
+		blacklists[i] = getBlacklistIDs(config.Blacklists, prize)
+	}
+
+	attrs := map[string]bool{}
+	for _, prize := range config.Prizes {
+		for _, q := range prize.Quotas {
+			attrs[q.Attr] = true
+		}
+	}
+	keys := []string{}
+	for attr := range attrs {
+		keys = append(keys, attr)
+	}
+	sort.Strings(keys)
+
+	m := map[string][]int{}
+	names := []string{}
+	for j, p := range participants {
+		var b strings.Builder
+		for _, bl := range blacklists {
+			if _, ok := bl[p.ID]; ok {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		for _, attr := range keys {
+			fmt.Fprintf(&b, "\x00%v", p.Attrs[attr])
+		}
+
+		key := b.String()
+		if _, ok := m[key]; !ok {
+			names = append(names, key)
+		}
+		m[key] = append(m[key], j)
+	}
+
+	groups := [][]int{}
+	for _, key := range names {
+		groups = append(groups, m[key])
+	}
+	return groups
+}
+
+// chiSquare returns the chi-square statistic and degrees of freedom of the wins of a prize.
+// In each group, wins of participants are expected to be equal. A participant wins at most once per run,
+// so the wins are binomial and the variance is e*(1-e/runs) instead of e.
+func chiSquare(wins []int, groups [][]int, runs int) (float64, int) {
+	var (
+		chi2 float64
+		df   int
+	)
+
+	for _, g := range groups {
+		total := 0
+		for _, j := range g {
+			total += wins[j]
+		}
+
+		e := float64(total) / float64(len(g))
+		v := e * (1 - e/float64(runs))
+		if len(g) < 2 || total == 0 || v <= 0 {
+			continue
+		}
+
+		for _, j := range g {
+			d := float64(wins[j]) - e
+			chi2 += d * d / v
+		}
+		df += len(g) - 1
+	}
+	return chi2, df
+}
+
+// chiSquarePValue returns the probability of a chi-square statistic >= x with df degrees of freedom.
+func chiSquarePValue(x float64, df int) float64 {
+	return regularizedGammaQ(float64(df)/2, x/2)
+}
+
+// regularizedGammaQ returns Q(a, x) = 1 - P(a, x), the upper regularized incomplete gamma function.
+func regularizedGammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+
+	lg, _ := math.Lgamma(a)
+	if x < a+1 {
+		// Series of P(a, x).
+		sum, del := 1/a, 1/a
+		for n := 1; n < 1000; n++ {
+			del *= x / (a + float64(n))
+			sum += del
+			if math.Abs(del) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(-x+a*math.Log(x)-lg)
+	}
+
+	// Continued fraction of Q(a, x) by the modified Lentz's method.
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 1e-15 {
+			break
+		}
+	}
+	return math.Exp(-x+a*math.Log(x)-lg) * h
+}
+
+func blacklistStats(config Config, participants []Participant, with, without *simCounts, runs int) []BlacklistStats {
+	R := float64(runs)
+	stats := []BlacklistStats{}
+
+	for k, b := range config.Blacklists {
+		listed := map[string]bool{}
+		for _, ID := range b.IDs {
+			listed[ID] = true
+		}
+
+		s := BlacklistStats{Index: k, MaxTier: b.MaxTier, PrizeIDs: b.PrizeIDs}
+		others := 0
+		for j, p := range participants {
+			if listed[p.ID] {
+				s.Participants++
+				s.Listed += float64(with.anyWins[j]) / R
+				s.ListedWithout += float64(without.anyWins[j]) / R
+			} else {
+				others++
+				s.Others += float64(with.anyWins[j]) / R
+				s.OthersWithout += float64(without.anyWins[j]) / R
+			}
+		}
+
+		if s.Participants > 0 {
+			s.Listed /= float64(s.Participants)
+			s.ListedWithout /= float64(s.Participants)
+		}
+		if others > 0 {
+			s.Others /= float64(others)
+			s.OthersWithout /= float64(others)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
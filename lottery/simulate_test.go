@@ -0,0 +1,60 @@
+package lottery
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChiSquarePValue(t *testing.T) {
+	tests := []struct {
+		x    float64
+		df   int
+		want float64
+	}{
+		{3.841, 1, 0.05},
+		{6.635, 1, 0.01},
+		{18.307, 10, 0.05},
+		{0, 5, 1},
+		{124.342, 100, 0.05},
+	}
+
+	for _, tt := range tests {
+		if got := chiSquarePValue(tt.x, tt.df); math.Abs(got-tt.want) > 1e-3 {
+			t.Errorf("chiSquarePValue(%v, %v) = %v, want %v", tt.x, tt.df, got, tt.want)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	maxTier := 1
+	config := Config{
+		Prizes:     testPrizes(),
+		Blacklists: []Blacklist{{MaxTier: &maxTier, IDs: []string{"1"}}},
+	}
+
+	s, err := Simulate(config, testParticipants(20), SimulateOptions{Runs: 2000, AbsentRate: 0.1, MaxRelotteries: 2})
+	if err != nil {
+		t.Fatalf("Simulate() error: %v", err)
+	}
+
+	for i, p := range s.Prizes {
+		if p.AvgWinners != float64(testPrizes()[i].Num) || p.Failures != 0 {
+			t.Errorf("%v: avg winners = %v, failures = %v(%v)", p.ID, p.AvgWinners, p.Failures, p.Err)
+		}
+		if p.DF == 0 {
+			t.Errorf("%v: nothing tested", p.ID)
+		}
+	}
+
+	p := s.Participants[0]
+	if p.Prizes["2nd"] != 0 || p.Prizes["1st"] != 0 {
+		t.Errorf("blacklisted participant won: %v", p.Prizes)
+	}
+	if len(s.Blacklists) != 1 || s.Blacklists[0].Listed >= s.Blacklists[0].ListedWithout {
+		t.Errorf("Blacklists = %+v, want lower probability of the listed participant", s.Blacklists)
+	}
+
+	if _, err = Simulate(config, testParticipants(20), SimulateOptions{Runs: 1, PrizeIDs: []string{"x"}}); err == nil {
+		t.Errorf("Simulate() with unknown prize error = nil, want error")
+	}
+}
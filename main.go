@@ -5,134 +5,160 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/northbright/pathhelper"
+	"github.com/northbright/lottery-server/store"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-type ServerSettings struct {
-	WSURL string `json:"ws_url"`
-}
-
-var (
-	serverRoot       string // Absolute path of server root.
-	staticFolderPath string // Absolute path of static file folder.
-	faviconPath      string // Absolute path of "favicon.ico".
-)
-
-var addr = flag.String("addr", ":8080", "http service address")
+var settings ServerSettings
 
-func loadServerSettings(file string, settings *ServerSettings) error {
-	var (
-		err        error
-		buf        []byte
-		currentDir string
-	)
-
-	currentDir, _ = pathhelper.GetCurrentExecDir()
-	file = path.Join(currentDir, file)
-
-	// Load Conifg
-	if buf, err = ioutil.ReadFile(file); err != nil {
-		return err
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
 	}
-
-	return json.Unmarshal(buf, &settings)
-}
-
-func serveHome(w http.ResponseWriter, r *http.Request) {
-	log.Println(r.URL)
-	if r.URL.Path != "/" {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runCtlCommand(os.Args[2:]))
 	}
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		os.Exit(runSimulateCommand(os.Args[2:]))
 	}
-	http.ServeFile(w, r, "home.html")
-}
 
-// GetCurrentExecDir gets the current executable path.
-// You may find more path helper functions in:
-// https://github.com/northbright/pathhelper
-func GetCurrentExecDir() (dir string, err error) {
-	p, err := exec.LookPath(os.Args[0])
-	if err != nil {
-		return "", err
+	var err error
+
+	f := newSettingsFlags(flag.CommandLine)
+	flag.Parse()
+
+	if settings, participants, config, err = loadAll(f); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
 
-	absPath, err := filepath.Abs(p)
-	if err != nil {
-		return "", err
+	if err = setupLogger(os.Stderr, settings.LogLevel, settings.LogFormat, settings.LogRedact, settings.LogRedactKey); err != nil {
+		fmt.Fprintf(os.Stderr, "setupLogger() error: %v\n", err)
+		os.Exit(1)
 	}
 
-	dir = filepath.Dir(absPath)
-	return dir, nil
-}
+	slog.Info("server settings loaded", "ws_url", settings.WSURL, "config_file", settings.ConfigFile, "participants_file", settings.ParticipantsFile)
 
-func init() {
-	// Get absolute path of server root(current executable).
-	serverRoot, _ = GetCurrentExecDir()
-	// Get static folder path.
-	staticFolderPath = path.Join(serverRoot, "./dist/spa")
-	// Get favicon.ico path.
-	faviconPath = path.Join(serverRoot, "favicon.ico")
-	// Get index template file path.
-}
+	if notifiers, err = newNotifiers(settings.Notifiers); err != nil {
+		slog.Error("newNotifiers() error", "err", err)
+		os.Exit(1)
+	}
 
-func main() {
-	var err error
+	slog.Info("participants loaded", "count", len(participants))
+	slog.Debug("participants loaded", "participants", participantList(participants))
+	atomic.StoreInt32(&participantsLoaded, 1)
 
-	flag.Parse()
+	slog.Info("config loaded", "prizes", len(config.Prizes), "blacklists", len(config.Blacklists))
+	atomic.StoreInt32(&configLoaded, 1)
 
-	settings := ServerSettings{}
-	if err = loadServerSettings("server_settings.json", &settings); err != nil {
-		fmt.Printf("loadServerSettings() error: %v\n", err)
-		return
+	if st, err = store.Open(settings.Store, settings.StoreDSN, settings.Event); err != nil {
+		slog.Error("store.Open() error", "store", settings.Store, "err", err)
+		os.Exit(1)
 	}
-
-	fmt.Printf("settings.WSURL: %v\n", settings.WSURL)
-
-	if participants, err = loadParticipants(participantsCSV); err != nil {
-		fmt.Printf("loadParticipants() error: %v\n", err)
-		return
+	defer st.Close()
+
+	// The config and participants loaded from files are saved to the store if it's empty,
+	// otherwise they're replaced by the ones in the store.
+	if err = restoreState(); err != nil {
+		slog.Error("restoreState() error", "err", err)
+		// Deferred functions are not run by os.Exit.
+		st.Close()
+		os.Exit(1)
 	}
+	setDisplay(displayIdle, config.Prizes[0].ID, nil)
 
-	for _, p := range participants {
-		fmt.Printf("id: %v, name: %v\n", p.ID, p.Name)
+	if err = loadFulfillments(settings.FulfillmentFile); err != nil {
+		slog.Error("loadFulfillments() error", "err", err)
+		st.Close()
+		os.Exit(1)
 	}
-	availParticipants = participants
 
-	if err = loadConfig(configFile, &config); err != nil {
-		fmt.Printf("loadConfig() error: %v\n", err)
-		return
+	if err = loadSchedule(settings.ScheduleFile); err != nil {
+		slog.Error("loadSchedule() error", "err", err)
+		st.Close()
+		os.Exit(1)
 	}
-	fmt.Printf("config: %v\n", config)
+	startScheduler()
+
+	reloadInterval, _ := time.ParseDuration(settings.ReloadInterval)
+	startReloader(reloadInterval)
 
-	// Serve Static Files
-	http.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir(staticFolderPath))))
+	// Serve static files: files in static dir override the embedded default front-end.
+	http.Handle("/", newStaticHandler(newStaticFS(settings.StaticDir)))
 
-	//http.HandleFunc("/", serveHome)
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(w, r)
 	})
 
+	http.HandleFunc("/display/ws", serveDisplayWs)
+
+	http.Handle("/admin/", adminHandler())
+
+	http.Handle("/media/", mediaHandler(settings.MediaDir))
+	http.HandleFunc("/api/media", serveMediaUpload)
+	http.HandleFunc("/api/inventory", serveInventory)
+	http.HandleFunc("/api/schedule", serveSchedule)
+	http.Handle("/api/", apiHandler())
+
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", serveHealthz)
+	http.HandleFunc("/readyz", serveReadyz)
+
 	http.HandleFunc("/get-ws-url/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(settings.WSURL))
+		w.Write([]byte(getWSURL(settings, r)))
 	})
 
-	err = http.ListenAndServe(*addr, nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	if tlsEnabled(settings) && settings.TLSSelfSigned {
+		if err = ensureSelfSignedCert(settings.TLSCertFile, settings.TLSKeyFile, settings.TLSHosts); err != nil {
+			slog.Error("ensureSelfSignedCert() error", "err", err)
+			st.Close()
+			os.Exit(1)
+		}
 	}
+
+	if settings.GRPCAddr != "" {
+		if err = startGRPCServer(settings.GRPCAddr); err != nil {
+			slog.Error("startGRPCServer() error", "err", err)
+			st.Close()
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: settings.Addr}
+	go func() {
+		var err error
+		if tlsEnabled(settings) {
+			slog.Info("listening(TLS)", "addr", settings.Addr)
+			err = srv.ListenAndServeTLS(settings.TLSCertFile, settings.TLSKeyFile)
+		} else {
+			slog.Info("listening", "addr", settings.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			slog.Error("ListenAndServe() error", "err", err)
+			st.Close()
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	shutdownTimeout, _ := time.ParseDuration(settings.ShutdownTimeout)
+	slog.Info("shutting down", "timeout", shutdownTimeout, "draw_policy", settings.ShutdownDrawPolicy)
+	shutdown(srv, settings.ShutdownDrawPolicy, shutdownTimeout)
 }
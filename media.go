@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Max size of an uploaded media file.
+var maxMediaSize int64 = 200 << 20
+
+// Allowed extensions of media files and their media types("image" or "video").
+// SVG is not allowed because it may contain scripts.
+var mediaExts = map[string]string{
+	".png":  "image",
+	".jpg":  "image",
+	".jpeg": "image",
+	".gif":  "image",
+	".webp": "image",
+	".mp4":  "video",
+	".webm": "video",
+}
+
+type MediaResponse struct {
+	Success bool     `json:"success"`
+	ErrMsg  string   `json:"err_msg"`
+	URL     string   `json:"url"`
+	Changes []string `json:"changes,omitempty"`
+}
+
+// mediaHandler serves uploaded media files without dir listing.
+func mediaHandler(dir string) http.Handler {
+	fileServer := http.StripPrefix("/media/", http.FileServer(http.Dir(dir)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+func writeMediaResponse(w http.ResponseWriter, status int, res MediaResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// serveMediaUpload handles media uploads: POST /api/media with the file in the "file" field of the multipart form.
+// It returns the URL of the media.
+// If prize_id(or prize_index) and field(image, video or sponsor_logo) are set in the query,
+// the URL is also set to the field of the prize and the config is saved.
+func serveMediaUpload(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, errMsg string) {
+		slog.Warn("media upload error", "remote_addr", r.RemoteAddr, "err", errMsg)
+		writeMediaResponse(w, status, MediaResponse{Success: false, ErrMsg: errMsg})
+	}
+
+	if r.Method != "POST" {
+		fail(http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !checkAdminRequest(r) {
+		fail(http.StatusUnauthorized, "invalid admin token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize)
+	f, header, err := r.FormFile("file")
+	if err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("read file error: %v", err))
+		return
+	}
+	defer f.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	kind, ok := mediaExts[ext]
+	if !ok {
+		fail(http.StatusBadRequest, fmt.Sprintf("unsupported file type: %v", ext))
+		return
+	}
+
+	// Check the content matches the extension.
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	if contentType := http.DetectContentType(buf[:n]); !strings.HasPrefix(contentType, kind+"/") {
+		fail(http.StatusBadRequest, fmt.Sprintf("content type %v does not match %v", contentType, ext))
+		return
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		fail(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name, err := saveMedia(settings.MediaDir, ext, f)
+	if err != nil {
+		fail(http.StatusInternalServerError, fmt.Sprintf("saveMedia() error: %v", err))
+		return
+	}
+
+	res := MediaResponse{Success: true, URL: "/media/" + name}
+	slog.Info("media uploaded", "remote_addr", r.RemoteAddr, "file", header.Filename, "url", res.URL)
+
+	q := r.URL.Query()
+	if q.Get("prize_id") == "" && q.Get("prize_index") == "" {
+		writeMediaResponse(w, http.StatusOK, res)
+		return
+	}
+
+	if res.Changes, err = setPrizeMedia(q.Get("prize_id"), q.Get("prize_index"), q.Get("field"), res.URL); err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	writeMediaResponse(w, http.StatusOK, res)
+}
+
+// saveMedia saves the media to the dir with a random name and returns the name.
+func saveMedia(dir, ext string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := newID() + ext
+	file := filepath.Join(dir, name)
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(file)
+		return "", err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(file)
+		return "", err
+	}
+	return name, nil
+}
+
+// setPrizeMedia sets the URL to the media field of the prize, applies and saves the config.
+func setPrizeMedia(prizeID, prizeIndex, field, URL string) ([]string, error) {
+	changes, err := updateState(func(config Config, participants []Participant) (Config, []Participant, error) {
+		i := lottery.PrizeIndex(config.Prizes, prizeID)
+		if prizeID == "" {
+			n, err := strconv.Atoi(prizeIndex)
+			if err != nil || n < 0 || n >= len(config.Prizes) {
+				return config, participants, fmt.Errorf("invalid prize_index: %v", prizeIndex)
+			}
+			i = n
+		}
+		if i < 0 {
+			return config, participants, fmt.Errorf("unknown prize_id: %v", prizeID)
+		}
+
+		newConfig := config
+		newConfig.Prizes = append([]Prize{}, config.Prizes...)
+
+		p := &newConfig.Prizes[i]
+		switch field {
+		case "image":
+			p.Image = URL
+		case "video":
+			p.Video = URL
+		case "sponsor_logo":
+			p.SponsorLogo = URL
+		default:
+			return config, participants, fmt.Errorf("invalid field: %v", field)
+		}
+		return newConfig, participants, nil
+	}, persistConfig)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
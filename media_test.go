@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Content of a PNG file detected by http.DetectContentType.
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+// uploadMedia uploads the file to serveMediaUpload and returns the status and the response.
+func uploadMedia(t *testing.T, query, token, filename string, content []byte) (int, MediaResponse) {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile() error: %v", err)
+	}
+	fw.Write(content)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/media?"+query, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	serveMediaUpload(w, r)
+
+	var res MediaResponse
+	if err = json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Decode() error: %v", err)
+	}
+	return w.Code, res
+}
+
+func TestMediaUploadErrors(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	old := maxMediaSize
+	maxMediaSize = 1024
+	t.Cleanup(func() { maxMediaSize = old })
+
+	tests := []struct {
+		name     string
+		query    string
+		token    string
+		filename string
+		content  []byte
+		status   int
+		err      string
+	}{
+		{"no token", "", "", "logo.png", testPNG, http.StatusUnauthorized, "invalid admin token"},
+		{"wrong token", "", "wrong", "logo.png", testPNG, http.StatusUnauthorized, "invalid admin token"},
+		{"svg", "", "secret", "logo.svg", []byte("<svg></svg>"), http.StatusBadRequest, "unsupported file type: .svg"},
+		{"content mismatch", "", "secret", "logo.png", []byte("<html><script></script></html>"), http.StatusBadRequest, "does not match .png"},
+		{"video as image", "", "secret", "clip.mp4", testPNG, http.StatusBadRequest, "does not match .mp4"},
+		{"too large", "", "secret", "logo.png", append(testPNG, make([]byte, 2048)...), http.StatusBadRequest, "request body too large"},
+		{"unknown prize", "prize_id=4th&field=image", "secret", "logo.png", testPNG, http.StatusBadRequest, "unknown prize_id: 4th"},
+		{"invalid prize index", "prize_index=3&field=image", "secret", "logo.png", testPNG, http.StatusBadRequest, "invalid prize_index: 3"},
+		{"invalid field", "prize_id=1st&field=content", "secret", "logo.png", testPNG, http.StatusBadRequest, "invalid field: content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := uploadMedia(t, tt.query, tt.token, tt.filename, tt.content)
+			if status != tt.status || res.Success || !strings.Contains(res.ErrMsg, tt.err) {
+				t.Errorf("upload = %v %+v, want %v %q", status, res, tt.status, tt.err)
+			}
+		})
+	}
+
+	// Config is not changed by failed uploads.
+	for _, p := range currentConfig().Prizes {
+		if p.Image != "" {
+			t.Errorf("image of %v = %v, want empty", p.ID, p.Image)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	serveMediaUpload(w, httptest.NewRequest("GET", "/api/media", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/media = %v, want 405", w.Code)
+	}
+}
+
+func TestMediaUpload(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+
+	status, res := uploadMedia(t, "", "", "Logo.PNG", testPNG)
+	if status != http.StatusOK || !res.Success || !strings.HasPrefix(res.URL, "/media/") || !strings.HasSuffix(res.URL, ".png") {
+		t.Fatalf("upload = %v %+v, want the URL of the media", status, res)
+	}
+	buf, err := os.ReadFile(filepath.Join(settings.MediaDir, strings.TrimPrefix(res.URL, "/media/")))
+	if err != nil || !bytes.Equal(buf, testPNG) {
+		t.Errorf("saved media = %v bytes, %v, want %v bytes", len(buf), err, len(testPNG))
+	}
+
+	// Media are served without dir listing.
+	h := mediaHandler(settings.MediaDir)
+	if status, body := getStatic(t, h, "GET", res.URL); status != http.StatusOK || body != string(testPNG) {
+		t.Errorf("GET %v = %v, want the media", res.URL, status)
+	}
+	if status, _ := getStatic(t, h, "GET", "/media/"); status != http.StatusNotFound {
+		t.Errorf("GET /media/ = %v, want 404", status)
+	}
+
+	// The URL is set to the field of the prize, and the config is saved.
+	status, res = uploadMedia(t, "prize_id=1st&field=sponsor_logo", "", "logo.png", testPNG)
+	if status != http.StatusOK || !res.Success || len(res.Changes) == 0 {
+		t.Fatalf("upload to 1st = %v %+v, want changes", status, res)
+	}
+	if p := currentConfig().Prizes[2]; p.SponsorLogo != res.URL {
+		t.Errorf("sponsor_logo of 1st = %v, want %v", p.SponsorLogo, res.URL)
+	}
+	var saved Config
+	if err = loadConfig(settings.ConfigFile, &saved); err != nil || saved.Prizes[2].SponsorLogo != res.URL {
+		t.Errorf("saved sponsor_logo of 1st = %+v, %v, want %v", saved.Prizes, err, res.URL)
+	}
+
+	// Prize indexes are used if prize_id is not set.
+	status, res = uploadMedia(t, "prize_index=0&field=image", "", "photo.jpg", append([]byte("\xff\xd8\xff"), make([]byte, 64)...))
+	if status != http.StatusOK || currentConfig().Prizes[0].Image != res.URL {
+		t.Errorf("upload to prize 0 = %v %+v, image = %v", status, res, currentConfig().Prizes[0].Image)
+	}
+}
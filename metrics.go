@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// Set to 1 when participants / config are loaded.
+	participantsLoaded int32
+	configLoaded       int32
+)
+
+var (
+	connectedClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "lottery_connected_clients",
+		Help: "Number of connected websocket clients.",
+	})
+
+	drawsStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "lottery_draws_started_total",
+		Help: "Number of started draws.",
+	})
+
+	drawsStopped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "lottery_draws_stopped_total",
+		Help: "Number of stopped draws.",
+	})
+
+	drawsAborted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "lottery_draws_aborted_total",
+		Help: "Number of aborted draws.",
+	})
+
+	drawsCommitted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "lottery_draws_committed_total",
+		Help: "Number of draws which winners are committed.",
+	})
+
+	tickSendSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "lottery_tick_send_seconds",
+		Help:    "Time to marshal and queue a rolling winners message to the client.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+
+	droppedMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "lottery_dropped_messages_total",
+		Help: "Number of messages dropped because the client send buffer is full.",
+	})
+
+	eligibleParticipants = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lottery_eligible_participants",
+		Help: "Number of eligible participants of the latest draw of the prize.",
+	}, []string{"prize_id"})
+
+	actionErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lottery_action_errors_total",
+		Help: "Number of failed actions.",
+	}, []string{"action"})
+)
+
+// countActionError increases the error counter of the action.
+// Unknown action names are counted as "unknown" to keep the label set small.
+func countActionError(action string) {
+	switch action {
+	case "get_prizes", "get_winners", "start", "stop", "abort", "display_prize",
+		"get_config", "update_config", "get_participants", "update_participants", "get_history", "get_audit",
+		"get_inventory", "claim_prize", "ship_prize":
+	default:
+		action = "unknown"
+	}
+	actionErrors.WithLabelValues(action).Inc()
+}
+
+func setEligibleParticipants(prizeID string, n int) {
+	eligibleParticipants.WithLabelValues(prizeID).Set(float64(n))
+}
+
+func ready() bool {
+	return atomic.LoadInt32(&participantsLoaded) == 1 && atomic.LoadInt32(&configLoaded) == 1 && !shuttingDown()
+}
+
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func serveReadyz(w http.ResponseWriter, r *http.Request) {
+	if !ready() {
+		http.Error(w, "participants or config not loaded, or shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("/healthz = %v %q, want 200 ok", w.Code, w.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Cleanup(func() {
+		atomic.StoreInt32(&participantsLoaded, 0)
+		atomic.StoreInt32(&configLoaded, 0)
+		atomic.StoreInt32(&shutdownFlag, 0)
+	})
+
+	tests := []struct {
+		name         string
+		participants int32
+		config       int32
+		shutdown     int32
+		code         int
+	}{
+		{"not loaded", 0, 0, 0, http.StatusServiceUnavailable},
+		{"participants not loaded", 0, 1, 0, http.StatusServiceUnavailable},
+		{"config not loaded", 1, 0, 0, http.StatusServiceUnavailable},
+		{"ready", 1, 1, 0, http.StatusOK},
+		{"shutting down", 1, 1, 1, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&participantsLoaded, tt.participants)
+			atomic.StoreInt32(&configLoaded, tt.config)
+			atomic.StoreInt32(&shutdownFlag, tt.shutdown)
+
+			w := httptest.NewRecorder()
+			serveReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tt.code {
+				t.Errorf("/readyz = %v, want %v", w.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestDrawMetrics(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	started, stopped := testutil.ToFloat64(drawsStarted), testutil.ToFloat64(drawsStopped)
+	aborted, committed := testutil.ToFloat64(drawsAborted), testutil.ToFloat64(drawsCommitted)
+	stopErrors := testutil.ToFloat64(actionErrors.WithLabelValues("stop"))
+
+	c.draw("3rd", nil, 1)
+	if got := testutil.ToFloat64(eligibleParticipants.WithLabelValues("3rd")); got != 10 {
+		t.Errorf("eligible participants of 3rd = %v, want 10", got)
+	}
+
+	// Aborted draws are not committed.
+	id := c.send(Action{Name: "start", PrizeID: "2nd"})
+	c.waitFor(id, "start")
+	c.send(Action{Name: "abort"})
+	c.waitFor(id, "abort")
+
+	if res := c.do(Action{Name: "stop"}); res.Success {
+		t.Fatalf("stop without draw = %+v, want error", res)
+	}
+
+	for _, m := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"started", testutil.ToFloat64(drawsStarted) - started, 2},
+		{"stopped", testutil.ToFloat64(drawsStopped) - stopped, 1},
+		{"aborted", testutil.ToFloat64(drawsAborted) - aborted, 1},
+		{"committed", testutil.ToFloat64(drawsCommitted) - committed, 1},
+		{"stop errors", testutil.ToFloat64(actionErrors.WithLabelValues("stop")) - stopErrors, 1},
+	} {
+		if m.got != m.want {
+			t.Errorf("draws %v = %v, want %v", m.name, m.got, m.want)
+		}
+	}
+}
+
+func TestCountActionError(t *testing.T) {
+	unknown := testutil.ToFloat64(actionErrors.WithLabelValues("unknown"))
+	n := testutil.CollectAndCount(actionErrors)
+
+	// Unknown names do not add label values.
+	countActionError("drop_table")
+	countActionError("")
+	if got := testutil.ToFloat64(actionErrors.WithLabelValues("unknown")) - unknown; got != 2 {
+		t.Errorf("unknown action errors = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(actionErrors); got != n {
+		t.Errorf("label values = %v, want %v", got, n)
+	}
+}
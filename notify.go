@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// Time allowed for a notifier to deliver one draw event(including retries).
+	notifyTimeout = 60 * time.Second
+
+	// Default retries of outbound HTTP notifications.
+	defaultMaxRetries = 3
+
+	// Time allowed for one outbound HTTP request.
+	httpNotifyTimeout = 10 * time.Second
+
+	// Time allowed for one SMTP session(dial, auth and sending one email).
+	smtpTimeout = 30 * time.Second
+
+	defaultEmailSubject = `Congratulations! You won {{.Prize.Name}}`
+	defaultEmailBody    = `Dear {{.Winner.Name}},
+
+Congratulations! You won {{.Prize.Name}}{{if .Prize.Content}}: {{.Prize.Content}}{{end}}.
+`
+)
+
+var (
+	// Delay before the first retry. It's doubled after each retry.
+	retryBaseDelay = 1 * time.Second
+
+	notifiers   []Notifier
+	notifyHTTPC = &http.Client{Timeout: httpNotifyTimeout}
+	notifyWG    sync.WaitGroup
+)
+
+// DrawEvent is sent to notifiers when winners of a draw are committed.
+type DrawEvent struct {
+	Event            string        `json:"event"`
+	Time             time.Time     `json:"time"`
+	PrizeID          string        `json:"prize_id"`
+	PrizeIndex       int           `json:"prize_index"`
+	Prize            Prize         `json:"prize"`
+	OldWinnerIndexes []int         `json:"old_winner_indexes"`
+	Drawn            []Participant `json:"drawn"`
+	Winners          []Participant `json:"winners"`
+}
+
+// Notifier delivers draw events to an external system.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, e DrawEvent) error
+}
+
+type NotifierSettings struct {
+	Webhooks []WebhookSettings `json:"webhooks"`
+	SMTP     *SMTPSettings     `json:"smtp"`
+	Bots     []BotSettings     `json:"bots"`
+}
+
+type WebhookSettings struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+type SMTPSettings struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+}
+
+type BotSettings struct {
+	Type       string `json:"type"`
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+// newNotifiers creates notifiers from the settings.
+func newNotifiers(s NotifierSettings) ([]Notifier, error) {
+	var ns []Notifier
+
+	for _, w := range s.Webhooks {
+		if w.URL == "" {
+			return nil, fmt.Errorf("webhook: empty url")
+		}
+		ns = append(ns, &WebhookNotifier{w})
+	}
+
+	if s.SMTP != nil {
+		n, err := newEmailNotifier(*s.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+
+	for _, b := range s.Bots {
+		if b.URL == "" {
+			return nil, fmt.Errorf("%v bot: empty url", b.Type)
+		}
+		switch b.Type {
+		case "slack", "dingtalk", "wecom":
+		default:
+			return nil, fmt.Errorf("unknown bot type: %v", b.Type)
+		}
+		ns = append(ns, &BotNotifier{b})
+	}
+
+	return ns, nil
+}
+
+// notifyDrawCommitted sends the draw event to all notifiers in background.
+func notifyDrawCommitted(e DrawEvent) {
+	for _, n := range notifiers {
+		notifyWG.Add(1)
+		go func(n Notifier) {
+			defer notifyWG.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+
+			if err := n.Notify(ctx, e); err != nil {
+				slog.Error("notify error", "notifier", n.Name(), "prize_id", e.PrizeID, "err", err)
+			}
+		}(n)
+	}
+}
+
+// postJSON posts the JSON payload to the URL and retries on network errors, 429 and 5xx responses.
+func postJSON(ctx context.Context, URL string, payload []byte, header http.Header, maxRetries int) error {
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	var err error
+	delay := retryBaseDelay
+
+	for i := 0; i <= maxRetries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%v, last error: %v", ctx.Err(), err)
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		var retry bool
+		if retry, err = post(ctx, URL, payload, header); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func post(ctx context.Context, URL string, payload []byte, header http.Header) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notifyHTTPC.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("POST %v: %v", URL, resp.Status)
+}
+
+// WebhookNotifier posts draw events as JSON.
+// If secret is set, the body is signed with HMAC-SHA256 and
+// the signature is set in "X-Lottery-Signature" header: "sha256=<hex>".
+type WebhookNotifier struct {
+	settings WebhookSettings
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, e DrawEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("X-Lottery-Event", e.Event)
+	if n.settings.Secret != "" {
+		header.Set("X-Lottery-Signature", "sha256="+signWebhook(n.settings.Secret, buf))
+	}
+
+	return postJSON(ctx, n.settings.URL, buf, header, n.settings.MaxRetries)
+}
+
+// signWebhook returns the hex encoded HMAC-SHA256 of the body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EmailNotifier sends an email to each drawn winner which has an email address.
+type EmailNotifier struct {
+	settings SMTPSettings
+	subject  *template.Template
+	body     *template.Template
+}
+
+type emailData struct {
+	Prize  Prize
+	Winner Participant
+}
+
+func newEmailNotifier(s SMTPSettings) (*EmailNotifier, error) {
+	if s.Addr == "" || s.From == "" {
+		return nil, fmt.Errorf("smtp: addr and from are required")
+	}
+	if s.Subject == "" {
+		s.Subject = defaultEmailSubject
+	}
+	if s.Body == "" {
+		s.Body = defaultEmailBody
+	}
+
+	subject, err := template.New("subject").Parse(s.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: subject template error: %v", err)
+	}
+	body, err := template.New("body").Parse(s.Body)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: body template error: %v", err)
+	}
+
+	return &EmailNotifier{s, subject, body}, nil
+}
+
+func (n *EmailNotifier) Name() string {
+	return "smtp"
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, e DrawEvent) error {
+	var auth smtp.Auth
+	if n.settings.Username != "" {
+		host := n.settings.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", n.settings.Username, n.settings.Password, host)
+	}
+
+	var errs []string
+	for _, w := range e.Drawn {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if w.Email == "" {
+			continue
+		}
+
+		msg, err := n.message(emailData{e.Prize, w})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", redact(w.Email), err))
+			continue
+		}
+
+		if err = sendMail(ctx, n.settings.Addr, auth, n.settings.From, w.Email, msg); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", redact(w.Email), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("send mail error: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sendMail sends the email like smtp.SendMail, but the session is limited by ctx and smtpTimeout,
+// so that a stuck SMTP server does not block the notifier.
+func sendMail(ctx context.Context, addr string, auth smtp.Auth, from, to string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Reads and writes fail after the timeout or when ctx is cancelled.
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// checkEmailAddress checks the email address from the participants CSV before it's written to the header,
+// e.g. "a@example.com\r\nBcc: b@example.com" injects a header.
+func checkEmailAddress(addr string) error {
+	if strings.ContainsAny(addr, "\r\n") {
+		return fmt.Errorf("invalid email address: contains CR or LF")
+	}
+	if _, err := mail.ParseAddress(addr); err != nil {
+		return fmt.Errorf("invalid email address: %v", err)
+	}
+	return nil
+}
+
+func (n *EmailNotifier) message(data emailData) ([]byte, error) {
+	if err := checkEmailAddress(data.Winner.Email); err != nil {
+		return nil, err
+	}
+
+	var subject, body bytes.Buffer
+
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := n.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", n.settings.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", data.Winner.Email)
+	fmt.Fprintf(&msg, "Subject: =?UTF-8?B?%v?=\r\n", base64.StdEncoding.EncodeToString(subject.Bytes()))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	msg.WriteString(strings.Replace(body.String(), "\n", "\r\n", -1))
+	return msg.Bytes(), nil
+}
+
+// BotNotifier posts a text message to a chat bot webhook.
+// Supported types: "slack", "dingtalk" and "wecom".
+type BotNotifier struct {
+	settings BotSettings
+}
+
+func (n *BotNotifier) Name() string {
+	return n.settings.Type + " bot"
+}
+
+func (n *BotNotifier) Notify(ctx context.Context, e DrawEvent) error {
+	text := botText(e)
+
+	var payload interface{}
+	URL := n.settings.URL
+
+	switch n.settings.Type {
+	case "slack":
+		payload = map[string]interface{}{"text": text}
+	case "dingtalk":
+		payload = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+		if n.settings.Secret != "" {
+			URL = signDingTalkURL(URL, n.settings.Secret, time.Now())
+		}
+	case "wecom":
+		payload = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+	default:
+		return fmt.Errorf("unknown bot type: %v", n.settings.Type)
+	}
+
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, URL, buf, nil, n.settings.MaxRetries)
+}
+
+func botText(e DrawEvent) string {
+	var names []string
+	for _, w := range e.Drawn {
+		names = append(names, w.Name)
+	}
+
+	title := fmt.Sprintf("Winners of %v", e.Prize.Name)
+	if len(e.OldWinnerIndexes) > 0 {
+		title = fmt.Sprintf("Re-lottery winners of %v", e.Prize.Name)
+	}
+	return fmt.Sprintf("%v: %v", title, strings.Join(names, ", "))
+}
+
+// signDingTalkURL appends "timestamp" and "sign" to the DingTalk robot webhook URL.
+// sign = base64(HMAC-SHA256(secret, timestamp + "\n" + secret)).
+func signDingTalkURL(URL, secret string, t time.Time) string {
+	timestamp := strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	sep := "?"
+	if strings.Contains(URL, "?") {
+		sep = "&"
+	}
+	return URL + sep + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifyServer is a stand-in server of webhooks and chat bots.
+// It responds with the statuses in order, then 200.
+type notifyServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newNotifyServer(t *testing.T, statuses ...int) *notifyServer {
+	t.Helper()
+
+	// Retries are not delayed in tests.
+	delay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = delay })
+
+	s := &notifyServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// received returns the number of received requests.
+func (s *notifyServer) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+// request returns the i-th received request and its body.
+func (s *notifyServer) request(i int) (*http.Request, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[i], s.bodies[i]
+}
+
+func testDrawEvent() DrawEvent {
+	winners := testParticipants(2)
+	return DrawEvent{
+		Event:   "draw_committed",
+		Time:    time.Now(),
+		PrizeID: "1st",
+		Prize:   Prize{ID: "1st", Name: "1st"},
+		Drawn:   winners,
+		Winners: winners,
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	s := newNotifyServer(t)
+	n := &WebhookNotifier{WebhookSettings{URL: s.URL, Secret: "secret"}}
+
+	if err := n.Notify(context.Background(), testDrawEvent()); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+	if s.received() != 1 {
+		t.Fatalf("requests = %v, want 1", s.received())
+	}
+
+	r, body := s.request(0)
+	if got := r.Header.Get("X-Lottery-Event"); got != "draw_committed" {
+		t.Errorf("X-Lottery-Event = %q, want draw_committed", got)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if got, want := r.Header.Get("X-Lottery-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("X-Lottery-Signature = %q, want %q", got, want)
+	}
+
+	var e DrawEvent
+	if err := json.Unmarshal(body, &e); err != nil || e.PrizeID != "1st" || len(e.Winners) != 2 {
+		t.Errorf("body = %s, %v, want the draw event", body, err)
+	}
+}
+
+func TestWebhookNotifierWithoutSecret(t *testing.T) {
+	s := newNotifyServer(t)
+	n := &WebhookNotifier{WebhookSettings{URL: s.URL}}
+
+	if err := n.Notify(context.Background(), testDrawEvent()); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+	if r, _ := s.request(0); r.Header.Get("X-Lottery-Signature") != "" {
+		t.Errorf("X-Lottery-Signature = %q, want no signature", r.Header.Get("X-Lottery-Signature"))
+	}
+}
+
+func TestPostJSONRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		requests   int
+		err        bool
+	}{
+		{"ok", nil, 3, 1, false},
+		{"retry 429 and 5xx", []int{429, 500, 503}, 3, 4, false},
+		{"retries exhausted", []int{500, 502, 503}, 2, 3, true},
+		{"default retries", []int{500, 500, 500, 500, 500}, 0, defaultMaxRetries + 1, true},
+		{"no retry on 4xx", []int{400}, 3, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNotifyServer(t, tt.statuses...)
+
+			err := postJSON(context.Background(), s.URL, []byte(`{}`), nil, tt.maxRetries)
+			if (err != nil) != tt.err {
+				t.Fatalf("postJSON() error = %v, want error: %v", err, tt.err)
+			}
+			if s.received() != tt.requests {
+				t.Errorf("requests = %v, want %v", s.received(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestPostJSONContextDone(t *testing.T) {
+	s := newNotifyServer(t, 500, 500, 500)
+	retryBaseDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := postJSON(ctx, s.URL, []byte(`{}`), nil, 3); err == nil || !strings.Contains(err.Error(), "last error") {
+		t.Fatalf("postJSON() error = %v, want the context error with the last error", err)
+	}
+	if s.received() != 1 {
+		t.Errorf("requests = %v, want 1", s.received())
+	}
+}
+
+func TestDingTalkBot(t *testing.T) {
+	s := newNotifyServer(t)
+	n := &BotNotifier{BotSettings{Type: "dingtalk", URL: s.URL + "/robot/send?access_token=x", Secret: "secret"}}
+
+	if err := n.Notify(context.Background(), testDrawEvent()); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	r, body := s.request(0)
+	q := r.URL.Query()
+	if q.Get("access_token") != "x" {
+		t.Errorf("access_token = %q, want x", q.Get("access_token"))
+	}
+	timestamp := q.Get("timestamp")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(timestamp + "\n" + "secret"))
+	if got, want := q.Get("sign"), base64.StdEncoding.EncodeToString(mac.Sum(nil)); timestamp == "" || got != want {
+		t.Errorf("timestamp = %q, sign = %q, want %q", timestamp, got, want)
+	}
+
+	var payload struct {
+		MsgType string            `json:"msgtype"`
+		Text    map[string]string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.MsgType != "text" || payload.Text["content"] != "Winners of 1st: P1, P2" {
+		t.Errorf("payload = %s, %v", body, err)
+	}
+}
+
+func TestSignDingTalkURL(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+
+	got := signDingTalkURL("https://oapi.dingtalk.com/robot/send", "SEC", ts)
+	if !strings.HasPrefix(got, "https://oapi.dingtalk.com/robot/send?timestamp=1700000000000&sign=") {
+		t.Errorf("signDingTalkURL() = %v", got)
+	}
+	if got = signDingTalkURL("https://x/send?access_token=t", "SEC", ts); !strings.Contains(got, "?access_token=t&timestamp=1700000000000&sign=") {
+		t.Errorf("signDingTalkURL() with a query = %v", got)
+	}
+}
+
+func TestSlackBotRetries(t *testing.T) {
+	s := newNotifyServer(t, 429)
+	n := &BotNotifier{BotSettings{Type: "slack", URL: s.URL, MaxRetries: 1}}
+
+	e := testDrawEvent()
+	e.OldWinnerIndexes = []int{0}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+	if s.received() != 2 {
+		t.Fatalf("requests = %v, want 2", s.received())
+	}
+	if _, body := s.request(1); string(body) != `{"text":"Re-lottery winners of 1st: P1, P2"}` {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestNewNotifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings NotifierSettings
+		n        int
+		err      bool
+	}{
+		{"none", NotifierSettings{}, 0, false},
+		{"all", NotifierSettings{
+			Webhooks: []WebhookSettings{{URL: "http://x"}},
+			SMTP:     &SMTPSettings{Addr: "localhost:25", From: "lottery@example.com"},
+			Bots:     []BotSettings{{Type: "wecom", URL: "http://x"}},
+		}, 3, false},
+		{"webhook without url", NotifierSettings{Webhooks: []WebhookSettings{{}}}, 0, true},
+		{"smtp without from", NotifierSettings{SMTP: &SMTPSettings{Addr: "localhost:25"}}, 0, true},
+		{"smtp template error", NotifierSettings{SMTP: &SMTPSettings{Addr: "localhost:25", From: "x", Body: "{{"}}, 0, true},
+		{"unknown bot", NotifierSettings{Bots: []BotSettings{{Type: "irc", URL: "http://x"}}}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, err := newNotifiers(tt.settings)
+			if (err != nil) != tt.err {
+				t.Fatalf("newNotifiers() error = %v, want error: %v", err, tt.err)
+			}
+			if len(ns) != tt.n {
+				t.Errorf("newNotifiers() = %v notifiers, want %v", len(ns), tt.n)
+			}
+		})
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	n, err := newEmailNotifier(SMTPSettings{Addr: "localhost:25", From: "lottery@example.com"})
+	if err != nil {
+		t.Fatalf("newEmailNotifier() error: %v", err)
+	}
+
+	msg, err := n.message(emailData{Prize{Name: "1st"}, Participant{Name: "Frank", Email: "frank@example.com"}})
+	if err != nil {
+		t.Fatalf("message() error: %v", err)
+	}
+	for _, want := range []string{"To: frank@example.com\r\n", "Dear Frank,\r\n", "You won 1st.\r\n"} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("message() = %q, want %q", msg, want)
+		}
+	}
+}
+
+func TestEmailMessageInvalidAddress(t *testing.T) {
+	n, err := newEmailNotifier(SMTPSettings{Addr: "localhost:25", From: "lottery@example.com"})
+	if err != nil {
+		t.Fatalf("newEmailNotifier() error: %v", err)
+	}
+
+	for _, email := range []string{
+		"frank@example.com\r\nBcc: eve@example.com",
+		"frank@example.com\nBcc: eve@example.com",
+		"frank@example.com\r",
+		"not an address",
+	} {
+		if msg, err := n.message(emailData{Prize{Name: "1st"}, Participant{Name: "Frank", Email: email}}); err == nil {
+			t.Errorf("message() of %q = %q, want error", email, msg)
+		}
+	}
+}
+
+// smtpServer is a stand-in SMTP server on 127.0.0.1 which records recipients and messages.
+// Recipients starting with "reject" are refused. If stuck is true, it never greets clients.
+type smtpServer struct {
+	l     net.Listener
+	stuck bool
+
+	mu       sync.Mutex
+	rcpts    []string
+	messages []string
+}
+
+func newSMTPServer(t *testing.T, stuck bool) *smtpServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	s := &smtpServer{l: l, stuck: stuck}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	if s.stuck {
+		io.Copy(io.Discard, conn)
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%v\r\n", line) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch {
+		case cmd == "EHLO" || cmd == "HELO":
+			reply("250 localhost")
+		case cmd == "MAIL":
+			reply("250 OK")
+		case cmd == "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>")
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, rcpt)
+			s.mu.Unlock()
+			if strings.HasPrefix(rcpt, "reject") {
+				reply("550 no such user")
+				continue
+			}
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	s := newSMTPServer(t, false)
+	n, err := newEmailNotifier(SMTPSettings{Addr: s.l.Addr().String(), From: "lottery@example.com"})
+	if err != nil {
+		t.Fatalf("newEmailNotifier() error: %v", err)
+	}
+
+	e := DrawEvent{Prize: Prize{Name: "1st"}, Drawn: []Participant{
+		{ID: "1", Name: "Frank", Email: "frank@example.com"},
+		{ID: "2", Name: "Bob"},
+		{ID: "3", Name: "Eve", Email: "reject@example.com"},
+		{ID: "4", Name: "Alice", Email: "alice@example.com"},
+	}}
+
+	// Emails are sent to other winners if one fails.
+	err = n.Notify(context.Background(), e)
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("Notify() error = %v, want the error of the refused recipient", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if got := strings.Join(s.rcpts, ","); got != "frank@example.com,reject@example.com,alice@example.com" {
+		t.Errorf("RCPT = %v, want winners with emails", got)
+	}
+	if len(s.messages) != 2 || !strings.Contains(s.messages[0], "Dear Frank,\r\n") || !strings.Contains(s.messages[1], "To: alice@example.com\r\n") {
+		t.Errorf("DATA = %q, want messages to Frank and Alice", s.messages)
+	}
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	s := newSMTPServer(t, true)
+	n, err := newEmailNotifier(SMTPSettings{Addr: s.l.Addr().String(), From: "lottery@example.com"})
+	if err != nil {
+		t.Fatalf("newEmailNotifier() error: %v", err)
+	}
+
+	// A stuck server does not block the notifier after ctx is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = n.Notify(ctx, DrawEvent{Prize: Prize{Name: "1st"}, Drawn: []Participant{{ID: "1", Name: "Frank", Email: "frank@example.com"}}})
+	if err == nil {
+		t.Fatalf("Notify() error = nil, want timeout")
+	}
+	if d := time.Since(start); d > testTimeout {
+		t.Errorf("Notify() returned after %v, want after ctx is done", d)
+	}
+}
+
+// recordNotifier records draw events.
+type recordNotifier struct {
+	events chan DrawEvent
+}
+
+func (n *recordNotifier) Name() string {
+	return "record"
+}
+
+func (n *recordNotifier) Notify(ctx context.Context, e DrawEvent) error {
+	n.events <- e
+	return nil
+}
+
+func TestNotifyDrawPrize(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+	n := &recordNotifier{make(chan DrawEvent, 1)}
+	old := notifiers
+	notifiers = []Notifier{n}
+	t.Cleanup(func() {
+		notifyWG.Wait()
+		notifiers = old
+	})
+
+	// The prize index is resolved before the config is changed(e.g. prizes are reordered).
+	a := Action{Name: "start", PrizeID: "1st", PrizeIndex: 0, RequestID: newID()}
+	if errMsg := startDraw(nil, a); errMsg != "" {
+		t.Fatalf("startDraw() error: %v", errMsg)
+	}
+	if errMsg := stopDraw(nil, Action{Name: "stop", RequestID: newID()}); errMsg != "" {
+		t.Fatalf("stopDraw() error: %v", errMsg)
+	}
+
+	select {
+	case e := <-n.events:
+		if e.PrizeID != "1st" || e.PrizeIndex != 2 || e.Prize.ID != "1st" || len(e.Drawn) != 1 {
+			t.Errorf("draw event = %+v, want the draw of 1st", e)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("no draw event")
+	}
+}
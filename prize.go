@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// resolvePrize sets the prize index of the action by the prize ID,
+// or sets the prize ID by the prize index for old clients.
+// The prize index is set to -1 if the prize ID is not found.
+func resolvePrize(a *Action, prizes []Prize) {
+	if a.PrizeID != "" {
+		a.PrizeIndex = lottery.PrizeIndex(prizes, a.PrizeID)
+		return
+	}
+
+	if a.PrizeIndex >= 0 && a.PrizeIndex < len(prizes) {
+		a.PrizeID = prizes[a.PrizeIndex].ID
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Interval to retry a pending reload when a draw is running.
+const reloadRetryInterval = time.Second
+
+var errDrawRunning = errors.New("a draw is running")
+
+type StateChangedResponse struct {
+	CommonResponse
+	Prizes  []Prize  `json:"prizes"`
+	Changes []string `json:"changes"`
+}
+
+// fileStamp is used to detect changes of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func getFileStamp(file string) fileStamp {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{fi.ModTime(), fi.Size()}
+}
+
+// startReloader reloads config and participants when SIGHUP is received or
+// the files are modified(checked every interval, 0 to disable).
+// The reload is postponed until the running draw is stopped.
+func startReloader(interval time.Duration) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	tickInterval := interval
+	if tickInterval <= 0 {
+		tickInterval = reloadRetryInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		pending := false
+		configStamp := getFileStamp(settings.ConfigFile)
+		participantsStamp := getFileStamp(settings.ParticipantsFile)
+
+		for {
+			select {
+			case <-sighup:
+				slog.Info("SIGHUP received, reload")
+				pending = true
+			case <-ticker.C:
+				if interval > 0 {
+					c := getFileStamp(settings.ConfigFile)
+					p := getFileStamp(settings.ParticipantsFile)
+					if c != configStamp || p != participantsStamp {
+						slog.Info("files modified, reload")
+						configStamp, participantsStamp = c, p
+						pending = true
+					}
+				}
+			}
+
+			if !pending {
+				continue
+			}
+
+			changes, err := reload()
+			if err == errDrawRunning {
+				slog.Info("reload postponed", "reason", err)
+				continue
+			}
+
+			pending = false
+			if err != nil {
+				slog.Error("reload error", "err", err)
+				continue
+			}
+			slog.Info("reloaded", "changes", changes)
+		}
+	}()
+}
+
+// reload re-reads config and participants and applies the changes if they're safe.
+// It returns errDrawRunning if a draw is running.
+func reload() ([]string, error) {
+	newParticipants, err := loadParticipants(settings.ParticipantsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loadParticipants() error: %v", err)
+	}
+
+	var newConfig Config
+	if err = loadConfig(settings.ConfigFile, &newConfig); err != nil {
+		return nil, fmt.Errorf("loadConfig() error: %v", err)
+	}
+
+	return updateState(func(Config, []Participant) (Config, []Participant, error) {
+		return newConfig, newParticipants, nil
+	}, nil)
+}
+
+// currentConfig returns the current config.
+// It's replaced as a whole by applyState and never modified in place, so the returned config can be read without locks.
+func currentConfig() Config {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	return config
+}
+
+// currentParticipants returns the current participants. Like currentConfig, they're never modified in place.
+func currentParticipants() []Participant {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	return participants
+}
+
+// updateState applies the config and participants returned by update with the current ones, and persists them by persist, see applyState.
+// Updates are serialized, so that none of them is lost by concurrent updates.
+func updateState(update func(Config, []Participant) (Config, []Participant, error), persist func(Config, []Participant) error) ([]string, error) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	newConfig, newParticipants, err := update(currentConfig(), currentParticipants())
+	if err != nil {
+		return nil, err
+	}
+	return applyState(newConfig, newParticipants, persist)
+}
+
+// applyState validates the new config and participants and applies the changes if they're safe.
+// It returns errDrawRunning if a draw is running.
+// If persist is not nil, it's called to write the files before the changes are published,
+// and the changes are rolled back if it fails, so that the files always match the live state.
+// Changes made from the current config or participants should be applied by updateState.
+func applyState(newConfig Config, newParticipants []Participant, persist func(Config, []Participant) error) ([]string, error) {
+	if err := lottery.ValidateConfig(newConfig, newParticipants); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%v", err)
+	}
+
+	// No draw can be started while the changes are applied.
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	if cancel != nil {
+		return nil, errDrawRunning
+	}
+
+	// Apply the changes atomically under the draw lock, start() of the last draw may not return yet.
+	if !mutex.TryLock() {
+		return nil, errDrawRunning
+	}
+	defer mutex.Unlock()
+
+	oldConfig, oldParticipants := currentConfig(), currentParticipants()
+	changes, err := diffState(oldConfig, oldParticipants, newConfig, newParticipants, lot.AllWinners())
+	if err != nil {
+		return nil, fmt.Errorf("unsafe changes:\n%v", err)
+	}
+
+	if len(changes) > 0 {
+		if err = lot.SetState(newConfig, newParticipants); err != nil {
+			return nil, fmt.Errorf("invalid config:\n%v", err)
+		}
+	}
+
+	if persist != nil {
+		if err = persist(newConfig, newParticipants); err != nil {
+			if len(changes) > 0 {
+				// No draw can be started, the state is not published yet.
+				lot.SetState(oldConfig, oldParticipants)
+			}
+			return nil, err
+		}
+	}
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	stateMu.Lock()
+	config, participants = newConfig, newParticipants
+	stateMu.Unlock()
+	saveState(newConfig, newParticipants)
+
+	commonRes := CommonResponse{Success: true, ErrMsg: "", Action: Action{Name: "state_changed"}}
+	res := StateChangedResponse{commonRes, newConfig.Prizes, changes}
+	hub.broadcast(res)
+	eventFeed.publish(res.Name, res)
+	refreshDisplay()
+
+	return changes, nil
+}
+
+func allWinners(winnerMap map[string][]Participant) []Participant {
+	var winners []Participant
+	for _, w := range winnerMap {
+		winners = append(winners, w...)
+	}
+	return winners
+}
+
+// countAvailable returns the number of participants who have not won any prize.
+func countAvailable(participants []Participant, winners []Participant) int {
+	won := map[string]bool{}
+	for _, w := range winners {
+		won[w.ID] = true
+	}
+
+	n := 0
+	for _, p := range participants {
+		if !won[p.ID] {
+			n++
+		}
+	}
+	return n
+}
+
+// diffState compares the current config and participants with the new ones.
+// Prizes are matched by IDs.
+// It returns the changes, or errors if any change is unsafe:
+// removing or renaming a prize with winners, decreasing the number of a prize below its winners,
+// or removing a participant who has won.
+func diffState(oldConfig Config, oldParticipants []Participant, newConfig Config, newParticipants []Participant, winnerMap map[string][]Participant) ([]string, error) {
+	var (
+		changes []string
+		errs    []error
+	)
+
+	// Prizes.
+	for ID, winners := range winnerMap {
+		if len(winners) == 0 {
+			continue
+		}
+
+		i := lottery.PrizeIndex(newConfig.Prizes, ID)
+		j := lottery.PrizeIndex(oldConfig.Prizes, ID)
+		if j < 0 {
+			// Winners of a prize which is not in the config, e.g. restored from the store.
+			// Only the number is checked if the prize is added.
+			if i >= 0 && newConfig.Prizes[i].Num < len(winners) {
+				errs = append(errs, fmt.Errorf("prize %v has %v winners, num can't be less than it", ID, len(winners)))
+			}
+			continue
+		}
+
+		old := oldConfig.Prizes[j]
+		switch {
+		case i < 0:
+			errs = append(errs, fmt.Errorf("prize %v(%v) has winners, it can't be removed", ID, old.Name))
+		case newConfig.Prizes[i].Name != old.Name:
+			errs = append(errs, fmt.Errorf("prize %v(%v) has winners, it can't be renamed", ID, old.Name))
+		case newConfig.Prizes[i].Num < len(winners):
+			errs = append(errs, fmt.Errorf("prize %v(%v) has %v winners, num can't be less than it", ID, old.Name, len(winners)))
+		case newConfig.Prizes[i].SKU != old.SKU:
+			errs = append(errs, fmt.Errorf("prize %v(%v) has winners, its sku can't be changed", ID, old.Name))
+		}
+	}
+
+	// Inventory.
+	awarded := lottery.AwardedBySKU(oldConfig, winnerMap)
+	for _, item := range newConfig.Inventory {
+		if item.Quantity < awarded[item.SKU] {
+			errs = append(errs, fmt.Errorf("inventory %v has %v awarded, quantity can't be less than it", item.SKU, awarded[item.SKU]))
+		}
+	}
+
+	if (len(oldConfig.Inventory) > 0 || len(newConfig.Inventory) > 0) && !reflect.DeepEqual(oldConfig.Inventory, newConfig.Inventory) {
+		changes = append(changes, "inventory updated")
+	}
+
+	for i, p := range newConfig.Prizes {
+		j := lottery.PrizeIndex(oldConfig.Prizes, p.ID)
+		switch {
+		case j < 0:
+			changes = append(changes, fmt.Sprintf("prize added: %v", p.Name))
+		case !reflect.DeepEqual(p, oldConfig.Prizes[j]):
+			changes = append(changes, fmt.Sprintf("prize updated: %v", p.Name))
+		case i != j:
+			changes = append(changes, fmt.Sprintf("prize moved: %v", p.Name))
+		}
+	}
+
+	for _, p := range oldConfig.Prizes {
+		if lottery.PrizeIndex(newConfig.Prizes, p.ID) < 0 {
+			changes = append(changes, fmt.Sprintf("prize removed: %v", p.Name))
+		}
+	}
+
+	if !reflect.DeepEqual(oldConfig.Theme, newConfig.Theme) {
+		changes = append(changes, "theme updated")
+	}
+
+	// Blacklists.
+	if (len(oldConfig.Blacklists) > 0 || len(newConfig.Blacklists) > 0) && !reflect.DeepEqual(oldConfig.Blacklists, newConfig.Blacklists) {
+		changes = append(changes, "blacklists updated")
+	}
+
+	// Participants.
+	oldMap := map[string]Participant{}
+	for _, p := range oldParticipants {
+		oldMap[p.ID] = p
+	}
+
+	newMap := map[string]Participant{}
+	for _, p := range newParticipants {
+		newMap[p.ID] = p
+	}
+
+	for _, w := range allWinners(winnerMap) {
+		if _, ok := newMap[w.ID]; !ok {
+			errs = append(errs, fmt.Errorf("participant %v has won, it can't be removed", redact(w.ID)))
+		}
+	}
+
+	added, removed, updated := 0, 0, 0
+	for ID, p := range newMap {
+		old, ok := oldMap[ID]
+		if !ok {
+			added++
+			continue
+		}
+		if !reflect.DeepEqual(old, p) {
+			updated++
+		}
+	}
+	for ID := range oldMap {
+		if _, ok := newMap[ID]; !ok {
+			removed++
+		}
+	}
+
+	if added > 0 {
+		changes = append(changes, fmt.Sprintf("participants added: %v", added))
+	}
+	if removed > 0 {
+		changes = append(changes, fmt.Sprintf("participants removed: %v", removed))
+	}
+	if updated > 0 {
+		changes = append(changes, fmt.Sprintf("participants updated: %v", updated))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiffState(t *testing.T) {
+	winners := map[string][]Participant{"3rd": testParticipants(2)}
+
+	tests := []struct {
+		name    string
+		change  func(c *Config, p *[]Participant)
+		winners map[string][]Participant
+		changes []string
+		err     string
+	}{
+		{"no changes", func(c *Config, p *[]Participant) {}, winners, nil, ""},
+		{"prize added", func(c *Config, p *[]Participant) {
+			c.Prizes = append(c.Prizes, Prize{ID: "4th", Tier: 0, Name: "4th", Num: 5})
+		}, winners, []string{"prize added: 4th"}, ""},
+		{"prize updated", func(c *Config, p *[]Participant) { c.Prizes[0].Num = 5 }, winners, []string{"prize updated: 3rd"}, ""},
+		{"participants added", func(c *Config, p *[]Participant) {
+			*p = append(*p, Participant{ID: "11", Name: "P11"})
+		}, winners, []string{"participants added: 1"}, ""},
+		{"prize with winners removed", func(c *Config, p *[]Participant) { c.Prizes = c.Prizes[1:] }, winners, nil, "can't be removed"},
+		{"prize with winners renamed", func(c *Config, p *[]Participant) { c.Prizes[0].Name = "Third" }, winners, nil, "can't be renamed"},
+		{"num less than winners", func(c *Config, p *[]Participant) { c.Prizes[0].Num = 1 }, winners, nil, "num can't be less"},
+		{"winner removed", func(c *Config, p *[]Participant) { *p = (*p)[1:] }, winners, nil, "participant"},
+		{"winners of an unknown prize", func(c *Config, p *[]Participant) {},
+			map[string][]Participant{"gone": testParticipants(1)}, nil, ""},
+		{"unknown prize with winners added", func(c *Config, p *[]Participant) {
+			c.Prizes = append(c.Prizes, Prize{ID: "gone", Name: "Gone", Num: 2})
+		}, map[string][]Participant{"gone": testParticipants(1)}, []string{"prize added: Gone"}, ""},
+		{"unknown prize added with less num", func(c *Config, p *[]Participant) {
+			c.Prizes = append(c.Prizes, Prize{ID: "gone", Name: "Gone", Num: 1})
+		}, map[string][]Participant{"gone": testParticipants(2)}, nil, "num can't be less"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldConfig, oldParticipants := testConfig(), testParticipants(10)
+			newConfig, newParticipants := testConfig(), testParticipants(10)
+			tt.change(&newConfig, &newParticipants)
+
+			changes, err := diffState(oldConfig, oldParticipants, newConfig, newParticipants, tt.winners)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("diffState() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("diffState() error: %v", err)
+			}
+			if strings.Join(changes, ";") != strings.Join(tt.changes, ";") {
+				t.Errorf("diffState() = %q, want %q", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestApplyStateDrawRunning(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	newConfig := testConfig()
+	newConfig.Prizes[0].Content = "mugs"
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd"})
+	c.waitFor(id, "start")
+	if _, err := applyState(newConfig, testParticipants(10), nil); err != errDrawRunning {
+		t.Fatalf("applyState() while a draw is running error = %v, want errDrawRunning", err)
+	}
+
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	c.waitFor(id, "stop")
+	stopTestDraw()
+
+	changes, err := applyState(newConfig, testParticipants(10), nil)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("applyState() = %v, %v, want the prize updated", changes, err)
+	}
+	if res := c.waitFor("", "state_changed"); len(res.Prizes) != 3 || res.Prizes[0].Content != "mugs" {
+		t.Errorf("state_changed = %+v, want the new prizes", res)
+	}
+}
+
+func TestReloadDuringDraws(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	buf, err := formatParticipantsCSV(testParticipants(10), true)
+	if err != nil {
+		t.Fatalf("formatParticipantsCSV() error: %v", err)
+	}
+	if err = os.WriteFile(settings.ParticipantsFile, buf, 0644); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	// Reload changed configs until the draws are done.
+	done := make(chan struct{})
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			newConfig := testConfig()
+			newConfig.Prizes[0].Content = fmt.Sprint(i)
+			if err := writeConfig(settings.ConfigFile, newConfig); err != nil {
+				t.Errorf("writeConfig() error: %v", err)
+				return
+			}
+			if _, err := reload(); err != nil && err != errDrawRunning {
+				t.Errorf("reload() error: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if res := c.do(Action{Name: "get_prizes"}); !res.Success || len(res.Prizes) != 3 {
+			t.Fatalf("get_prizes = %+v, want 3 prizes", res)
+		}
+
+		id := c.send(Action{Name: "start", PrizeID: "3rd"})
+		if res := c.waitFor(id, "start"); !res.Success {
+			t.Fatalf("start error: %v", res.ErrMsg)
+		}
+		c.send(Action{Name: "abort", PrizeID: "3rd"})
+		c.waitFor(id, "abort")
+	}
+
+	close(done)
+	<-reloaded
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	a, b := dialTestClient(t, srv), dialTestClient(t, srv)
+
+	newConfig := testConfig()
+	newConfig.Prizes[0].Content = "mugs"
+	buf, err := formatParticipantsCSV(testParticipants(11), false)
+	if err != nil {
+		t.Fatalf("formatParticipantsCSV() error: %v", err)
+	}
+
+	// Neither update is lost.
+	idA := a.send(Action{Name: "update_config", Config: &newConfig})
+	idB := b.send(Action{Name: "update_participants", ParticipantsCSV: string(buf)})
+	if res := a.waitFor(idA, "update_config"); !res.Success {
+		t.Fatalf("update_config error: %v", res.ErrMsg)
+	}
+	if res := b.waitFor(idB, "update_participants"); !res.Success {
+		t.Fatalf("update_participants error: %v", res.ErrMsg)
+	}
+
+	if c := currentConfig(); c.Prizes[0].Content != "mugs" {
+		t.Errorf("content of prize 3rd = %q, want mugs", c.Prizes[0].Content)
+	}
+	if p := currentParticipants(); len(p) != 11 {
+		t.Errorf("participants = %v, want 11", len(p))
+	}
+}
+
+func TestLoadParticipants(t *testing.T) {
+	// Rows with and without emails.
+	p, err := loadParticipants(writeTestFile(t, "participants.csv", "1,Frank,frank@example.com\n2,Bob\n"))
+	if err != nil {
+		t.Fatalf("loadParticipants() error: %v", err)
+	}
+	if len(p) != 2 || p[0].Email != "frank@example.com" || p[1].ID != "2" || p[1].Name != "Bob" || p[1].Email != "" {
+		t.Errorf("loadParticipants() = %+v, want Frank with email and Bob without", p)
+	}
+
+	if _, err = loadParticipants(writeTestFile(t, "participants.csv", "1,\"Frank\n")); err == nil {
+		t.Errorf("loadParticipants() of an invalid CSV, want error")
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Status of scheduled draws.
+const (
+	schedulePending = "pending"
+	scheduleRunning = "running"
+	scheduleDone    = "done"
+	scheduleFailed  = "failed"
+	// The server was not running at the time of the draw.
+	scheduleMissed = "missed"
+)
+
+// Default countdown before a scheduled draw starts.
+const defaultScheduleCountdown = "10s"
+
+// Interval to check scheduled draws.
+const scheduleInterval = time.Second
+
+// ScheduledDraw starts the draw of the prize at the time and stops it after the duration without an operator.
+type ScheduledDraw struct {
+	ID      string    `json:"id"`
+	PrizeID string    `json:"prize_id"`
+	At      time.Time `json:"at"`
+	// Duration of the draw, e.g. "30s".
+	Duration string `json:"duration"`
+	// Countdown is broadcast to clients and displays before the draw starts, e.g. "10s". "0" disables it.
+	Countdown string `json:"countdown"`
+	Status    string `json:"status"`
+	ErrMsg    string `json:"err_msg,omitempty"`
+	// Request ID of the start action of the draw.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type CountdownResponse struct {
+	CommonResponse
+	ScheduleID string    `json:"schedule_id"`
+	At         time.Time `json:"at"`
+	Seconds    int       `json:"seconds"`
+}
+
+type ScheduleResponse struct {
+	Success  bool            `json:"success"`
+	ErrMsg   string          `json:"err_msg"`
+	Schedule []ScheduledDraw `json:"schedule"`
+}
+
+var (
+	scheduleMu sync.Mutex
+	schedule   = []ScheduledDraw{}
+)
+
+// validateScheduledDraw validates the scheduled draw before it's added or updated.
+func validateScheduledDraw(d ScheduledDraw, prizes []Prize, now time.Time) error {
+	if lottery.PrizeIndex(prizes, d.PrizeID) < 0 {
+		return fmt.Errorf("unknown prize_id: %v", d.PrizeID)
+	}
+	if !d.At.After(now) {
+		return fmt.Errorf("at: %v is not in the future", d.At.Format(time.RFC3339))
+	}
+	if dur, err := time.ParseDuration(d.Duration); err != nil || dur <= 0 {
+		return fmt.Errorf("duration: invalid duration %v", d.Duration)
+	}
+	if dur, err := time.ParseDuration(d.Countdown); err != nil || dur < 0 {
+		return fmt.Errorf("countdown: invalid duration %v", d.Countdown)
+	}
+	return nil
+}
+
+// loadSchedule loads the schedule file. It's OK if the file does not exist.
+// Pending draws in the past are marked as missed and running draws as failed(interrupted by the restart).
+func loadSchedule(file string) error {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var l []ScheduledDraw
+	if err = json.Unmarshal(buf, &l); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	changed := false
+	for i := range l {
+		d := &l[i]
+		switch {
+		case d.Status == schedulePending && !d.At.After(now):
+			d.Status = scheduleMissed
+			changed = true
+		case d.Status == scheduleRunning:
+			d.Status, d.ErrMsg = scheduleFailed, "interrupted"
+			changed = true
+		}
+	}
+
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	schedule = l
+	if changed {
+		return saveSchedule(file)
+	}
+	return nil
+}
+
+// saveSchedule writes the schedule to the file. The caller should hold scheduleMu.
+func saveSchedule(file string) error {
+	buf, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename it to avoid a partial file.
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(buf, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// startScheduler checks scheduled draws every second.
+func startScheduler() {
+	go func() {
+		for range time.Tick(scheduleInterval) {
+			if shuttingDown() {
+				return
+			}
+			runSchedule(time.Now())
+		}
+	}()
+}
+
+// runSchedule broadcasts countdowns, starts and stops scheduled draws which are due at now.
+func runSchedule(now time.Time) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	changed := false
+	for i := range schedule {
+		d := &schedule[i]
+		switch d.Status {
+		case schedulePending:
+			if !d.At.After(now) {
+				startScheduledDraw(d)
+				changed = true
+				continue
+			}
+
+			countdown, _ := time.ParseDuration(d.Countdown)
+			if left := d.At.Sub(now); left <= countdown {
+				broadcastCountdown(*d, int(math.Ceil(left.Seconds())))
+			}
+
+		case scheduleRunning:
+			duration, _ := time.ParseDuration(d.Duration)
+			if now.Before(d.At.Add(duration)) {
+				continue
+			}
+			stopScheduledDraw(d)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := saveSchedule(settings.ScheduleFile); err != nil {
+			slog.Error("saveSchedule() error", "err", err)
+		}
+	}
+}
+
+// broadcastCountdown sends the countdown of the scheduled draw to all clients and displays.
+func broadcastCountdown(d ScheduledDraw, seconds int) {
+	a := Action{Name: "countdown", PrizeID: d.PrizeID}
+	resolvePrize(&a, currentConfig().Prizes)
+
+	res := CountdownResponse{CommonResponse{Success: true, ErrMsg: "", Action: a}, d.ID, d.At, seconds}
+	hub.broadcast(res)
+	eventFeed.publish(a.Name, res)
+	setDisplayCountdown(d.PrizeID, seconds)
+}
+
+// startScheduledDraw starts the scheduled draw. The caller should hold scheduleMu.
+func startScheduledDraw(d *ScheduledDraw) {
+	a := Action{Name: "start", PrizeID: d.PrizeID, RequestID: newID()}
+	resolvePrize(&a, currentConfig().Prizes)
+
+	slog.Info("start scheduled draw", "schedule_id", d.ID, "prize_id", d.PrizeID, "request_id", a.RequestID)
+	errMsg := startDraw(nil, a)
+	recordAudit(nil, a, errMsg)
+
+	d.RequestID = a.RequestID
+	if errMsg != "" {
+		d.Status, d.ErrMsg = scheduleFailed, errMsg
+		setDisplay(displayIdle, d.PrizeID, lot.Winners(d.PrizeID))
+		return
+	}
+	d.Status = scheduleRunning
+}
+
+// stopScheduledDraw stops the scheduled draw if it's still running. The caller should hold scheduleMu.
+// The draw may be stopped by an operator before, it's done in that case too.
+func stopScheduledDraw(d *ScheduledDraw) {
+	d.Status = scheduleDone
+
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	if cancel == nil || runningRequestID != d.RequestID {
+		slog.Info("scheduled draw already stopped", "schedule_id", d.ID, "prize_id", d.PrizeID)
+		return
+	}
+
+	a := Action{Name: "stop", PrizeID: d.PrizeID, RequestID: newID()}
+	resolvePrize(&a, currentConfig().Prizes)
+
+	slog.Info("stop scheduled draw", "schedule_id", d.ID, "prize_id", d.PrizeID, "request_id", a.RequestID)
+	errMsg := stopDrawLocked(nil, a)
+	recordAudit(nil, a, errMsg)
+	if errMsg != "" {
+		d.Status, d.ErrMsg = scheduleFailed, errMsg
+	}
+}
+
+// putScheduledDraw adds the scheduled draw or updates the pending one with the same ID.
+func putScheduledDraw(d ScheduledDraw) (ScheduledDraw, error) {
+	if d.Countdown == "" {
+		d.Countdown = defaultScheduleCountdown
+	}
+	if err := validateScheduledDraw(d, currentConfig().Prizes, time.Now()); err != nil {
+		return d, err
+	}
+
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	old := append([]ScheduledDraw{}, schedule...)
+
+	d.Status, d.ErrMsg, d.RequestID = schedulePending, "", ""
+	if d.ID == "" {
+		d.ID = newID()
+		schedule = append(schedule, d)
+	} else {
+		i := scheduledDrawIndex(d.ID)
+		if i < 0 {
+			return d, fmt.Errorf("unknown id: %v", d.ID)
+		}
+		if schedule[i].Status != schedulePending {
+			return d, fmt.Errorf("scheduled draw is %v", schedule[i].Status)
+		}
+		schedule[i] = d
+	}
+	sort.SliceStable(schedule, func(i, j int) bool { return schedule[i].At.Before(schedule[j].At) })
+
+	if err := saveSchedule(settings.ScheduleFile); err != nil {
+		schedule = old
+		return d, fmt.Errorf("saveSchedule() error: %v", err)
+	}
+	return d, nil
+}
+
+// deleteScheduledDraw deletes the scheduled draw unless it's running.
+func deleteScheduledDraw(ID string) error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	i := scheduledDrawIndex(ID)
+	if i < 0 {
+		return fmt.Errorf("unknown id: %v", ID)
+	}
+	if schedule[i].Status == scheduleRunning {
+		return fmt.Errorf("scheduled draw is running")
+	}
+
+	old := append([]ScheduledDraw{}, schedule...)
+	schedule = append(schedule[:i:i], schedule[i+1:]...)
+
+	if err := saveSchedule(settings.ScheduleFile); err != nil {
+		schedule = old
+		return fmt.Errorf("saveSchedule() error: %v", err)
+	}
+	return nil
+}
+
+// scheduledDrawIndex returns the index of the scheduled draw by ID, or -1. The caller should hold scheduleMu.
+func scheduledDrawIndex(ID string) int {
+	for i, d := range schedule {
+		if d.ID == ID {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeScheduleResponse writes the response with the schedule, or the error without the schedule,
+// so that no scheduled draw is leaked to requests without the admin token.
+func writeScheduleResponse(w http.ResponseWriter, status int, errMsg string) {
+	res := ScheduleResponse{Success: errMsg == "", ErrMsg: errMsg}
+	if res.Success {
+		scheduleMu.Lock()
+		res.Schedule = append([]ScheduledDraw{}, schedule...)
+		scheduleMu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// serveSchedule handles the schedule API. All methods respond with the schedule if they succeed.
+//
+//	GET    /api/schedule         list scheduled draws
+//	POST   /api/schedule         add a scheduled draw, or update a pending one if id is set
+//	DELETE /api/schedule?id=<id> delete a scheduled draw
+func serveSchedule(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, errMsg string) {
+		slog.Warn("schedule error", "remote_addr", r.RemoteAddr, "method", r.Method, "err", errMsg)
+		writeScheduleResponse(w, status, errMsg)
+	}
+
+	if !checkAdminRequest(r) {
+		fail(http.StatusUnauthorized, "invalid admin token")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeScheduleResponse(w, http.StatusOK, "")
+
+	case "POST":
+		var d ScheduledDraw
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&d); err != nil {
+			fail(http.StatusBadRequest, fmt.Sprintf("decode error: %v", err))
+			return
+		}
+
+		d, err := putScheduledDraw(d)
+		if err != nil {
+			fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Info("scheduled draw saved", "remote_addr", r.RemoteAddr, "schedule_id", d.ID, "prize_id", d.PrizeID, "at", d.At)
+		writeScheduleResponse(w, http.StatusOK, "")
+
+	case "DELETE":
+		ID := r.URL.Query().Get("id")
+		if err := deleteScheduledDraw(ID); err != nil {
+			fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Info("scheduled draw deleted", "remote_addr", r.RemoteAddr, "schedule_id", ID)
+		writeScheduleResponse(w, http.StatusOK, "")
+
+	default:
+		fail(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scheduleRequest sends the request to the schedule API and decodes the response.
+func scheduleRequest(t *testing.T, srv *httptest.Server, method, query, body string) (int, ScheduleResponse) {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, srv.URL+"/api/schedule"+query, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%v /api/schedule error: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var res ScheduleResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("Decode() error: %v", err)
+	}
+	return resp.StatusCode, res
+}
+
+func TestValidateScheduledDraw(t *testing.T) {
+	now := time.Now()
+	prizes := testConfig().Prizes
+
+	tests := []struct {
+		name string
+		d    ScheduledDraw
+		err  string
+	}{
+		{"ok", ScheduledDraw{PrizeID: "3rd", At: now.Add(time.Hour), Duration: "30s", Countdown: "10s"}, ""},
+		{"no countdown", ScheduledDraw{PrizeID: "3rd", At: now.Add(time.Hour), Duration: "30s", Countdown: "0"}, ""},
+		{"unknown prize", ScheduledDraw{PrizeID: "4th", At: now.Add(time.Hour), Duration: "30s", Countdown: "10s"}, "unknown prize_id"},
+		{"past", ScheduledDraw{PrizeID: "3rd", At: now, Duration: "30s", Countdown: "10s"}, "not in the future"},
+		{"zero duration", ScheduledDraw{PrizeID: "3rd", At: now.Add(time.Hour), Duration: "0s", Countdown: "10s"}, "duration"},
+		{"invalid countdown", ScheduledDraw{PrizeID: "3rd", At: now.Add(time.Hour), Duration: "30s", Countdown: "soon"}, "countdown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateScheduledDraw(tt.d, prizes, now)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("validateScheduledDraw() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("validateScheduledDraw() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRunSchedule(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+	display := dialTestPath(t, srv, "/display/ws")
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	d, err := putScheduledDraw(ScheduledDraw{PrizeID: "3rd", At: at, Duration: "30s"})
+	if err != nil {
+		t.Fatalf("putScheduledDraw() error: %v", err)
+	}
+	if d.ID == "" || d.Status != schedulePending || d.Countdown != defaultScheduleCountdown {
+		t.Fatalf("putScheduledDraw() = %+v, want a pending draw with the default countdown", d)
+	}
+
+	// No countdown before the countdown starts.
+	runSchedule(at.Add(-time.Minute))
+	runSchedule(at.Add(-5 * time.Second))
+	res := c.waitFor("", "countdown")
+	if res.PrizeID != "3rd" || res.Seconds != 5 {
+		t.Fatalf("countdown = %+v, want 5 seconds of 3rd", res)
+	}
+	// The display shows the countdown after the initial state.
+	for {
+		if res := display.waitFor("", "display"); res.Display.Status == displayCountdown {
+			break
+		}
+	}
+
+	runSchedule(at)
+	if schedule[0].Status != scheduleRunning || schedule[0].RequestID == "" {
+		t.Fatalf("schedule = %+v, want the draw running", schedule[0])
+	}
+	if res = c.waitFor(schedule[0].RequestID, "start"); !res.Success {
+		t.Fatalf("start = %+v", res)
+	}
+
+	// The draw is running until the duration passes.
+	runSchedule(at.Add(29 * time.Second))
+	if schedule[0].Status != scheduleRunning {
+		t.Fatalf("schedule = %+v, want the draw running", schedule[0])
+	}
+
+	runSchedule(at.Add(30 * time.Second))
+	if res = c.waitFor(schedule[0].RequestID, "stop"); !res.Success || len(res.Winners) != 3 {
+		t.Fatalf("stop = %+v, want 3 winners", res)
+	}
+	stopTestDraw()
+	if schedule[0].Status != scheduleDone {
+		t.Errorf("schedule = %+v, want the draw done", schedule[0])
+	}
+	if len(lot.Winners("3rd")) != 3 {
+		t.Errorf("winners = %v, want 3", testIDs(lot.Winners("3rd")))
+	}
+
+	// The schedule is saved when the status changes.
+	buf, err := os.ReadFile(settings.ScheduleFile)
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	var saved []ScheduledDraw
+	if err = json.Unmarshal(buf, &saved); err != nil || len(saved) != 1 || saved[0].Status != scheduleDone {
+		t.Errorf("saved schedule = %s, %v, want the draw done", buf, err)
+	}
+}
+
+func TestRunScheduleStoppedByOperator(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	at := time.Now().Add(time.Hour)
+	if _, err := putScheduledDraw(ScheduledDraw{PrizeID: "3rd", At: at, Duration: "30s", Countdown: "0"}); err != nil {
+		t.Fatalf("putScheduledDraw() error: %v", err)
+	}
+
+	runSchedule(at)
+	id := schedule[0].RequestID
+	c.waitFor(id, "start")
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	c.waitFor(id, "stop")
+	stopTestDraw()
+
+	// Another draw started by the operator is not stopped by the schedule.
+	other := c.send(Action{Name: "start", PrizeID: "2nd"})
+	c.waitFor(other, "start")
+
+	runSchedule(at.Add(time.Minute))
+	if schedule[0].Status != scheduleDone {
+		t.Errorf("schedule = %+v, want the draw done", schedule[0])
+	}
+	controlMu.Lock()
+	running := runningRequestID
+	controlMu.Unlock()
+	if running != other {
+		t.Errorf("running draw = %v, want %v", running, other)
+	}
+}
+
+func TestRunScheduleFailed(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	dialTestClient(t, srv)
+
+	at := time.Now().Add(time.Hour)
+	if _, err := putScheduledDraw(ScheduledDraw{PrizeID: "3rd", At: at, Duration: "30s", Countdown: "0"}); err != nil {
+		t.Fatalf("putScheduledDraw() error: %v", err)
+	}
+	// The prize is drawn before the scheduled draw.
+	lot.Restore(map[string][]Participant{"3rd": testParticipants(3)})
+
+	runSchedule(at)
+	if schedule[0].Status != scheduleFailed || schedule[0].ErrMsg == "" {
+		t.Errorf("schedule = %+v, want the draw failed", schedule[0])
+	}
+}
+
+func TestLoadSchedule(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+
+	now := time.Now()
+	l := []ScheduledDraw{
+		{ID: "past", PrizeID: "3rd", At: now.Add(-time.Hour), Duration: "30s", Status: schedulePending},
+		{ID: "running", PrizeID: "2nd", At: now.Add(-time.Minute), Duration: "30s", Status: scheduleRunning},
+		{ID: "future", PrizeID: "1st", At: now.Add(time.Hour), Duration: "30s", Status: schedulePending},
+	}
+	buf, _ := json.Marshal(l)
+	if err := os.WriteFile(settings.ScheduleFile, buf, 0644); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	if err := loadSchedule(settings.ScheduleFile); err != nil {
+		t.Fatalf("loadSchedule() error: %v", err)
+	}
+	want := map[string]string{"past": scheduleMissed, "running": scheduleFailed, "future": schedulePending}
+	for _, d := range schedule {
+		if d.Status != want[d.ID] {
+			t.Errorf("status of %v = %v, want %v", d.ID, d.Status, want[d.ID])
+		}
+	}
+
+	// Changes are saved.
+	buf, _ = os.ReadFile(settings.ScheduleFile)
+	if !strings.Contains(string(buf), `"interrupted"`) || !strings.Contains(string(buf), scheduleMissed) {
+		t.Errorf("saved schedule = %s, want statuses updated", buf)
+	}
+
+	// A missing file is not an error.
+	if err := loadSchedule(settings.ScheduleFile + ".missing"); err != nil {
+		t.Errorf("loadSchedule() of a missing file error: %v", err)
+	}
+}
+
+func TestScheduleAPI(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+	settings.AdminToken = "secret"
+	srv := httptest.NewServer(http.HandlerFunc(serveSchedule))
+	defer srv.Close()
+
+	later := time.Now().Add(2 * time.Hour).Format(time.RFC3339)
+	sooner := time.Now().Add(time.Hour).Format(time.RFC3339)
+	status, res := scheduleRequest(t, srv, "POST", "", `{"prize_id":"2nd","at":"`+later+`","duration":"30s"}`)
+	if status != http.StatusOK || len(res.Schedule) != 1 {
+		t.Fatalf("POST = %v %+v", status, res)
+	}
+	status, res = scheduleRequest(t, srv, "POST", "", `{"prize_id":"3rd","at":"`+sooner+`","duration":"30s"}`)
+	if status != http.StatusOK || len(res.Schedule) != 2 || res.Schedule[0].PrizeID != "3rd" {
+		t.Fatalf("POST = %v %+v, want the schedule sorted by time", status, res)
+	}
+
+	// Update the pending draw by ID.
+	ID := res.Schedule[0].ID
+	status, res = scheduleRequest(t, srv, "POST", "", `{"id":"`+ID+`","prize_id":"1st","at":"`+sooner+`","duration":"1m"}`)
+	if status != http.StatusOK || len(res.Schedule) != 2 || res.Schedule[0].PrizeID != "1st" || res.Schedule[0].Duration != "1m" {
+		t.Fatalf("POST with id = %v %+v", status, res)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		body   string
+		status int
+	}{
+		{"unknown prize", "POST", "", `{"prize_id":"4th","at":"` + later + `","duration":"30s"}`, http.StatusBadRequest},
+		{"unknown id", "POST", "", `{"id":"x","prize_id":"3rd","at":"` + later + `","duration":"30s"}`, http.StatusBadRequest},
+		{"invalid JSON", "POST", "", `{`, http.StatusBadRequest},
+		{"delete unknown id", "DELETE", "?id=x", "", http.StatusBadRequest},
+		{"method not allowed", "PUT", "", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if status, res := scheduleRequest(t, srv, tt.method, tt.query, tt.body); status != tt.status || res.Success || res.Schedule != nil {
+			t.Errorf("%v = %v %+v, want %v without the schedule", tt.name, status, res, tt.status)
+		}
+	}
+
+	// Requests without the admin token get no schedule.
+	for _, token := range []string{"", "wrong"} {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/schedule", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/schedule error: %v", err)
+		}
+		buf, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || strings.Contains(string(buf), ID) || strings.Contains(string(buf), "prize_id") {
+			t.Errorf("GET with token %q = %v %s, want 401 without the schedule", token, resp.StatusCode, buf)
+		}
+	}
+
+	// Running draws can't be deleted.
+	scheduleMu.Lock()
+	schedule[0].Status = scheduleRunning
+	scheduleMu.Unlock()
+	if status, _ := scheduleRequest(t, srv, "DELETE", "?id="+ID, ""); status != http.StatusBadRequest {
+		t.Errorf("DELETE running draw = %v, want 400", status)
+	}
+	if status, _ := scheduleRequest(t, srv, "POST", "", `{"id":"`+ID+`","prize_id":"1st","at":"`+sooner+`","duration":"30s"}`); status != http.StatusBadRequest {
+		t.Errorf("POST running draw = %v, want 400", status)
+	}
+
+	status, res = scheduleRequest(t, srv, "DELETE", "?id="+res.Schedule[1].ID, "")
+	if status != http.StatusOK || len(res.Schedule) != 1 || res.Schedule[0].ID != ID {
+		t.Errorf("DELETE = %v %+v", status, res)
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/northbright/lottery-server/lottery"
+	"github.com/northbright/lottery-server/store"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Default server settings file. It's optional.
+	defaultSettingsFile = "server_settings.json"
+
+	// Prefix of environment variables of settings, e.g. LOTTERY_ADDR.
+	envPrefix = "LOTTERY_"
+)
+
+// ServerSettings contains all settings of the server.
+// Settings are loaded in order(the latter overrides the former):
+// defaults, settings file(JSON, YAML or TOML), environment variables and flags.
+type ServerSettings struct {
+	Addr  string `json:"addr"`
+	WSURL string `json:"ws_url"`
+	// Address of the gRPC API, e.g. ":9000". It's disabled if it's empty.
+	GRPCAddr string `json:"grpc_addr"`
+
+	// Relative paths in the settings file are relative to the dir of the settings file.
+	// Relative paths in environment variables and flags are relative to the current dir.
+	StaticDir        string `json:"static_dir"`
+	ConfigFile       string `json:"config_file"`
+	ParticipantsFile string `json:"participants_file"`
+	ResultsDir       string `json:"results_dir"`
+	// Dir to store media(images and videos of prizes) uploaded by /api/media, served at /media/.
+	MediaDir string `json:"media_dir"`
+	// File to store claimed and shipped states of prizes.
+	FulfillmentFile string `json:"fulfillment_file"`
+	// File to store scheduled draws.
+	ScheduleFile string `json:"schedule_file"`
+
+	// Store of config, participants, committed draws and audit events: "memory", "json", "sqlite" or "postgres".
+	// StoreDSN is the path of the file for json and sqlite, or the connection string for postgres.
+	// Event scopes the state in SQL stores, so that one database serves multiple events.
+	Store    string `json:"store"`
+	StoreDSN string `json:"store_dsn"`
+	Event    string `json:"event"`
+
+	// Interval to check if config and participants files are modified and reload them, 0 to disable.
+	// They're also reloaded when SIGHUP is received.
+	ReloadInterval string `json:"reload_interval"`
+
+	// Time allowed to shut down gracefully after SIGINT or SIGTERM is received.
+	ShutdownTimeout string `json:"shutdown_timeout"`
+	// What to do with the running draw on shutdown: "commit" or "abort".
+	ShutdownDrawPolicy string `json:"shutdown_draw_policy"`
+
+	// If both cert and key files are set, the server serves HTTPS and WSS.
+	// If tls_self_signed is true and the files do not exist,
+	// a self-signed certificate for the local host names, IPs and tls_hosts is generated to the files.
+	TLSCertFile   string   `json:"tls_cert_file"`
+	TLSKeyFile    string   `json:"tls_key_file"`
+	TLSSelfSigned bool     `json:"tls_self_signed"`
+	TLSHosts      []string `json:"tls_hosts"`
+
+	// Origins allowed to connect to /ws, e.g. "https://lottery.example.com".
+	// Only the same origin is allowed if it's empty. "*" allows any origin.
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	// Token required by admin actions(used by the admin console at /admin/). No token is required if it's empty.
+	AdminToken string `json:"admin_token"`
+
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+	LogRedact string `json:"log_redact"`
+	// Secret key of the hash redaction policy. Keep it the same to correlate logs across restarts.
+	LogRedactKey string `json:"log_redact_key"`
+
+	Notifiers NotifierSettings `json:"notifiers"`
+}
+
+// settingVar is a setting which can be set by the settings file, environment variable and flag.
+// p is *string, *bool or *[]string(comma separated in environment variables and flags).
+type settingVar struct {
+	key    string // Key in the settings file.
+	usage  string
+	isPath bool
+	p      interface{}
+}
+
+// get returns the value as string.
+func (v settingVar) get() string {
+	switch p := v.p.(type) {
+	case *string:
+		return *p
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *[]string:
+		return strings.Join(*p, ",")
+	}
+	return ""
+}
+
+// set sets the value from string.
+func (v settingVar) set(value string) error {
+	switch p := v.p.(type) {
+	case *string:
+		*p = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%v: invalid bool %v", v.key, value)
+		}
+		*p = b
+	case *[]string:
+		*p = nil
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				*p = append(*p, s)
+			}
+		}
+	}
+	return nil
+}
+
+// path returns the pointer of the path setting.
+func (v settingVar) path() *string {
+	return v.p.(*string)
+}
+
+// flagName returns the flag name of the setting, e.g. "ws-url" for "ws_url".
+func (v settingVar) flagName() string {
+	return strings.Replace(v.key, "_", "-", -1)
+}
+
+// envName returns the environment variable name of the setting, e.g. "LOTTERY_WS_URL" for "ws_url".
+func (v settingVar) envName() string {
+	return envPrefix + strings.ToUpper(v.key)
+}
+
+func defaultServerSettings() ServerSettings {
+	return ServerSettings{
+		Addr:               ":8080",
+		StaticDir:          "dist/spa",
+		ConfigFile:         "config.json",
+		ParticipantsFile:   "participants.csv",
+		ResultsDir:         ".",
+		MediaDir:           "media",
+		FulfillmentFile:    "fulfillment.json",
+		ScheduleFile:       "schedule.json",
+		Store:              store.DriverMemory,
+		Event:              "default",
+		ReloadInterval:     "2s",
+		ShutdownTimeout:    "10s",
+		ShutdownDrawPolicy: shutdownAbort,
+		LogLevel:           "info",
+		LogFormat:          "text",
+		LogRedact:          redactMask,
+	}
+}
+
+func (s *ServerSettings) vars() []settingVar {
+	return []settingVar{
+		{"addr", "http service address", false, &s.Addr},
+		{"ws_url", "websocket URL returned by /get-ws-url/", false, &s.WSURL},
+		{"grpc_addr", "gRPC service address, disabled if it's empty", false, &s.GRPCAddr},
+		{"static_dir", "dir of static files which override the embedded front-end, ignored if it does not exist", true, &s.StaticDir},
+		{"config_file", "config file of prizes and blacklists", true, &s.ConfigFile},
+		{"participants_file", "participants CSV file", true, &s.ParticipantsFile},
+		{"results_dir", "dir to write winners files", true, &s.ResultsDir},
+		{"media_dir", "dir to store uploaded media of prizes, served at /media/", true, &s.MediaDir},
+		{"fulfillment_file", "file to store claimed and shipped states of prizes", true, &s.FulfillmentFile},
+		{"schedule_file", "file to store scheduled draws", true, &s.ScheduleFile},
+		{"store", "store of config, participants, draws and audit events: memory, json, sqlite or postgres", false, &s.Store},
+		{"store_dsn", "file of json and sqlite stores, or connection string of postgres store", false, &s.StoreDSN},
+		{"event", "name of the event which scopes the state in sqlite and postgres stores", false, &s.Event},
+		{"reload_interval", "interval to check and reload modified config and participants files, 0 to disable", false, &s.ReloadInterval},
+		{"shutdown_timeout", "time allowed to shut down gracefully", false, &s.ShutdownTimeout},
+		{"shutdown_draw_policy", "what to do with the running draw on shutdown: commit or abort", false, &s.ShutdownDrawPolicy},
+		{"tls_cert_file", "TLS certificate file", true, &s.TLSCertFile},
+		{"tls_key_file", "TLS key file", true, &s.TLSKeyFile},
+		{"tls_self_signed", "generate a self-signed certificate to the TLS cert and key files if they do not exist", false, &s.TLSSelfSigned},
+		{"tls_hosts", "extra host names and IPs of the self-signed certificate, comma separated", false, &s.TLSHosts},
+		{"allowed_origins", "origins allowed to connect to /ws, comma separated. same origin only if empty, * for any", false, &s.AllowedOrigins},
+		{"admin_token", "token required by admin actions, no token is required if it's empty", false, &s.AdminToken},
+		{"log_level", "log level: debug, info, warn or error", false, &s.LogLevel},
+		{"log_format", "log format: text or json", false, &s.LogFormat},
+		{"log_redact", "redaction of participant names and IDs in logs: none, mask or hash", false, &s.LogRedact},
+		{"log_redact_key", "secret key of the hash redaction policy, required by hash", false, &s.LogRedactKey},
+	}
+}
+
+// settingsFlags holds the flags of settings.
+type settingsFlags struct {
+	fs           *flag.FlagSet
+	settingsFile *string
+	values       map[string]*string
+}
+
+// newSettingsFlags defines flags of all settings in the flag set.
+func newSettingsFlags(fs *flag.FlagSet) *settingsFlags {
+	f := &settingsFlags{
+		fs:           fs,
+		settingsFile: fs.String("settings", "", fmt.Sprintf("server settings file(.json, .yaml, .yml or .toml). env: %vSETTINGS, default: %v if it exists", envPrefix, defaultSettingsFile)),
+		values:       map[string]*string{},
+	}
+
+	defaults := defaultServerSettings()
+	for _, v := range defaults.vars() {
+		f.values[v.key] = fs.String(v.flagName(), v.get(), fmt.Sprintf("%v. env: %v", v.usage, v.envName()))
+	}
+	return f
+}
+
+// loadServerSettings loads settings in order: defaults, settings file, environment variables and flags.
+// The flag set should be parsed before it's called.
+func loadServerSettings(f *settingsFlags) (ServerSettings, error) {
+	s := defaultServerSettings()
+
+	// Find settings file.
+	file := *f.settingsFile
+	if file == "" {
+		file = os.Getenv(envPrefix + "SETTINGS")
+	}
+	if file == "" {
+		if _, err := os.Stat(defaultSettingsFile); err == nil {
+			file = defaultSettingsFile
+		}
+	}
+
+	if file != "" {
+		if err := loadSettingsFile(file, &s); err != nil {
+			return s, fmt.Errorf("load settings file %v error: %v", file, err)
+		}
+	}
+
+	vars := s.vars()
+
+	// Environment variables.
+	for _, v := range vars {
+		if value, ok := os.LookupEnv(v.envName()); ok {
+			if err := v.set(value); err != nil {
+				return s, fmt.Errorf("env %v: %v", v.envName(), err)
+			}
+		}
+	}
+
+	// Flags which are set explicitly.
+	set := map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+
+	for _, v := range vars {
+		if set[v.flagName()] {
+			if err := v.set(*f.values[v.key]); err != nil {
+				return s, fmt.Errorf("flag -%v: %v", v.flagName(), err)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// loadSettingsFile loads the settings file into s.
+// YAML and TOML files are converted to JSON, so JSON tags of ServerSettings are used for all formats.
+func loadSettingsFile(file string, s *ServerSettings) error {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+	case ".yaml", ".yml":
+		m := map[string]interface{}{}
+		if err = yaml.Unmarshal(buf, &m); err != nil {
+			return err
+		}
+		if buf, err = json.Marshal(m); err != nil {
+			return err
+		}
+	case ".toml":
+		m := map[string]interface{}{}
+		if err = toml.Unmarshal(buf, &m); err != nil {
+			return err
+		}
+		if buf, err = json.Marshal(m); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown settings file format: %v", filepath.Ext(file))
+	}
+
+	// Keep paths which are not set in the file to resolve relative paths in the file only.
+	fileSettings := *s
+	for _, v := range fileSettings.vars() {
+		if v.isPath {
+			*v.path() = ""
+		}
+	}
+	fileSettings.StoreDSN = ""
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&fileSettings); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(file)
+	vars := s.vars()
+	for i, v := range fileSettings.vars() {
+		if !v.isPath {
+			continue
+		}
+		p := v.path()
+		if *p == "" {
+			// Not set in the file, restore the default.
+			*p = *vars[i].path()
+			continue
+		}
+		if !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+
+	// store_dsn is a path for json and sqlite stores.
+	switch {
+	case fileSettings.StoreDSN == "":
+		fileSettings.StoreDSN = s.StoreDSN
+	case isFileDSN(fileSettings.Store, fileSettings.StoreDSN) && !filepath.IsAbs(fileSettings.StoreDSN):
+		fileSettings.StoreDSN = filepath.Join(dir, fileSettings.StoreDSN)
+	}
+
+	*s = fileSettings
+	return nil
+}
+
+// isFileDSN returns true if the DSN of the store is a file path.
+// SQLite URIs("file:lottery.db?mode=ro") and ":memory:" are not resolved as paths.
+func isFileDSN(driver, dsn string) bool {
+	switch driver {
+	case store.DriverJSON:
+		return true
+	case store.DriverSQLite:
+		return !strings.HasPrefix(dsn, "file:") && !strings.HasPrefix(dsn, ":memory:")
+	}
+	return false
+}
+
+// validateServerSettings validates the settings and returns all errors.
+func validateServerSettings(s ServerSettings) error {
+	var errs []error
+
+	if s.Addr == "" {
+		errs = append(errs, fmt.Errorf("addr: empty"))
+	}
+	if s.ConfigFile == "" {
+		errs = append(errs, fmt.Errorf("config_file: empty"))
+	}
+	if s.ParticipantsFile == "" {
+		errs = append(errs, fmt.Errorf("participants_file: empty"))
+	}
+	if fi, err := os.Stat(s.ResultsDir); err != nil || !fi.IsDir() {
+		errs = append(errs, fmt.Errorf("results_dir: %v is not a dir", s.ResultsDir))
+	}
+	if s.MediaDir == "" {
+		errs = append(errs, fmt.Errorf("media_dir: empty"))
+	}
+	if s.FulfillmentFile == "" {
+		errs = append(errs, fmt.Errorf("fulfillment_file: empty"))
+	}
+	if s.ScheduleFile == "" {
+		errs = append(errs, fmt.Errorf("schedule_file: empty"))
+	}
+	switch s.Store {
+	case store.DriverMemory:
+	case store.DriverJSON, store.DriverSQLite, store.DriverPostgres:
+		if s.StoreDSN == "" {
+			errs = append(errs, fmt.Errorf("store_dsn: empty"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("store: should be %v, %v, %v or %v", store.DriverMemory, store.DriverJSON, store.DriverSQLite, store.DriverPostgres))
+	}
+	if s.Event == "" {
+		errs = append(errs, fmt.Errorf("event: empty"))
+	}
+	if d, err := time.ParseDuration(s.ReloadInterval); err != nil || d < 0 {
+		errs = append(errs, fmt.Errorf("reload_interval: invalid duration %v", s.ReloadInterval))
+	}
+	if d, err := time.ParseDuration(s.ShutdownTimeout); err != nil || d <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout: invalid duration %v", s.ShutdownTimeout))
+	}
+	if s.ShutdownDrawPolicy != shutdownCommit && s.ShutdownDrawPolicy != shutdownAbort {
+		errs = append(errs, fmt.Errorf("shutdown_draw_policy: should be %v or %v", shutdownCommit, shutdownAbort))
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls_cert_file and tls_key_file should be set together"))
+	}
+	if s.TLSSelfSigned && !tlsEnabled(s) {
+		errs = append(errs, fmt.Errorf("tls_self_signed: tls_cert_file and tls_key_file are required"))
+	}
+	if !s.TLSSelfSigned && tlsEnabled(s) {
+		if _, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("tls_cert_file, tls_key_file: %v", err))
+		}
+	}
+	for i, origin := range s.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("allowed_origins[%v]: invalid origin %v", i, origin))
+		}
+	}
+	if _, err := newLogHandler(ioutil.Discard, s.LogLevel, s.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateRedactPolicy(s.LogRedact, s.LogRedactKey); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := newNotifiers(s.Notifiers); err != nil {
+		errs = append(errs, fmt.Errorf("notifiers: %v", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadAll loads and validates settings, participants and config.
+func loadAll(f *settingsFlags) (ServerSettings, []Participant, Config, error) {
+	var (
+		participants []Participant
+		config       Config
+	)
+
+	s, err := loadServerSettings(f)
+	if err != nil {
+		return s, participants, config, err
+	}
+
+	if err = validateServerSettings(s); err != nil {
+		return s, participants, config, fmt.Errorf("invalid server settings:\n%v", err)
+	}
+
+	if participants, err = loadParticipants(s.ParticipantsFile); err != nil {
+		return s, participants, config, fmt.Errorf("loadParticipants() error: %v", err)
+	}
+
+	if err = loadConfig(s.ConfigFile, &config); err != nil {
+		return s, participants, config, fmt.Errorf("loadConfig() error: %v", err)
+	}
+
+	if err = lottery.ValidateConfig(config, participants); err != nil {
+		return s, participants, config, fmt.Errorf("invalid config:\n%v", err)
+	}
+
+	return s, participants, config, nil
+}
+
+// runConfigCommand runs "config" sub commands.
+// "config check" loads and validates settings, participants and config.
+func runConfigCommand(args []string) int {
+	if len(args) < 1 || args[0] != "check" {
+		fmt.Fprintf(os.Stderr, "usage: %v config check [flags]\n", os.Args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	f := newSettingsFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	s, participants, config, err := loadAll(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Printf("OK: %v participants, %v prizes, %v blacklists, config: %v, participants: %v\n",
+		len(participants), len(config.Prizes), len(config.Blacklists), s.ConfigFile, s.ParticipantsFile)
+	return 0
+}
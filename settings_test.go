@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestSettings parses the flags and loads the settings.
+func loadTestSettings(t *testing.T, args ...string) (ServerSettings, error) {
+	t.Helper()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := newSettingsFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	return loadServerSettings(f)
+}
+
+// writeTestFile writes the file in a temp dir and returns its path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	return file
+}
+
+func TestLoadServerSettingsPrecedence(t *testing.T) {
+	file := writeTestFile(t, "settings.json", `{
+  "addr": ":9000",
+  "ws_url": "ws://file",
+  "config_file": "conf/config.json",
+  "log_level": "debug",
+  "log_format": "json"
+}`)
+	t.Setenv("LOTTERY_LOG_LEVEL", "warn")
+	t.Setenv("LOTTERY_LOG_FORMAT", "text")
+	t.Setenv("LOTTERY_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("LOTTERY_TLS_SELF_SIGNED", "true")
+
+	s, err := loadTestSettings(t, "-settings", file, "-log-level", "error", "-participants-file", "p.csv")
+	if err != nil {
+		t.Fatalf("loadServerSettings() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		// Defaults < file < env < flags.
+		{"default", s.ShutdownTimeout, "10s"},
+		{"default path not set in the file", s.StaticDir, "dist/spa"},
+		{"file", s.Addr, ":9000"},
+		{"file path relative to the file", s.ConfigFile, filepath.Join(filepath.Dir(file), "conf/config.json")},
+		{"env over file", s.LogFormat, "text"},
+		{"env list", strings.Join(s.AllowedOrigins, ";"), "https://a.example.com;https://b.example.com"},
+		{"env bool", s.TLSSelfSigned, true},
+		{"flag over env and file", s.LogLevel, "error"},
+		{"flag path relative to the current dir", s.ParticipantsFile, "p.csv"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadServerSettingsEnvFile(t *testing.T) {
+	file := writeTestFile(t, "settings.json", `{"addr": ":9000"}`)
+	t.Setenv("LOTTERY_SETTINGS", file)
+
+	if s, err := loadTestSettings(t); err != nil || s.Addr != ":9000" {
+		t.Errorf("loadServerSettings() = %v, %v, want addr of LOTTERY_SETTINGS", s.Addr, err)
+	}
+}
+
+func TestLoadSettingsFileFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"settings.yaml", "addr: \":9000\"\nallowed_origins:\n  - https://a.example.com\n"},
+		{"settings.yml", "addr: \":9000\"\nallowed_origins: [\"https://a.example.com\"]\n"},
+		{"settings.toml", "addr = \":9000\"\nallowed_origins = [\"https://a.example.com\"]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultServerSettings()
+			if err := loadSettingsFile(writeTestFile(t, tt.name, tt.content), &s); err != nil {
+				t.Fatalf("loadSettingsFile() error: %v", err)
+			}
+			if s.Addr != ":9000" || len(s.AllowedOrigins) != 1 || s.LogLevel != "info" {
+				t.Errorf("settings = %+v, want addr, allowed_origins and default log_level", s)
+			}
+		})
+	}
+}
+
+func TestLoadServerSettingsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  string
+		err  string
+	}{
+		{"unknown field", `{"adr": ":9000"}`, "", "unknown field"},
+		{"invalid bool env", `{}`, "yes?", "LOTTERY_TLS_SELF_SIGNED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTestFile(t, "settings.json", tt.file)
+			if tt.env != "" {
+				t.Setenv("LOTTERY_TLS_SELF_SIGNED", tt.env)
+			}
+			if _, err := loadTestSettings(t, "-settings", file); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("loadServerSettings() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := loadTestSettings(t, "-settings", writeTestFile(t, "settings.ini", "")); err == nil {
+		t.Errorf("loadServerSettings() of an unknown format, want error")
+	}
+}
+
+func TestValidateServerSettings(t *testing.T) {
+	if err := validateServerSettings(defaultServerSettings()); err != nil {
+		t.Fatalf("validateServerSettings() of defaults error: %v", err)
+	}
+
+	s := defaultServerSettings()
+	s.Addr = ""
+	s.Store = "redis"
+	s.ReloadInterval = "-1s"
+	s.ShutdownDrawPolicy = "wait"
+	s.TLSCertFile = "cert.pem"
+	s.AllowedOrigins = []string{"*", "example.com"}
+	s.LogRedact = "hash"
+
+	err := validateServerSettings(s)
+	if err == nil {
+		t.Fatalf("validateServerSettings() error = nil")
+	}
+	// All errors are returned.
+	for _, want := range []string{"addr", "store:", "reload_interval", "shutdown_draw_policy", "tls_key_file", "allowed_origins[1]", "log_redact"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validateServerSettings() error = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestLoadSettingsFileStoreDSN(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		isRel bool
+		want  string
+	}{
+		{"sqlite file", `{"store": "sqlite", "store_dsn": "data/lottery.db"}`, true, "data/lottery.db"},
+		{"json file", `{"store": "json", "store_dsn": "lottery.json"}`, true, "lottery.json"},
+		{"absolute path", `{"store": "sqlite", "store_dsn": "/var/lib/lottery.db"}`, false, "/var/lib/lottery.db"},
+		{"sqlite URI", `{"store": "sqlite", "store_dsn": "file:lottery.db?cache=shared"}`, false, "file:lottery.db?cache=shared"},
+		{"sqlite in memory", `{"store": "sqlite", "store_dsn": ":memory:"}`, false, ":memory:"},
+		{"postgres", `{"store": "postgres", "store_dsn": "host=localhost dbname=lottery"}`, false, "host=localhost dbname=lottery"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTestFile(t, "settings.json", tt.file)
+			want := tt.want
+			if tt.isRel {
+				want = filepath.Join(filepath.Dir(file), tt.want)
+			}
+
+			s := defaultServerSettings()
+			if err := loadSettingsFile(file, &s); err != nil {
+				t.Fatalf("loadSettingsFile() error: %v", err)
+			}
+			if s.StoreDSN != want {
+				t.Errorf("store_dsn = %v, want %v", s.StoreDSN, want)
+			}
+		})
+	}
+
+	// store_dsn which is not set in the file is kept.
+	s := defaultServerSettings()
+	s.StoreDSN = "lottery.db"
+	if err := loadSettingsFile(writeTestFile(t, "settings.json", `{"store": "sqlite"}`), &s); err != nil || s.StoreDSN != "lottery.db" {
+		t.Errorf("store_dsn = %v, %v, want lottery.db", s.StoreDSN, err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Policies of the running draw on shutdown.
+const (
+	shutdownCommit = "commit" // Stop the draw and commit the winners.
+	shutdownAbort  = "abort"  // Abort the draw without committing the winners.
+)
+
+// Interval to check if all clients are disconnected on shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+var shutdownFlag int32
+
+func shuttingDown() bool {
+	return atomic.LoadInt32(&shutdownFlag) == 1
+}
+
+// shutdown shuts down the server gracefully within the timeout:
+// stops accepting connections and new draws, commits or aborts the running draw per policy,
+// waits for notifications and closes websocket connections.
+func shutdown(srv *http.Server, policy string, timeout time.Duration) {
+	atomic.StoreInt32(&shutdownFlag, 1)
+
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+	defer cancelTimeout()
+
+	// Stop accepting connections. Hijacked websocket connections are closed later.
+	// Event streams(SSE and gRPC WatchDraw) are ended, otherwise srv.Shutdown waits for them.
+	srv.RegisterOnShutdown(eventFeed.close)
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("srv.Shutdown() error", "err", err)
+	}
+
+	// Stop the running draw like the stop or abort action, and wait for start() to commit or abort.
+	controlMu.Lock()
+	if cancel != nil {
+		slog.Info("stop the running draw", "policy", policy, "request_id", runningRequestID)
+
+		a := Action{Name: "abort", RequestID: newID()}
+		end := abortDrawLocked
+		if policy == shutdownCommit {
+			a.Name, end = "stop", stopDrawLocked
+		}
+		recordAudit(nil, a, end(nil, a))
+	}
+	controlMu.Unlock()
+
+	if !waitDone(ctx, func() {
+		mutex.Lock()
+		mutex.Unlock()
+	}) {
+		slog.Error("timeout to wait for the running draw")
+	}
+
+	// Flush notifications.
+	if !waitDone(ctx, notifyWG.Wait) {
+		slog.Error("timeout to wait for notifications")
+	}
+
+	// Stop the gRPC server.
+	if grpcServer != nil && !waitDone(ctx, grpcServer.GracefulStop) {
+		slog.Error("timeout to stop gRPC server")
+		grpcServer.Stop()
+	}
+
+	// Send close messages to clients and wait for them to disconnect.
+	hub.closeAll()
+	for hub.len() > 0 {
+		select {
+		case <-ctx.Done():
+			slog.Error("timeout to close clients", "clients", hub.len())
+			return
+		case <-time.After(shutdownPollInterval):
+		}
+	}
+
+	// Flush audit events of the closed clients.
+	if !waitDone(ctx, auditWG.Wait) {
+		slog.Error("timeout to save audit events")
+	}
+
+	slog.Info("shutdown completed")
+}
+
+// waitDone calls f and waits until it returns or ctx is done.
+// It returns false if ctx is done first.
+func waitDone(ctx context.Context, f func()) bool {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestShutdownAbortsDraw(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+	t.Cleanup(func() { atomic.StoreInt32(&shutdownFlag, 0) })
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd"})
+	c.waitFor(id, "start")
+
+	aborted := testutil.ToFloat64(drawsAborted)
+	done := make(chan struct{})
+	go func() {
+		shutdown(&http.Server{}, shutdownAbort, testTimeout)
+		close(done)
+	}()
+
+	// The draw is aborted like the abort action, then the client is closed by the server.
+	if res := c.waitFor(id, "abort"); res.Success || res.ErrMsg != errDrawAborted.Error() {
+		t.Fatalf("abort = %+v, want %q", res, errDrawAborted)
+	}
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	<-done
+
+	if got := testutil.ToFloat64(drawsAborted) - aborted; got != 1 {
+		t.Errorf("draws aborted = %v, want 1", got)
+	}
+	if w := lot.Winners("3rd"); len(w) != 0 {
+		t.Errorf("winners = %v, want none", testIDs(w))
+	}
+
+	events := getAuditEvents()
+	if len(events) == 0 {
+		t.Fatalf("no audit events")
+	}
+	if e := events[len(events)-1]; e.Action != "abort" || e.ClientID != "server" || !e.Success {
+		t.Errorf("last audit event = %+v, want the abort by the server", e)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// runSimulateCommand runs the "simulate" sub command: it simulates the event with the config and participants files
+// and reports win probabilities and fairness statistics. It returns 1 if uniformity of any prize is rejected.
+func runSimulateCommand(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	f := newSettingsFlags(fs)
+	runs := fs.Int("runs", 10000, "number of times to run the event")
+	prizes := fs.String("prizes", "", "comma separated IDs of prizes to draw in order, all prizes in the order of the config if it's empty")
+	absent := fs.Float64("absent", 0, "probability of a winner being absent, absent winners are re-lotteried")
+	maxRelotteries := fs.Int("max-relotteries", 3, "max re-lotteries per prize for absent winners")
+	alpha := fs.Float64("alpha", 0.01, "significance level of chi-square uniformity tests")
+	top := fs.Int("top", 20, "number of participants to list by probability of winning any prize, 0 for all")
+	jsonOutput := fs.Bool("json", false, "write the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	_, participants, config, err := loadAll(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	opts := lottery.SimulateOptions{Runs: *runs, AbsentRate: *absent, MaxRelotteries: *maxRelotteries}
+	if *prizes != "" {
+		opts.PrizeIDs = strings.Split(*prizes, ",")
+	}
+
+	s, err := lottery.Simulate(config, participants, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Simulate() error: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	} else {
+		printSimulation(os.Stdout, s, opts, *alpha, *top)
+	}
+
+	for _, p := range s.Prizes {
+		if p.DF > 0 && p.PValue < *alpha {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printSimulation(out io.Writer, s *lottery.Simulation, opts lottery.SimulateOptions, alpha float64, top int) {
+	fmt.Fprintf(out, "Simulated %v runs of %v prizes, %v participants, absent rate: %v\n\n",
+		s.Runs, len(s.Prizes), len(s.Participants), opts.AbsentRate)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PRIZE\tNAME\tNUM\tAVG WINNERS\tAVG ELIGIBLE\tRE-LOTTERIES\tFAILURES\tCHI-SQUARE\tDF\tP-VALUE\tUNIFORM")
+	for _, p := range s.Prizes {
+		uniform := "-"
+		if p.DF > 0 {
+			uniform = "yes"
+			if p.PValue < alpha {
+				uniform = "REJECTED"
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.2f\t%.1f\t%v\t%v\t%.1f\t%v\t%.4f\t%v\n",
+			p.ID, p.Name, p.Num, p.AvgWinners, p.AvgEligible, p.Relotteries, p.Failures, p.ChiSquare, p.DF, p.PValue, uniform)
+	}
+	w.Flush()
+
+	for _, p := range s.Prizes {
+		if p.Err != "" {
+			fmt.Fprintf(out, "%v failed %v times, first error: %v\n", p.ID, p.Failures, p.Err)
+		}
+	}
+
+	if len(s.Blacklists) > 0 {
+		fmt.Fprintf(out, "\nBlacklists(probability of winning any prize, with and without blacklists):\n")
+		w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "INDEX\tMAX TIER\tPRIZES\tPARTICIPANTS\tLISTED\tWITHOUT\tOTHERS\tWITHOUT")
+		for _, b := range s.Blacklists {
+			maxTier := "-"
+			if b.MaxTier != nil {
+				maxTier = fmt.Sprint(*b.MaxTier)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%.4f\t%.4f\t%.4f\t%.4f\n",
+				b.Index, maxTier, strings.Join(b.PrizeIDs, ","), b.Participants, b.Listed, b.ListedWithout, b.Others, b.OthersWithout)
+		}
+		w.Flush()
+	}
+
+	participants := append([]lottery.ParticipantStats{}, s.Participants...)
+	sort.SliceStable(participants, func(i, j int) bool {
+		return participants[i].Any > participants[j].Any
+	})
+	if top > 0 && len(participants) > top {
+		participants = participants[:top]
+	}
+
+	fmt.Fprintf(out, "\nParticipants(probability of winning, top %v by any prize):\n", len(participants))
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "ID\tNAME\tANY")
+	for _, p := range s.Prizes {
+		fmt.Fprintf(w, "\t%v", p.ID)
+	}
+	fmt.Fprintln(w, "\tBLACKLISTS")
+	for _, p := range participants {
+		fmt.Fprintf(w, "%v\t%v\t%.4f", p.ID, p.Name, p.Any)
+		for _, prize := range s.Prizes {
+			fmt.Fprintf(w, "\t%.4f", p.Prizes[prize.ID])
+		}
+		fmt.Fprintf(w, "\t%v\n", strings.Trim(fmt.Sprint(p.Blacklists), "[]"))
+	}
+	w.Flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// serveEvents streams events of eventFeed by Server-Sent Events for read-only screens which can't hold a WebSocket,
+// e.g. behind proxies. Each event has the ID, the name of the action("start" for rounds, "stop", "abort",
+// "state_changed" or "countdown") and the data(JSON of the response, the same as messages sent to WebSocket clients).
+//
+// Reconnecting clients get missed events except rounds and countdowns replayed by the Last-Event-ID header(sent by EventSource automatically),
+// or the last_event_id query for clients which can't set headers.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	ch := eventFeed.subscribe(lastID)
+	defer eventFeed.unsubscribe(ch)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// Disable buffering of nginx.
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	slog.Info("event stream connected", "remote_addr", r.RemoteAddr, "last_event_id", lastID)
+	defer slog.Info("event stream disconnected", "remote_addr", r.RemoteAddr)
+
+	// Comments keep the connection alive through proxies.
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", e.ID, e.Name, e.Data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sseEvent is an event of the SSE stream.
+type sseEvent struct {
+	id, name, data string
+}
+
+// readSSE connects to /api/events with the Last-Event-ID and returns the first n events.
+func readSSE(t *testing.T, url, lastID string, n int) []sseEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", url+"/api/events", nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events error: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %v, want text/event-stream", ct)
+	}
+
+	var (
+		events []sseEvent
+		e      sseEvent
+	)
+	s := bufio.NewScanner(resp.Body)
+	for len(events) < n && s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		case line == "" && e.id != "":
+			events = append(events, e)
+			e = sseEvent{}
+		}
+	}
+	if len(events) < n {
+		t.Fatalf("events = %+v, %v, want %v events", events, s.Err(), n)
+	}
+	return events
+}
+
+func TestSSEReplay(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	first := c.draw("3rd", nil, 3)
+	second := c.draw("2nd", nil, 3)
+	stopTestDraw()
+
+	// Results of both draws are replayed to a new client, rounds are not.
+	events := readSSE(t, srv.URL, eventFeed.boot+"-0", 2)
+	for i, res := range []testResponse{first, second} {
+		if events[i].name != "stop" || !strings.Contains(events[i].data, `"request_id":"`+res.RequestID+`"`) {
+			t.Errorf("event %v = %+v, want the result of %v", i, events[i], res.RequestID)
+		}
+	}
+
+	// A reconnecting client gets events after the last event only.
+	third := c.draw("1st", nil, 1)
+	stopTestDraw()
+	events = readSSE(t, srv.URL, events[1].id, 1)
+	if events[0].name != "stop" || !strings.Contains(events[0].data, third.RequestID) {
+		t.Errorf("event = %+v, want the result of %v", events[0], third.RequestID)
+	}
+}
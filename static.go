@@ -0,0 +1,87 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Default front-end. It can be overridden by files in static_dir.
+//
+//go:embed web
+var webFiles embed.FS
+
+// overlayFS looks up files in the file systems in order.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, fsys := range o {
+		f, err := fsys.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// newStaticFS returns the file system of static files:
+// files in dir(if it exists) override the embedded default front-end.
+func newStaticFS(dir string) fs.FS {
+	web, _ := fs.Sub(webFiles, "web")
+
+	if dir == "" {
+		return web
+	}
+
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		slog.Info("static dir not found, use embedded files only", "static_dir", dir)
+		return web
+	}
+
+	return overlayFS{os.DirFS(dir), web}
+}
+
+// newStaticHandler serves static files of the single page application.
+// "index.html" is served for unknown routes without file extensions(SPA fallback).
+func newStaticHandler(fsys fs.FS) http.Handler {
+	fileServer := http.FileServer(http.FS(fsys))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" {
+			name = "."
+		}
+
+		if fi, err := fs.Stat(fsys, name); err == nil {
+			if !fi.IsDir() {
+				fileServer.ServeHTTP(w, r)
+				return
+			}
+			// Serve dirs with "index.html" only, no dir listing.
+			if _, err = fs.Stat(fsys, path.Join(name, "index.html")); err == nil {
+				fileServer.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeFileFS(w, r, fsys, "index.html")
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// getStatic requests the path from the handler and returns the status and body.
+func getStatic(t *testing.T, h http.Handler, method, path string) (int, string) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	buf, _ := io.ReadAll(w.Result().Body)
+	return w.Code, string(buf)
+}
+
+func TestStaticHandler(t *testing.T) {
+	h := newStaticHandler(fstest.MapFS{
+		"index.html":         {Data: []byte("index")},
+		"app.js":             {Data: []byte("app")},
+		"display/index.html": {Data: []byte("display")},
+		"assets/logo.png":    {Data: []byte("logo")},
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/", http.StatusOK, "index"},
+		{"GET", "/app.js", http.StatusOK, "app"},
+		{"HEAD", "/app.js", http.StatusOK, ""},
+		{"GET", "/display/", http.StatusOK, "display"},
+		// SPA fallback: unknown routes without file extensions.
+		{"GET", "/draws/1st", http.StatusOK, "index"},
+		// Dirs without index.html are not listed.
+		{"GET", "/assets/", http.StatusOK, "index"},
+		{"GET", "/assets/logo.png", http.StatusOK, "logo"},
+		{"GET", "/missing.js", http.StatusNotFound, ""},
+		{"POST", "/", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		status, body := getStatic(t, h, tt.method, tt.path)
+		if status != tt.status || (tt.body != "" && body != tt.body) {
+			t.Errorf("%v %v = %v %q, want %v %q", tt.method, tt.path, status, body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestStaticFSOverlay(t *testing.T) {
+	embedded, _ := fs.ReadFile(newStaticFS(""), "index.html")
+	if len(embedded) == 0 {
+		t.Fatalf("embedded index.html not found")
+	}
+
+	// A static dir which does not exist is ignored.
+	if buf, err := fs.ReadFile(newStaticFS(filepath.Join(t.TempDir(), "missing")), "index.html"); err != nil || string(buf) != string(embedded) {
+		t.Errorf("index.html without static dir = %v, want the embedded one", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("custom"), 0644); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	h := newStaticHandler(newStaticFS(dir))
+
+	// Files in the static dir override the embedded ones, others are still served.
+	if status, body := getStatic(t, h, "GET", "/"); status != http.StatusOK || body != "custom" {
+		t.Errorf("GET / = %v %q, want the custom index.html", status, body)
+	}
+	if status, body := getStatic(t, h, "GET", "/route"); status != http.StatusOK || body != "custom" {
+		t.Errorf("GET /route = %v %q, want the custom index.html", status, body)
+	}
+	if status, body := getStatic(t, h, "GET", "/app.js"); status != http.StatusOK || !strings.Contains(body, "function") {
+		t.Errorf("GET /app.js = %v, want the embedded app.js", status)
+	}
+	if status, _ := getStatic(t, h, "GET", "/display/"); status != http.StatusOK {
+		t.Errorf("GET /display/ = %v, want the embedded display page", status)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+	"github.com/northbright/lottery-server/store"
+)
+
+// Timeout of store operations.
+const storeTimeout = 5 * time.Second
+
+// st persists config, participants, committed draws and audit events.
+var st store.Store
+
+// restoreState loads the state from the store on start.
+// The config and participants in the store override the ones loaded from files,
+// and they're saved to the store if the store is empty(first start of the event).
+// Winners are restored from committed draws and the audit log from audit events.
+func restoreState() error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	c, err := st.Config(ctx)
+	switch err {
+	case nil:
+		lottery.NormalizeConfig(&c)
+		config = c
+	case store.ErrNotFound:
+		if err = st.SaveConfig(ctx, config); err != nil {
+			return fmt.Errorf("SaveConfig() error: %v", err)
+		}
+	default:
+		return fmt.Errorf("Config() error: %v", err)
+	}
+
+	p, err := st.Participants(ctx)
+	switch err {
+	case nil:
+		participants = p
+	case store.ErrNotFound:
+		if err = st.SaveParticipants(ctx, participants); err != nil {
+			return fmt.Errorf("SaveParticipants() error: %v", err)
+		}
+	default:
+		return fmt.Errorf("Participants() error: %v", err)
+	}
+
+	if err = lottery.ValidateConfig(config, participants); err != nil {
+		return fmt.Errorf("invalid config in store:\n%v", err)
+	}
+
+	draws, err := st.Draws(ctx)
+	if err != nil {
+		return fmt.Errorf("Draws() error: %v", err)
+	}
+	if lot, err = lottery.New(config, participants); err != nil {
+		return err
+	}
+	lot.Restore(store.Winners(draws))
+
+	events, err := st.AuditEvents(ctx, maxAuditEvents)
+	if err != nil {
+		return fmt.Errorf("AuditEvents() error: %v", err)
+	}
+	auditMu.Lock()
+	auditEvents = events
+	auditMu.Unlock()
+
+	slog.Info("state restored", "store", settings.Store, "event", settings.Event, "draws", len(draws), "audit_events", len(events))
+	return nil
+}
+
+// saveState saves the config and participants applied by applyState.
+// The state is applied already, so errors are logged only.
+func saveState(config Config, participants []Participant) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := st.SaveConfig(ctx, config); err != nil {
+		slog.Error("SaveConfig() error", "err", err)
+	}
+	if err := st.SaveParticipants(ctx, participants); err != nil {
+		slog.Error("SaveParticipants() error", "err", err)
+	}
+}
+
+// saveDraw saves the committed draw. The winners are committed already, so errors are logged only.
+func saveDraw(a Action, drawn, winners []Participant) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	d := store.Draw{
+		ID:               a.RequestID,
+		Time:             time.Now(),
+		PrizeID:          a.PrizeID,
+		OldWinnerIndexes: a.OldWinnerIndexes,
+		Drawn:            drawn,
+		Winners:          winners,
+	}
+	if err := st.AddDraw(ctx, d); err != nil {
+		slog.Error("AddDraw() error", "request_id", a.RequestID, "prize_id", a.PrizeID, "err", err)
+	}
+}
+
+// saveAuditEvent saves the audit event to the store. Errors are logged only.
+func saveAuditEvent(s store.Store, e AuditEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := s.AddAuditEvent(ctx, e); err != nil {
+		slog.Error("AddAuditEvent() error", "request_id", e.RequestID, "err", err)
+	}
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// JSONFile keeps the state in one JSON file. The whole file is rewritten on every change,
+// so it's for small events only.
+type JSONFile struct {
+	mu    sync.Mutex
+	file  string
+	state jsonState
+}
+
+// jsonState is the content of the JSON file.
+type jsonState struct {
+	Config       *lottery.Config     `json:"config"`
+	Participants []participantRecord `json:"participants"`
+	Draws        []drawRecord        `json:"draws"`
+	AuditEvents  []AuditEvent        `json:"audit_events"`
+}
+
+// drawRecord is the stored form of the draw, which keeps emails of participants.
+type drawRecord struct {
+	ID               string              `json:"id"`
+	Time             time.Time           `json:"time"`
+	PrizeID          string              `json:"prize_id"`
+	OldWinnerIndexes []int               `json:"old_winner_indexes"`
+	Drawn            []participantRecord `json:"drawn"`
+	Winners          []participantRecord `json:"winners"`
+}
+
+// OpenJSONFile opens the JSON file store. The file is created on the first change if it does not exist.
+func OpenJSONFile(file string) (*JSONFile, error) {
+	s := &JSONFile{file: file}
+
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(buf, &s.state); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONFile) Config(ctx context.Context) (lottery.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Config == nil {
+		return lottery.Config{}, ErrNotFound
+	}
+	return cloneConfig(*s.state.Config)
+}
+
+func (s *JSONFile) SaveConfig(ctx context.Context, config lottery.Config) error {
+	c, err := cloneConfig(config)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state
+	state.Config = &c
+	return s.save(state)
+}
+
+func (s *JSONFile) Participants(ctx context.Context) ([]lottery.Participant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.state.Participants) == 0 {
+		return nil, ErrNotFound
+	}
+	return cloneParticipants(fromRecords(s.state.Participants)), nil
+}
+
+func (s *JSONFile) SaveParticipants(ctx context.Context, participants []lottery.Participant) error {
+	records := toRecords(cloneParticipants(participants))
+	if records == nil {
+		records = []participantRecord{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state
+	state.Participants = records
+	return s.save(state)
+}
+
+func (s *JSONFile) Draws(ctx context.Context) ([]Draw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := make([]Draw, len(s.state.Draws))
+	for i, r := range s.state.Draws {
+		l[i] = cloneDraw(Draw{r.ID, r.Time, r.PrizeID, r.OldWinnerIndexes, fromRecords(r.Drawn), fromRecords(r.Winners)})
+	}
+	return l, nil
+}
+
+func (s *JSONFile) AddDraw(ctx context.Context, d Draw) error {
+	d = cloneDraw(d)
+	r := drawRecord{d.ID, d.Time, d.PrizeID, d.OldWinnerIndexes, toRecords(d.Drawn), toRecords(d.Winners)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state
+	state.Draws = append(state.Draws[:len(state.Draws):len(state.Draws)], r)
+	return s.save(state)
+}
+
+func (s *JSONFile) AuditEvents(ctx context.Context, n int) ([]AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return lastAuditEvents(s.state.AuditEvents, n), nil
+}
+
+func (s *JSONFile) AddAuditEvent(ctx context.Context, e AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state
+	state.AuditEvents = appendAuditEvent(state.AuditEvents, e)
+	return s.save(state)
+}
+
+func (s *JSONFile) Close() error {
+	return nil
+}
+
+// save writes the new state to the file and keeps it if it's written. The caller should hold s.mu.
+func (s *JSONFile) save(state jsonState) error {
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename it to avoid a partial file.
+	tmp := s.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(buf, '\n'), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.file); err != nil {
+		return err
+	}
+
+	s.state = state
+	return nil
+}
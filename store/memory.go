@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// Memory keeps the state in memory. It's used for tests or if nothing needs to be persisted.
+type Memory struct {
+	mu           sync.Mutex
+	config       *lottery.Config
+	participants []lottery.Participant
+	draws        []Draw
+	auditEvents  []AuditEvent
+}
+
+// NewMemory returns an empty memory store.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Config(ctx context.Context) (lottery.Config, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.config == nil {
+		return lottery.Config{}, ErrNotFound
+	}
+	return cloneConfig(*m.config)
+}
+
+func (m *Memory) SaveConfig(ctx context.Context, config lottery.Config) error {
+	c, err := cloneConfig(config)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.config = &c
+	return nil
+}
+
+func (m *Memory) Participants(ctx context.Context) ([]lottery.Participant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.participants) == 0 {
+		return nil, ErrNotFound
+	}
+	return cloneParticipants(m.participants), nil
+}
+
+func (m *Memory) SaveParticipants(ctx context.Context, participants []lottery.Participant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.participants = cloneParticipants(participants)
+	if m.participants == nil {
+		m.participants = []lottery.Participant{}
+	}
+	return nil
+}
+
+func (m *Memory) Draws(ctx context.Context) ([]Draw, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := make([]Draw, len(m.draws))
+	for i, d := range m.draws {
+		l[i] = cloneDraw(d)
+	}
+	return l, nil
+}
+
+func (m *Memory) AddDraw(ctx context.Context, d Draw) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.draws = append(m.draws, cloneDraw(d))
+	return nil
+}
+
+func (m *Memory) AuditEvents(ctx context.Context, n int) ([]AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return lastAuditEvents(m.auditEvents, n), nil
+}
+
+func (m *Memory) AddAuditEvent(ctx context.Context, e AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.auditEvents = appendAuditEvent(m.auditEvents, e)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// cloneConfig returns a deep copy of the config. The config contains pointers and slices in nested structs,
+// it's simpler to copy it by JSON.
+func cloneConfig(config lottery.Config) (lottery.Config, error) {
+	var c lottery.Config
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(buf, &c)
+	return c, err
+}
+
+// Max number of audit events kept by Memory and JSONFile. Older events are dropped.
+var maxAuditEvents = 10000
+
+// appendAuditEvent appends the event to events without modifying the array of events(it may be shared),
+// and drops the oldest events over maxAuditEvents.
+func appendAuditEvent(events []AuditEvent, e AuditEvent) []AuditEvent {
+	events = append(events[:len(events):len(events)], e)
+	if len(events) > maxAuditEvents {
+		events = events[len(events)-maxAuditEvents:]
+	}
+	return events
+}
+
+// lastAuditEvents returns a copy of the last n events, all events if n <= 0.
+func lastAuditEvents(events []AuditEvent, n int) []AuditEvent {
+	if n > 0 && len(events) > n {
+		events = events[len(events)-n:]
+	}
+	return append([]AuditEvent{}, events...)
+}
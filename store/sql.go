@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// SQL keeps the state in a SQLite or PostgreSQL database. The state is scoped by the event,
+// so that one database serves multiple events. Tables are created if they do not exist.
+// The config is stored as a JSON document, participants, draws and audit events as rows.
+type SQL struct {
+	db       *sql.DB
+	event    string
+	postgres bool
+}
+
+// Schemas of drivers. The only difference is the auto-increment sequence column.
+var sqlSchemas = map[string]string{
+	DriverSQLite:   strings.Replace(sqlSchema, "SEQ", "INTEGER PRIMARY KEY AUTOINCREMENT", -1),
+	DriverPostgres: strings.Replace(sqlSchema, "SEQ", "BIGSERIAL PRIMARY KEY", -1),
+}
+
+// Names of database/sql drivers.
+var sqlDrivers = map[string]string{
+	DriverSQLite:   "sqlite3",
+	DriverPostgres: "postgres",
+}
+
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS configs (
+	event TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS participants (
+	event TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	attrs TEXT NOT NULL,
+	PRIMARY KEY (event, position)
+);
+CREATE TABLE IF NOT EXISTS draws (
+	seq SEQ,
+	event TEXT NOT NULL,
+	id TEXT NOT NULL,
+	time TIMESTAMP NOT NULL,
+	prize_id TEXT NOT NULL,
+	old_winner_indexes TEXT NOT NULL,
+	drawn TEXT NOT NULL,
+	winners TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS draws_event ON draws (event, seq);
+CREATE TABLE IF NOT EXISTS audit_events (
+	seq SEQ,
+	event TEXT NOT NULL,
+	time TIMESTAMP NOT NULL,
+	client_id TEXT NOT NULL,
+	remote_addr TEXT NOT NULL,
+	request_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	prize_id TEXT NOT NULL,
+	prize_index INTEGER NOT NULL,
+	success BOOLEAN NOT NULL,
+	err_msg TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_event ON audit_events (event, seq);
+`
+
+// OpenSQL opens the database of the driver("sqlite" or "postgres") and creates tables if they do not exist.
+func OpenSQL(driver, dsn, event string) (*SQL, error) {
+	schema, ok := sqlSchemas[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown SQL driver: %v", driver)
+	}
+
+	db, err := sql.Open(sqlDrivers[driver], dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute statements one by one to be portable between drivers.
+	for _, stmt := range strings.Split(schema, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create tables error: %v", err)
+		}
+	}
+
+	return &SQL{db: db, event: event, postgres: driver == DriverPostgres}, nil
+}
+
+// rebind replaces "?" placeholders with "$1", "$2"... for PostgreSQL.
+func (s *SQL) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%v", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQL) Config(ctx context.Context) (lottery.Config, error) {
+	var (
+		config lottery.Config
+		data   string
+	)
+
+	err := s.db.QueryRowContext(ctx, s.rebind("SELECT data FROM configs WHERE event = ?"), s.event).Scan(&data)
+	if err == sql.ErrNoRows {
+		return config, ErrNotFound
+	}
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal([]byte(data), &config)
+	return config, err
+}
+
+func (s *SQL) SaveConfig(ctx context.Context, config lottery.Config) error {
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	// Both SQLite and PostgreSQL support upsert by ON CONFLICT.
+	_, err = s.db.ExecContext(ctx,
+		s.rebind("INSERT INTO configs (event, data) VALUES (?, ?) ON CONFLICT (event) DO UPDATE SET data = excluded.data"),
+		s.event, string(buf))
+	return err
+}
+
+func (s *SQL) Participants(ctx context.Context) ([]lottery.Participant, error) {
+	rows, err := s.db.QueryContext(ctx,
+		s.rebind("SELECT id, name, email, attrs FROM participants WHERE event = ? ORDER BY position"), s.event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []lottery.Participant
+	for rows.Next() {
+		var (
+			p     lottery.Participant
+			attrs string
+		)
+		if err = rows.Scan(&p.ID, &p.Name, &p.Email, &attrs); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(attrs), &p.Attrs); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(participants) == 0 {
+		return nil, ErrNotFound
+	}
+	return participants, nil
+}
+
+func (s *SQL) SaveParticipants(ctx context.Context, participants []lottery.Participant) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, s.rebind("DELETE FROM participants WHERE event = ?"), s.event); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		s.rebind("INSERT INTO participants (event, position, id, name, email, attrs) VALUES (?, ?, ?, ?, ?, ?)"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, p := range participants {
+		// Attrs is null if it's nil.
+		attrs, err := json.Marshal(p.Attrs)
+		if err != nil {
+			return err
+		}
+		if _, err = stmt.ExecContext(ctx, s.event, i, p.ID, p.Name, p.Email, string(attrs)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQL) Draws(ctx context.Context) ([]Draw, error) {
+	rows, err := s.db.QueryContext(ctx,
+		s.rebind("SELECT id, time, prize_id, old_winner_indexes, drawn, winners FROM draws WHERE event = ? ORDER BY seq"), s.event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	draws := []Draw{}
+	for rows.Next() {
+		var (
+			d                           Draw
+			indexes                     string
+			drawn, winners              string
+			drawnRecords, winnerRecords []participantRecord
+		)
+		if err = rows.Scan(&d.ID, &d.Time, &d.PrizeID, &indexes, &drawn, &winners); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(indexes), &d.OldWinnerIndexes); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(drawn), &drawnRecords); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(winners), &winnerRecords); err != nil {
+			return nil, err
+		}
+		d.Drawn, d.Winners = fromRecords(drawnRecords), fromRecords(winnerRecords)
+		draws = append(draws, d)
+	}
+	return draws, rows.Err()
+}
+
+func (s *SQL) AddDraw(ctx context.Context, d Draw) error {
+	var values []string
+	for _, v := range []interface{}{d.OldWinnerIndexes, toRecords(d.Drawn), toRecords(d.Winners)} {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(buf))
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		s.rebind("INSERT INTO draws (event, id, time, prize_id, old_winner_indexes, drawn, winners) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		s.event, d.ID, d.Time, d.PrizeID, values[0], values[1], values[2])
+	return err
+}
+
+func (s *SQL) AuditEvents(ctx context.Context, n int) ([]AuditEvent, error) {
+	query := "SELECT time, client_id, remote_addr, request_id, action, prize_id, prize_index, success, err_msg FROM audit_events WHERE event = ? ORDER BY seq DESC"
+	args := []interface{}{s.event}
+	if n > 0 {
+		query += " LIMIT ?"
+		args = append(args, n)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		if err = rows.Scan(&e.Time, &e.ClientID, &e.RemoteAddr, &e.RequestID, &e.Action, &e.PrizeID, &e.PrizeIndex, &e.Success, &e.ErrMsg); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Events are queried in descending order to get the last n events.
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+func (s *SQL) AddAuditEvent(ctx context.Context, e AuditEvent) error {
+	_, err := s.db.ExecContext(ctx,
+		s.rebind("INSERT INTO audit_events (event, time, client_id, remote_addr, request_id, action, prize_id, prize_index, success, err_msg) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		s.event, e.Time, e.ClientID, e.RemoteAddr, e.RequestID, e.Action, e.PrizeID, e.PrizeIndex, e.Success, e.ErrMsg)
+	return err
+}
+
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
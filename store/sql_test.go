@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+func openTestSQLite(t *testing.T, file, event string) *SQL {
+	t.Helper()
+
+	s, err := OpenSQL(DriverSQLite, file, event)
+	if err != nil {
+		t.Fatalf("OpenSQL() error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLEvents(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "state.db")
+
+	// Two events share the database.
+	a, b := openTestSQLite(t, file, "a"), openTestSQLite(t, file, "b")
+
+	if err := a.SaveConfig(ctx, lottery.Config{Prizes: []lottery.Prize{{ID: "1st", Name: "1st", Num: 1}}}); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+	if err := a.SaveParticipants(ctx, []lottery.Participant{{ID: "1", Name: "Frank"}}); err != nil {
+		t.Fatalf("SaveParticipants() error: %v", err)
+	}
+	if err := a.AddDraw(ctx, Draw{ID: "r1", Time: time.Now(), PrizeID: "1st"}); err != nil {
+		t.Fatalf("AddDraw() error: %v", err)
+	}
+	if err := a.AddAuditEvent(ctx, AuditEvent{Time: time.Now(), RequestID: "r1", Action: "start"}); err != nil {
+		t.Fatalf("AddAuditEvent() error: %v", err)
+	}
+
+	if _, err := b.Config(ctx); err != ErrNotFound {
+		t.Errorf("Config() of event b error = %v, want ErrNotFound", err)
+	}
+	if _, err := b.Participants(ctx); err != ErrNotFound {
+		t.Errorf("Participants() of event b error = %v, want ErrNotFound", err)
+	}
+	if draws, err := b.Draws(ctx); err != nil || len(draws) != 0 {
+		t.Errorf("Draws() of event b = %+v, %v, want no draws", draws, err)
+	}
+	if events, err := b.AuditEvents(ctx, 0); err != nil || len(events) != 0 {
+		t.Errorf("AuditEvents() of event b = %+v, %v, want no events", events, err)
+	}
+
+	// Saving participants of event b does not replace those of event a.
+	if err := b.SaveParticipants(ctx, []lottery.Participant{{ID: "2", Name: "Bob"}}); err != nil {
+		t.Fatalf("SaveParticipants() error: %v", err)
+	}
+	if p, err := a.Participants(ctx); err != nil || len(p) != 1 || p[0].ID != "1" {
+		t.Errorf("Participants() of event a = %+v, %v, want Frank", p, err)
+	}
+}
+
+func TestSQLSave(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "state.db"), "test")
+
+	// Saving again replaces the config and participants.
+	for _, n := range []int{3, 1} {
+		var prizes []lottery.Prize
+		for i := 0; i < n; i++ {
+			prizes = append(prizes, lottery.Prize{ID: fmt.Sprintf("p%v", i), Name: "prize", Num: 1})
+		}
+		if err := s.SaveConfig(ctx, lottery.Config{Prizes: prizes}); err != nil {
+			t.Fatalf("SaveConfig() error: %v", err)
+		}
+	}
+	if c, err := s.Config(ctx); err != nil || len(c.Prizes) != 1 {
+		t.Errorf("Config() = %+v, %v, want 1 prize", c, err)
+	}
+
+	participants := []lottery.Participant{
+		{ID: "3", Name: "C"},
+		{ID: "1", Name: "A", Attrs: map[string]string{"office": "SH"}},
+		{ID: "2", Name: "B"},
+	}
+	if err := s.SaveParticipants(ctx, participants); err != nil {
+		t.Fatalf("SaveParticipants() error: %v", err)
+	}
+	// The order of participants is kept.
+	if p, err := s.Participants(ctx); err != nil || !reflect.DeepEqual(p, participants) {
+		t.Errorf("Participants() = %+v, %v, want %+v", p, err, participants)
+	}
+
+	if err := s.SaveParticipants(ctx, participants[1:2]); err != nil {
+		t.Fatalf("SaveParticipants() error: %v", err)
+	}
+	if p, err := s.Participants(ctx); err != nil || !reflect.DeepEqual(p, participants[1:2]) {
+		t.Errorf("Participants() = %+v, %v, want %+v", p, err, participants[1:2])
+	}
+}
+
+func TestSQLDraws(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "state.db"), "test")
+
+	p := []lottery.Participant{{ID: "1", Name: "A"}, {ID: "2", Name: "B"}, {ID: "3", Name: "C"}}
+	now := time.Now().UTC().Truncate(time.Second)
+	draws := []Draw{
+		{ID: "r1", Time: now, PrizeID: "2nd", Drawn: p[:2], Winners: p[:2]},
+		{ID: "r2", Time: now, PrizeID: "1st", Drawn: p[2:], Winners: p[2:]},
+		// Re-lottery of the 2nd winner of 2nd.
+		{ID: "r3", Time: now, PrizeID: "2nd", OldWinnerIndexes: []int{1}, Drawn: p[2:], Winners: []lottery.Participant{p[0], p[2]}},
+	}
+	for _, d := range draws {
+		if err := s.AddDraw(ctx, d); err != nil {
+			t.Fatalf("AddDraw() error: %v", err)
+		}
+	}
+
+	got, err := s.Draws(ctx)
+	if err != nil {
+		t.Fatalf("Draws() error: %v", err)
+	}
+	// Draws are listed in the order they're added.
+	if !reflect.DeepEqual(got, draws) {
+		t.Fatalf("Draws() = %+v, want %+v", got, draws)
+	}
+
+	winners := Winners(got)
+	if ids := []string{winners["2nd"][0].ID, winners["2nd"][1].ID, winners["1st"][0].ID}; !reflect.DeepEqual(ids, []string{"1", "3", "3"}) {
+		t.Errorf("Winners() = %+v, want winners of the last draws", winners)
+	}
+}
+
+func TestSQLAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "state.db"), "test")
+
+	e := AuditEvent{Time: time.Now().UTC().Truncate(time.Second), ClientID: "c1", RemoteAddr: "127.0.0.1:1234", RequestID: "r1",
+		Action: "stop", PrizeID: "1st", PrizeIndex: 2, Success: false, ErrMsg: "no draw is running"}
+	if err := s.AddAuditEvent(ctx, e); err != nil {
+		t.Fatalf("AddAuditEvent() error: %v", err)
+	}
+	if err := s.AddAuditEvent(ctx, AuditEvent{Time: e.Time, RequestID: "r2", Action: "start", Success: true}); err != nil {
+		t.Fatalf("AddAuditEvent() error: %v", err)
+	}
+
+	// All events are returned if n is 0.
+	events, err := s.AuditEvents(ctx, 0)
+	if err != nil || len(events) != 2 || events[1].RequestID != "r2" {
+		t.Fatalf("AuditEvents(0) = %+v, %v, want 2 events in order", events, err)
+	}
+	if !events[0].Time.Equal(e.Time) {
+		t.Errorf("time = %v, want %v", events[0].Time, e.Time)
+	}
+	events[0].Time = e.Time
+	if events[0] != e {
+		t.Errorf("AuditEvents(0)[0] = %+v, want %+v", events[0], e)
+	}
+
+	if events, err = s.AuditEvents(ctx, 5); err != nil || len(events) != 2 {
+		t.Errorf("AuditEvents(5) = %+v, %v, want 2 events", events, err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "INSERT INTO t (a, b) VALUES (?, ?)"
+
+	if got := (&SQL{}).rebind(query); got != query {
+		t.Errorf("rebind() of sqlite = %v, want %v", got, query)
+	}
+	if got, want := (&SQL{postgres: true}).rebind(query), "INSERT INTO t (a, b) VALUES ($1, $2)"; got != want {
+		t.Errorf("rebind() of postgres = %v, want %v", got, want)
+	}
+}
+
+func TestOpenSQLUnknownDriver(t *testing.T) {
+	if _, err := OpenSQL(DriverJSON, "", "test"); err == nil {
+		t.Errorf("OpenSQL(json) error = nil, want error")
+	}
+}
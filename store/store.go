@@ -0,0 +1,163 @@
+// Package store persists the state of the lottery server:
+// participants, config(prizes and blacklists), committed draws and audit events.
+//
+// There're 3 implementations:
+// Memory for tests, JSONFile for small events and SQL(SQLite or PostgreSQL) for multi-event deployments.
+// Use Open to open a store by the driver name:
+//
+//	s, err := store.Open("sqlite", "lottery.db", "annual-party-2026")
+//	...
+//	defer s.Close()
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// ErrNotFound is returned by Config and Participants if they're not saved yet(or no participants are saved).
+var ErrNotFound = errors.New("not found")
+
+// Store saves and loads the state of one event. Implementations are safe for concurrent use.
+type Store interface {
+	// Config returns the config which contains prizes and blacklists.
+	Config(ctx context.Context) (lottery.Config, error)
+	SaveConfig(ctx context.Context, config lottery.Config) error
+
+	Participants(ctx context.Context) ([]lottery.Participant, error)
+	SaveParticipants(ctx context.Context, participants []lottery.Participant) error
+
+	// Draws returns committed draws in the order they're added.
+	Draws(ctx context.Context) ([]Draw, error)
+	AddDraw(ctx context.Context, d Draw) error
+
+	// AuditEvents returns the last n audit events in the order they're added, all events if n <= 0.
+	// Memory and JSONFile keep the last 10000 events only.
+	AuditEvents(ctx context.Context, n int) ([]AuditEvent, error)
+	AddAuditEvent(ctx context.Context, e AuditEvent) error
+
+	Close() error
+}
+
+// Draw is a committed draw of a prize.
+type Draw struct {
+	// ID is the request ID of the start action of the draw.
+	ID               string    `json:"id"`
+	Time             time.Time `json:"time"`
+	PrizeID          string    `json:"prize_id"`
+	OldWinnerIndexes []int     `json:"old_winner_indexes"`
+	// Participants drawn by the draw.
+	Drawn []lottery.Participant `json:"drawn"`
+	// All winners of the prize after the draw is committed.
+	Winners []lottery.Participant `json:"winners"`
+}
+
+// AuditEvent records an action received from a client.
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	ClientID   string    `json:"client_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	RequestID  string    `json:"request_id"`
+	Action     string    `json:"action"`
+	PrizeID    string    `json:"prize_id"`
+	PrizeIndex int       `json:"prize_index"`
+	Success    bool      `json:"success"`
+	ErrMsg     string    `json:"err_msg"`
+}
+
+// Winners returns the winners of prizes by prize IDs: winners of the last draw of each prize.
+func Winners(draws []Draw) map[string][]lottery.Participant {
+	m := map[string][]lottery.Participant{}
+	for _, d := range draws {
+		m[d.PrizeID] = d.Winners
+	}
+	return m
+}
+
+// Drivers of stores.
+const (
+	DriverMemory   = "memory"
+	DriverJSON     = "json"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Open opens the store by the driver name.
+// dsn is ignored by memory, the path of the file for json and sqlite, or the connection string for postgres.
+// event is the name of the event which scopes the state in SQL stores, so that one database serves multiple events.
+// It's ignored by memory and json stores.
+func Open(driver, dsn, event string) (Store, error) {
+	switch driver {
+	case DriverMemory:
+		return NewMemory(), nil
+	case DriverJSON:
+		return OpenJSONFile(dsn)
+	case DriverSQLite, DriverPostgres:
+		return OpenSQL(driver, dsn, event)
+	}
+	return nil, fmt.Errorf("unknown driver: %v", driver)
+}
+
+// cloneParticipants returns a deep copy of participants, so that stored participants are not modified by callers.
+func cloneParticipants(participants []lottery.Participant) []lottery.Participant {
+	if participants == nil {
+		return nil
+	}
+
+	l := make([]lottery.Participant, len(participants))
+	for i, p := range participants {
+		l[i] = p
+		if p.Attrs != nil {
+			l[i].Attrs = map[string]string{}
+			for k, v := range p.Attrs {
+				l[i].Attrs[k] = v
+			}
+		}
+	}
+	return l
+}
+
+// cloneDraw returns a deep copy of the draw.
+func cloneDraw(d Draw) Draw {
+	d.OldWinnerIndexes = append([]int(nil), d.OldWinnerIndexes...)
+	d.Drawn = cloneParticipants(d.Drawn)
+	d.Winners = cloneParticipants(d.Winners)
+	return d
+}
+
+// participantRecord is the stored form of the participant.
+// Participant does not marshal the email to JSON(it's not sent to clients), but the store should keep it.
+type participantRecord struct {
+	ID    string            `json:"id"`
+	Name  string            `json:"name"`
+	Email string            `json:"email,omitempty"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+func toRecords(participants []lottery.Participant) []participantRecord {
+	if participants == nil {
+		return nil
+	}
+
+	l := make([]participantRecord, len(participants))
+	for i, p := range participants {
+		l[i] = participantRecord{p.ID, p.Name, p.Email, p.Attrs}
+	}
+	return l
+}
+
+func fromRecords(records []participantRecord) []lottery.Participant {
+	if records == nil {
+		return nil
+	}
+
+	l := make([]lottery.Participant, len(records))
+	for i, r := range records {
+		l[i] = lottery.Participant{ID: r.ID, Name: r.Name, Email: r.Email, Attrs: r.Attrs}
+	}
+	return l
+}
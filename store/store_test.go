@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/northbright/lottery-server/lottery"
+)
+
+// testStores returns stores of all drivers except postgres, which needs a server.
+func testStores(t *testing.T) map[string]func() Store {
+	dir := t.TempDir()
+
+	open := func(driver, dsn, event string) func() Store {
+		return func() Store {
+			s, err := Open(driver, dsn, event)
+			if err != nil {
+				t.Fatalf("Open(%v) error: %v", driver, err)
+			}
+			return s
+		}
+	}
+
+	return map[string]func() Store{
+		DriverMemory: open(DriverMemory, "", "test"),
+		DriverJSON:   open(DriverJSON, filepath.Join(dir, "state.json"), "test"),
+		DriverSQLite: open(DriverSQLite, filepath.Join(dir, "state.db"), "test"),
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	config := lottery.Config{Prizes: []lottery.Prize{{ID: "1st", Tier: 1, Name: "1st", Num: 1}}}
+	participants := []lottery.Participant{
+		{ID: "1", Name: "Frank", Email: "frank@example.com", Attrs: map[string]string{"office": "SH"}},
+		{ID: "2", Name: "Bob"},
+	}
+	draw := Draw{
+		ID:      "r1",
+		Time:    time.Now().UTC().Truncate(time.Second),
+		PrizeID: "1st",
+		Drawn:   participants[:1],
+		Winners: participants[:1],
+	}
+
+	for driver, open := range testStores(t) {
+		t.Run(driver, func(t *testing.T) {
+			s := open()
+			defer s.Close()
+
+			if _, err := s.Config(ctx); err != ErrNotFound {
+				t.Errorf("Config() error = %v, want ErrNotFound", err)
+			}
+			if _, err := s.Participants(ctx); err != ErrNotFound {
+				t.Errorf("Participants() error = %v, want ErrNotFound", err)
+			}
+
+			if err := s.SaveConfig(ctx, config); err != nil {
+				t.Fatalf("SaveConfig() error: %v", err)
+			}
+			if err := s.SaveParticipants(ctx, participants); err != nil {
+				t.Fatalf("SaveParticipants() error: %v", err)
+			}
+			if err := s.AddDraw(ctx, draw); err != nil {
+				t.Fatalf("AddDraw() error: %v", err)
+			}
+			for _, ID := range []string{"a", "b", "c"} {
+				if err := s.AddAuditEvent(ctx, AuditEvent{Time: draw.Time, RequestID: ID, Action: "start", Success: true}); err != nil {
+					t.Fatalf("AddAuditEvent() error: %v", err)
+				}
+			}
+
+			c, err := s.Config(ctx)
+			if err != nil || len(c.Prizes) != 1 || c.Prizes[0].ID != "1st" {
+				t.Errorf("Config() = %+v, %v", c, err)
+			}
+
+			p, err := s.Participants(ctx)
+			if err != nil || !reflect.DeepEqual(p, participants) {
+				t.Errorf("Participants() = %+v, %v, want %+v", p, err, participants)
+			}
+
+			draws, err := s.Draws(ctx)
+			if err != nil || len(draws) != 1 || draws[0].ID != "r1" || !draws[0].Time.Equal(draw.Time) {
+				t.Errorf("Draws() = %+v, %v", draws, err)
+			}
+			if winners := Winners(draws)["1st"]; len(winners) != 1 || winners[0].Email != "frank@example.com" {
+				t.Errorf("Winners() = %+v, want winners with emails", winners)
+			}
+
+			events, err := s.AuditEvents(ctx, 2)
+			if err != nil || len(events) != 2 || events[0].RequestID != "b" || events[1].RequestID != "c" {
+				t.Errorf("AuditEvents(2) = %+v, %v, want the last 2 events", events, err)
+			}
+		})
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	ctx := context.Background()
+
+	for driver, open := range testStores(t) {
+		if driver == DriverMemory {
+			continue
+		}
+
+		t.Run(driver, func(t *testing.T) {
+			s := open()
+			if err := s.AddDraw(ctx, Draw{ID: "r1", Time: time.Now(), PrizeID: "1st"}); err != nil {
+				t.Fatalf("AddDraw() error: %v", err)
+			}
+			s.Close()
+
+			s = open()
+			defer s.Close()
+			if draws, err := s.Draws(ctx); err != nil || len(draws) != 1 {
+				t.Errorf("Draws() after reopen = %+v, %v, want 1 draw", draws, err)
+			}
+		})
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	if _, err := Open("mongo", "", "test"); err == nil {
+		t.Errorf("Open(mongo) error = nil, want error")
+	}
+}
+
+func TestAuditEventsRetention(t *testing.T) {
+	ctx := context.Background()
+
+	old := maxAuditEvents
+	maxAuditEvents = 3
+	t.Cleanup(func() { maxAuditEvents = old })
+
+	for driver, open := range testStores(t) {
+		if driver == DriverSQLite {
+			continue
+		}
+
+		t.Run(driver, func(t *testing.T) {
+			s := open()
+			defer s.Close()
+
+			for i := 0; i < 5; i++ {
+				if err := s.AddAuditEvent(ctx, AuditEvent{RequestID: fmt.Sprintf("r%v", i)}); err != nil {
+					t.Fatalf("AddAuditEvent() error: %v", err)
+				}
+			}
+
+			events, err := s.AuditEvents(ctx, 0)
+			if err != nil {
+				t.Fatalf("AuditEvents() error: %v", err)
+			}
+			ids := []string{}
+			for _, e := range events {
+				ids = append(ids, e.RequestID)
+			}
+			if got := strings.Join(ids, ","); got != "r2,r3,r4" {
+				t.Errorf("AuditEvents() = %v, want the last 3 events r2,r3,r4", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Validity of the generated self-signed certificate.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+func tlsEnabled(s ServerSettings) bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+// ensureSelfSignedCert generates a self-signed certificate and key to the files if any of them does not exist.
+// The certificate is valid for localhost, the host name, IPs of local interfaces and extra hosts.
+func ensureSelfSignedCert(certFile, keyFile string, extraHosts []string) error {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return nil
+	}
+
+	hosts := selfSignedHosts(extraHosts)
+	certPEM, keyPEM, err := genSelfSignedCert(hosts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+
+	slog.Info("self-signed certificate generated", "cert_file", certFile, "key_file", keyFile, "hosts", hosts)
+	return nil
+}
+
+func selfSignedHosts(extraHosts []string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+
+	return append(hosts, extraHosts...)
+}
+
+// genSelfSignedCert generates a self-signed ECDSA P-256 certificate for the hosts.
+// It returns PEM encoded certificate and key.
+func genSelfSignedCert(hosts []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"lottery-server"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// getWSURL returns the websocket URL for the client.
+// If ws_url is not set, it's built from the host of the request.
+// The scheme is "wss" if TLS is enabled.
+func getWSURL(s ServerSettings, r *http.Request) string {
+	scheme := "ws"
+	if tlsEnabled(s) {
+		scheme = "wss"
+	}
+
+	if s.WSURL == "" {
+		return fmt.Sprintf("%v://%v/ws", scheme, r.Host)
+	}
+
+	u, err := url.Parse(s.WSURL)
+	if err != nil {
+		return s.WSURL
+	}
+	if u.Scheme == "ws" && scheme == "wss" {
+		u.Scheme = scheme
+	}
+	return u.String()
+}
+
+// checkOrigin checks the "Origin" header of websocket requests with allowed origins.
+// Requests without "Origin"(non-browser clients) are allowed.
+// If allowed origins are empty, only the same origin is allowed. "*" allows any origin.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if len(settings.AllowedOrigins) == 0 {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+
+	for _, allowed := range settings.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
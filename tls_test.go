@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	t.Cleanup(func() { settings.AllowedOrigins = nil })
+
+	tests := []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		// Non-browser clients.
+		{nil, "", true},
+		{nil, "http://lottery.example.com", true},
+		{nil, "http://LOTTERY.example.com", true},
+		{nil, "http://evil.example.com", false},
+		{nil, "://bad", false},
+		{[]string{"https://a.example.com/"}, "https://a.example.com", true},
+		{[]string{"https://a.example.com"}, "http://a.example.com", false},
+		// The same origin is not allowed if it's not in the list.
+		{[]string{"https://a.example.com"}, "http://lottery.example.com", false},
+		{[]string{"https://a.example.com", "*"}, "http://evil.example.com", true},
+	}
+
+	for _, tt := range tests {
+		settings.AllowedOrigins = tt.allowed
+		r := httptest.NewRequest("GET", "http://lottery.example.com/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(r); got != tt.want {
+			t.Errorf("checkOrigin(%q) with allowed origins %q = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestWSOrigin(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	settings.AllowedOrigins = []string{"https://a.example.com"}
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+	for _, path := range []string{"/ws", "/display/ws"} {
+		_, resp, err := websocket.DefaultDialer.Dial(u+path, http.Header{"Origin": {"https://evil.example.com"}})
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("dial %v from a disallowed origin = %v, %v, want 403", path, resp, err)
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(u+path, http.Header{"Origin": {"https://a.example.com"}})
+		if err != nil {
+			t.Errorf("dial %v from an allowed origin error: %v", path, err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+func TestGetWSURL(t *testing.T) {
+	tlsSettings := ServerSettings{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}
+	tests := []struct {
+		s     ServerSettings
+		wsURL string
+		want  string
+	}{
+		{ServerSettings{}, "", "ws://lottery.example.com:8080/ws"},
+		{tlsSettings, "", "wss://lottery.example.com:8080/ws"},
+		{ServerSettings{}, "ws://ws.example.com/ws", "ws://ws.example.com/ws"},
+		// ws is upgraded to wss if TLS is enabled.
+		{tlsSettings, "ws://ws.example.com/ws", "wss://ws.example.com/ws"},
+		{tlsSettings, "wss://ws.example.com/ws", "wss://ws.example.com/ws"},
+	}
+
+	for _, tt := range tests {
+		tt.s.WSURL = tt.wsURL
+		r := httptest.NewRequest("GET", "http://lottery.example.com:8080/get-ws-url/", nil)
+		if got := getWSURL(tt.s, r); got != tt.want {
+			t.Errorf("getWSURL(%q, tls: %v) = %q, want %q", tt.wsURL, tlsEnabled(tt.s), got, tt.want)
+		}
+	}
+}
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if err := ensureSelfSignedCert(certFile, keyFile, []string{"lottery.example.com", "10.0.0.1"}); err != nil {
+		t.Fatalf("ensureSelfSignedCert() error: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatalf("LoadX509KeyPair() error: %v", err)
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error: %v", err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "lottery.example.com", "10.0.0.1"} {
+		if err = cert.VerifyHostname(host); err != nil {
+			t.Errorf("VerifyHostname(%v) error: %v", host, err)
+		}
+	}
+	if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v, want 0600", fi.Mode().Perm(), err)
+	}
+
+	// Existing files are kept.
+	if err = ensureSelfSignedCert(certFile, keyFile, nil); err != nil {
+		t.Fatalf("ensureSelfSignedCert() error: %v", err)
+	}
+	if buf, _ := os.ReadFile(certFile); string(buf) != string(certPEM) {
+		t.Errorf("existing certificate is replaced")
+	}
+}
+
+func TestWSS(t *testing.T) {
+	newTestServer(t, testConfig(), testParticipants(10))
+
+	certPEM, keyPEM, err := genSelfSignedCert([]string{"127.0.0.1"}, time.Now())
+	if err != nil {
+		t.Fatalf("genSelfSignedCert() error: %v", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair() error: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(serveWs))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The client trusts the self-signed certificate only.
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: pool}}
+
+	u := "wss" + strings.TrimPrefix(srv.URL, "https")
+	conn, _, err := dialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial %v error: %v", u, err)
+	}
+	c := &fakeClient{t: t, conn: conn}
+	defer conn.Close()
+
+	if res := c.do(Action{Name: "get_prizes"}); !res.Success || len(res.Prizes) != 3 {
+		t.Errorf("get_prizes over wss = %+v, want 3 prizes", res)
+	}
+
+	if _, _, err = websocket.DefaultDialer.Dial(u, nil); err == nil {
+		t.Errorf("dial without trusting the certificate, want error")
+	}
+}
@@ -0,0 +1,178 @@
+(function () {
+  "use strict";
+
+  var conn = null;
+  var prizes = [];
+  var running = false;
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function send(action) {
+    if (conn && conn.readyState === WebSocket.OPEN) {
+      conn.send(JSON.stringify(action));
+    }
+  }
+
+  // token returns the admin token required by draws if admin_token is set.
+  // It's shared with the admin console(/admin/) of the same origin.
+  function token() {
+    return sessionStorage.getItem("lottery-admin-token") || "";
+  }
+
+  function selectedPrize() {
+    return parseInt($("prize").value, 10) || 0;
+  }
+
+  function selectedPrizeID() {
+    return (prizes[selectedPrize()] || {}).id;
+  }
+
+  // selectPrize selects the prize by ID, e.g. for scheduled draws started by the server.
+  function selectPrize(id) {
+    for (var i = 0; i < prizes.length; i++) {
+      if (prizes[i].id === id && i !== selectedPrize()) {
+        $("prize").value = i;
+        showPrize();
+        return;
+      }
+    }
+  }
+
+  function showPrize() {
+    var p = prizes[selectedPrize()] || {};
+    $("prize-name").textContent = p.name || "";
+    $("prize-content").textContent = p.content || "";
+  }
+
+  function showNames(winners) {
+    var names = $("names");
+    names.innerHTML = "";
+    (winners || []).forEach(function (w) {
+      var span = document.createElement("span");
+      span.textContent = w.name;
+      names.appendChild(span);
+    });
+  }
+
+  function setRunning(r) {
+    running = r;
+    $("toggle").textContent = r ? "Stop" : "Start";
+  }
+
+  function toggle() {
+    $("message").textContent = "";
+    if (running) {
+      send({ name: "stop", prize_id: selectedPrizeID(), token: token() });
+    } else {
+      send({ name: "start", prize_id: selectedPrizeID(), token: token() });
+    }
+  }
+
+  $("toggle").onclick = toggle;
+
+  document.addEventListener("keydown", function (e) {
+    if (e.code === "Space" && e.target.tagName !== "SELECT") {
+      e.preventDefault();
+      toggle();
+    }
+  });
+
+  $("prize").onchange = function () {
+    showPrize();
+    send({ name: "get_winners", prize_id: selectedPrizeID() });
+    // Show the prize on the big screens(/display/).
+    send({ name: "display_prize", prize_id: selectedPrizeID(), token: token() });
+  };
+
+  function onMessage(res) {
+    var a = res.action || {};
+
+    if (!res.success && res.err_msg) {
+      $("message").textContent = res.err_msg;
+      if (res.err_msg === "invalid admin token") {
+        var t = window.prompt("Admin token");
+        if (t !== null) {
+          sessionStorage.setItem("lottery-admin-token", t);
+        }
+      }
+    }
+
+    switch (a.name) {
+      case "get_prizes":
+      case "state_changed":
+        var selected = $("prize").value;
+        prizes = res.prizes || [];
+        $("prize").innerHTML = "";
+        prizes.forEach(function (p, i) {
+          var o = document.createElement("option");
+          o.value = i;
+          o.textContent = p.name;
+          $("prize").appendChild(o);
+        });
+        if (selected !== "" && selected < prizes.length) {
+          $("prize").value = selected;
+        }
+        showPrize();
+        send({ name: "get_winners", prize_id: selectedPrizeID() });
+        break;
+      case "get_winners":
+        if (a.prize_id === selectedPrizeID()) {
+          showNames(res.winners);
+        }
+        break;
+      case "countdown":
+        selectPrize(a.prize_id);
+        $("message").textContent = "Scheduled draw starts in " + res.seconds + "s";
+        break;
+      case "start":
+        if (res.success) {
+          selectPrize(a.prize_id);
+          $("message").textContent = "";
+        }
+        setRunning(res.success);
+        showNames(res.winners);
+        break;
+      case "stop":
+        setRunning(false);
+        showNames(res.winners);
+        break;
+      case "abort":
+        // Winners are not changed, show the committed winners again.
+        setRunning(false);
+        $("message").textContent = res.err_msg;
+        send({ name: "get_winners", prize_id: a.prize_id });
+        break;
+    }
+  }
+
+  function connect() {
+    fetch("/get-ws-url/").then(function (r) {
+      return r.text();
+    }).then(function (url) {
+      conn = new WebSocket(url);
+      conn.onopen = function () {
+        $("status").textContent = "connected";
+        send({ name: "get_prizes" });
+      };
+      conn.onclose = function () {
+        $("status").textContent = "disconnected";
+        setRunning(false);
+        setTimeout(connect, 3000);
+      };
+      conn.onmessage = function (evt) {
+        // Queued messages are joined by newlines.
+        evt.data.split("\n").forEach(function (m) {
+          if (m) {
+            onMessage(JSON.parse(m));
+          }
+        });
+      };
+    }).catch(function () {
+      setTimeout(connect, 3000);
+    });
+  }
+
+  connect();
+})();
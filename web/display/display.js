@@ -0,0 +1,78 @@
+(function () {
+  "use strict";
+
+  var defaults = { background: "#8b0000", foreground: "#fff", accent: "#ffd700" };
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function setMedia(e, src) {
+    if (!src) {
+      e.hidden = true;
+      e.removeAttribute("src");
+      return;
+    }
+    e.hidden = false;
+    if (e.getAttribute("src") !== src) {
+      e.src = src;
+      if (e.play) {
+        e.play().catch(function () {});
+      }
+    }
+  }
+
+  function applyTheme(t) {
+    var s = document.body.style;
+    s.setProperty("--bg", t.background || defaults.background);
+    s.setProperty("--fg", t.foreground || defaults.foreground);
+    s.setProperty("--accent", t.accent || defaults.accent);
+    s.backgroundImage = t.background_image ? "url(\"" + encodeURI(t.background_image) + "\")" : "";
+  }
+
+  function showNames(ps) {
+    var names = $("names");
+    names.innerHTML = "";
+    (ps || []).forEach(function (p) {
+      var span = document.createElement("span");
+      span.textContent = p.name;
+      names.appendChild(span);
+    });
+  }
+
+  function show(d) {
+    var p = d.prize || {};
+    document.body.className = "connected " + d.status;
+    applyTheme(d.theme || {});
+    $("prize-name").textContent = p.name || "";
+    $("prize-content").textContent = p.content || "";
+    setMedia($("prize-image"), p.video ? "" : p.image);
+    setMedia($("prize-video"), p.video);
+    setMedia($("sponsor-logo"), p.sponsor_logo);
+    showNames(d.names);
+    $("countdown").textContent = d.status === "countdown" ? d.countdown : "";
+  }
+
+  function connect() {
+    var url = (location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/display/ws";
+    var conn = new WebSocket(url);
+    conn.onclose = function () {
+      document.body.classList.remove("connected");
+      setTimeout(connect, 3000);
+    };
+    conn.onmessage = function (evt) {
+      // Queued messages are joined by newlines.
+      evt.data.split("\n").forEach(function (m) {
+        if (!m) {
+          return;
+        }
+        var res = JSON.parse(m);
+        if (res.action && res.action.name === "display") {
+          show(res.display);
+        }
+      });
+    };
+  }
+
+  connect();
+})();
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetPrizes(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	res := c.do(Action{Name: "get_prizes"})
+	if !res.Success || len(res.Prizes) != 3 {
+		t.Fatalf("get_prizes = %+v, want 3 prizes", res)
+	}
+	for i, p := range testConfig().Prizes {
+		if res.Prizes[i].ID != p.ID {
+			t.Errorf("prizes[%v] = %v, want %v", i, res.Prizes[i].ID, p.ID)
+		}
+	}
+
+	// Old clients use prize indexes.
+	res = c.do(Action{Name: "get_winners", PrizeIndex: 2})
+	if !res.Success || res.PrizeID != "1st" || len(res.Winners) != 0 {
+		t.Errorf("get_winners = %+v, want no winners of 1st", res)
+	}
+}
+
+func TestDrawStartStop(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	res := c.draw("3rd", nil, 3)
+	if !res.Success || len(res.Winners) != 3 || !distinct(res.Winners) {
+		t.Fatalf("stop = %+v, want 3 distinct winners", res)
+	}
+
+	// Other clients get the committed winners.
+	other := dialTestClient(t, srv)
+	got := other.do(Action{Name: "get_winners", PrizeID: "3rd"})
+	if strings.Join(testIDs(got.Winners), ",") != strings.Join(testIDs(res.Winners), ",") {
+		t.Errorf("get_winners = %v, want %v", testIDs(got.Winners), testIDs(res.Winners))
+	}
+
+	// The history is recorded after the response is sent.
+	stopTestDraw()
+	if h, ok := findHistoryEntry(res.RequestID); !ok || !h.Success || len(h.Winners) != 3 {
+		t.Errorf("history of %v = %+v, %v, want the committed draw", res.RequestID, h, ok)
+	}
+}
+
+func TestDrawErrors(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	tests := []struct {
+		name   string
+		action Action
+		err    string
+	}{
+		{"stop without draw", Action{Name: "stop", PrizeID: "3rd"}, "no start is running"},
+		{"abort without draw", Action{Name: "abort", PrizeID: "3rd"}, "no start is running"},
+		{"re-lottery without winners", Action{Name: "start", PrizeID: "1st", OldWinnerIndexes: []int{0}}, "validate() error"},
+		{"unknown prize", Action{Name: "start", PrizeID: "x"}, "validate() error: prize index error"},
+	}
+	for _, tt := range tests {
+		if res := c.do(tt.action); res.Success || !strings.Contains(res.ErrMsg, tt.err) {
+			t.Errorf("%v: %+v, want error %q", tt.name, res, tt.err)
+		}
+	}
+
+	// Only one draw runs at a time.
+	id := c.send(Action{Name: "start", PrizeID: "3rd"})
+	c.waitFor(id, "start")
+	if res := c.do(Action{Name: "start", PrizeID: "2nd"}); res.Success || res.ErrMsg != "start() is already running" {
+		t.Errorf("second start = %+v, want error", res)
+	}
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	c.waitFor(id, "stop")
+
+	if res := c.do(Action{Name: "start", PrizeID: "3rd"}); res.Success || res.ErrMsg != "validate() error: no need" {
+		t.Errorf("start of the drawn prize = %+v, want error", res)
+	}
+}
+
+func TestRelottery(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	old := c.draw("3rd", nil, 2).Winners
+	res := c.draw("3rd", []int{0, 2}, 3)
+	if !res.Success || len(res.Winners) != 3 || !distinct(res.Winners) {
+		t.Fatalf("re-lottery = %+v, want 3 distinct winners", res)
+	}
+	if res.Winners[1].ID != old[1].ID {
+		t.Errorf("re-lottery [0, 2] = %v, winner 1 of %v is changed", testIDs(res.Winners), testIDs(old))
+	}
+
+	if res := c.do(Action{Name: "start", PrizeID: "3rd", OldWinnerIndexes: []int{3}}); res.Success {
+		t.Errorf("re-lottery of invalid index = %+v, want error", res)
+	}
+}
+
+func TestFullEvent(t *testing.T) {
+	// 6 participants for 6 winners: everyone wins exactly one prize.
+	srv := newTestServer(t, testConfig(), testParticipants(6))
+	c := dialTestClient(t, srv)
+
+	won := map[string]string{}
+	for _, p := range testConfig().Prizes {
+		res := c.draw(p.ID, nil, 2)
+		if !res.Success || len(res.Winners) != p.Num {
+			t.Fatalf("draw %v = %+v, want %v winners", p.ID, res, p.Num)
+		}
+		for _, w := range res.Winners {
+			if prize, ok := won[w.ID]; ok {
+				t.Fatalf("%v won %v and %v", w.ID, prize, p.ID)
+			}
+			won[w.ID] = p.ID
+		}
+	}
+
+	if len(won) != 6 {
+		t.Errorf("winners = %v, want 6", len(won))
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(20))
+	c := dialTestClient(t, srv)
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd"})
+	c.waitFor(id, "start")
+
+	// Clients read prizes and winners while the draw is rolling.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		other := dialTestClient(t, srv)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				for _, a := range []Action{{Name: "get_winners", PrizeID: "3rd"}, {Name: "get_prizes"}} {
+					if err := other.conn.WriteJSON(a); err != nil {
+						t.Errorf("WriteJSON() error: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	if res := c.waitFor(id, "stop"); !res.Success || len(res.Winners) != 3 {
+		t.Fatalf("stop = %+v, want 3 winners", res)
+	}
+}
+
+func TestRelotteryPreview(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+	other := dialTestClient(t, srv)
+
+	old := c.draw("3rd", nil, 1).Winners
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd", OldWinnerIndexes: []int{0}})
+	for i := 0; i < 5; i++ {
+		c.waitFor(id, "start")
+
+		// Rolling previews of the re-lottery do not change the committed winners.
+		res := other.do(Action{Name: "get_winners", PrizeID: "3rd"})
+		if strings.Join(testIDs(res.Winners), ",") != strings.Join(testIDs(old), ",") {
+			t.Fatalf("get_winners while rolling = %v, want %v", testIDs(res.Winners), testIDs(old))
+		}
+	}
+
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	res := c.waitFor(id, "stop")
+	if !res.Success || len(res.Winners) != 3 || !distinct(res.Winners) || res.Winners[1].ID != old[1].ID {
+		t.Fatalf("re-lottery = %v, want 3 distinct winners with kept winners of %v", testIDs(res.Winners), testIDs(old))
+	}
+}
+
+func TestDrawAbort(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+	other := dialTestClient(t, srv)
+
+	old := c.draw("3rd", nil, 1).Winners
+
+	id := c.send(Action{Name: "start", PrizeID: "3rd", OldWinnerIndexes: []int{0, 2}})
+	for i := 0; i < 3; i++ {
+		c.waitFor(id, "start")
+	}
+
+	// Abort by another client is broadcast to all clients.
+	other.send(Action{Name: "abort", PrizeID: "3rd"})
+	for _, client := range []*fakeClient{c, other} {
+		if res := client.waitFor(id, "abort"); res.Success || res.ErrMsg != errDrawAborted.Error() {
+			t.Fatalf("abort = %+v, want %q", res, errDrawAborted)
+		}
+	}
+
+	// Winners to re-lottery are not replaced.
+	res := other.do(Action{Name: "get_winners", PrizeID: "3rd"})
+	if strings.Join(testIDs(res.Winners), ",") != strings.Join(testIDs(old), ",") {
+		t.Fatalf("get_winners after abort = %v, want %v", testIDs(res.Winners), testIDs(old))
+	}
+
+	stopTestDraw()
+	if h, ok := findHistoryEntry(id); !ok || h.Action != "abort" || h.Success {
+		t.Errorf("history of %v = %+v, %v, want the aborted draw", id, h, ok)
+	}
+
+	// The prize can be drawn again.
+	if res = c.draw("3rd", []int{0, 2}, 1); !res.Success || len(res.Winners) != 3 || res.Winners[1].ID != old[1].ID {
+		t.Errorf("re-lottery after abort = %+v, want 3 winners with the kept winner of %v", res, testIDs(old))
+	}
+}
+
+func TestStartAfterStop(t *testing.T) {
+	srv := newTestServer(t, testConfig(), testParticipants(10))
+	c := dialTestClient(t, srv)
+
+	// Start the next draw right after stop, without waiting for the committed winners.
+	first := c.send(Action{Name: "start", PrizeID: "3rd"})
+	c.waitFor(first, "start")
+	c.send(Action{Name: "stop", PrizeID: "3rd"})
+	second := c.send(Action{Name: "start", PrizeID: "2nd"})
+
+	committed := c.waitFor(first, "stop")
+	if !committed.Success || len(committed.Winners) != 3 {
+		t.Fatalf("stop 3rd = %+v, want 3 winners", committed)
+	}
+	if res := c.waitFor(second, "start"); !res.Success {
+		t.Fatalf("start 2nd = %+v, want rounds", res)
+	}
+
+	c.send(Action{Name: "stop", PrizeID: "2nd"})
+	res := c.waitFor(second, "stop")
+	if !res.Success || len(res.Winners) != 2 {
+		t.Fatalf("stop 2nd = %+v, want 2 winners", res)
+	}
+	// The draw of 2nd starts from the committed winners of 3rd.
+	if w := append(committed.Winners, res.Winners...); !distinct(w) {
+		t.Errorf("winners of 3rd and 2nd = %v, want distinct winners", testIDs(w))
+	}
+}